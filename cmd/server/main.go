@@ -1,18 +1,24 @@
 package main
 
 import (
+	"collaborative-markdown-editor/internal/blob"
+	"collaborative-markdown-editor/internal/codec"
 	"collaborative-markdown-editor/internal/config"
 	"collaborative-markdown-editor/internal/db"
 	"collaborative-markdown-editor/internal/document"
 	"collaborative-markdown-editor/internal/event"
 	"collaborative-markdown-editor/internal/kafka"
+	"collaborative-markdown-editor/internal/mail"
 	"collaborative-markdown-editor/internal/middleware"
 	"collaborative-markdown-editor/internal/notification"
 	"collaborative-markdown-editor/internal/sync"
+	"collaborative-markdown-editor/internal/team"
 	"collaborative-markdown-editor/internal/user"
 	"collaborative-markdown-editor/internal/worker"
+	"collaborative-markdown-editor/internal/workspace"
 	"collaborative-markdown-editor/redis"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -53,13 +59,34 @@ func main() {
 	// worker
 	wp := worker.NewWorkerPool(config.AppConfig.WorkerPollSize) // Start N concurrent workers
 
+	if !codec.Valid(config.AppConfig.StorageCodec) {
+		log.Fatal().Str("codec", config.AppConfig.StorageCodec).Msg("Unknown STORAGE_CODEC")
+	}
+
+	// blob storage for large snapshots and updates
+	blobStore, err := blob.NewStore(db.AppDb)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize blob store")
+	}
+
 	// Initialize repository
 	userRepo := user.NewRepository(db.AppDb)
-	docRepo := document.NewRepository(db.AppDb)
+	docRepo := document.NewRepository(db.AppDb, document.HistoryRetention{
+		MaxSnapshots: config.AppConfig.HistoryRetentionSnapshots,
+		MaxAge:       time.Duration(config.AppConfig.HistoryRetentionDays) * 24 * time.Hour,
+	}, document.BlobOffload{
+		Store:     blobStore,
+		Threshold: config.AppConfig.BlobOffloadThreshold,
+	}, document.Compression{
+		Codec:   config.AppConfig.StorageCodec,
+		MinSize: config.AppConfig.CompressionMinSize,
+	})
 	eventRepo := event.NewRepository(db.AppDb)
+	teamRepo := team.NewRepository(db.AppDb)
+	workspaceRepo := workspace.NewRepository(db.AppDb)
 
 	// Initialize service
-	userService := user.NewService(userRepo, redisCache)
+	userService := user.NewService(userRepo, redisCache, docRepo)
 	syncClient := sync.NewSyncClient()
 	defer func() {
 		_ = syncClient.Close()
@@ -82,15 +109,31 @@ func main() {
 		userService,
 		syncClient,
 		redisCache,
-		uint64(config.AppConfig.DocumentSnapshotThreshold),
+		document.SnapshotPolicy{
+			MaxPendingUpdates: uint64(config.AppConfig.DocumentSnapshotThreshold),
+			MaxPendingBytes:   int64(config.AppConfig.SnapshotMaxPendingBytes),
+			MaxAge:            time.Duration(config.AppConfig.SnapshotMaxAgeHours) * time.Hour,
+			IdleAfter:         time.Duration(config.AppConfig.SnapshotIdleMinutes) * time.Minute,
+		},
+		config.AppConfig.YjsTextName,
 		wp,
 		notificationService,
+		document.Invitations{
+			Mailer:    mail.NewMailer(),
+			AcceptURL: config.AppConfig.FrontendAddress + "/invitations/",
+			Expiry:    time.Duration(config.AppConfig.InvitationExpiryDays) * 24 * time.Hour,
+		},
+		config.AppConfig.DedupUpdateContent,
 	)
 	eventService := event.NewService(eventRepo, docService)
+	teamService := team.NewService(teamRepo, userService, docService)
+	workspaceService := workspace.NewService(workspaceRepo, userService, docService)
 
 	// Initialize handler
 	docHandler := document.NewHandler(docService)
 	userHandler := user.NewHandler(userService)
+	teamHandler := team.NewHandler(teamService)
+	workspaceHandler := workspace.NewHandler(workspaceService)
 	// Initialize middleware
 	authMiddleware := &middleware.Auth{
 		UserService:    userService,
@@ -143,6 +186,9 @@ func main() {
 	router.POST("/login", userHandler.Login)
 	router.POST("/refresh", userHandler.RefreshToken)
 
+	// public preview of a share link
+	router.GET("/share-links/:token", docHandler.ShowShareLink)
+
 	authGroup := router.Group("/")
 	authGroup.Use(authMiddleware.AuthMiddleWare())
 	authGroup.DELETE("/logout", userHandler.Logout)
@@ -151,22 +197,62 @@ func main() {
 	authGroup.PATCH("/change-password", userHandler.ChangePassword)
 	authGroup.GET("/users", userHandler.SearchUsers)
 	authGroup.POST("/documents", docHandler.Create)
+	authGroup.POST("/documents/import", docHandler.Import)
 	authGroup.PATCH("/documents/:id/rename", docHandler.Rename)
 	authGroup.GET("/documents", docHandler.ShowUserDocuments)
 	authGroup.GET("/documents/shared", docHandler.ShowSharedDocuments)
+	authGroup.GET("/documents/search", docHandler.Search)
 	authGroup.GET("/documents/:id", docHandler.ShowDocument)
 	authGroup.DELETE("/documents/:id", docHandler.DeleteDocument)
 	authGroup.GET("/documents/:id/collaborators", docHandler.ListCollaborators)
 	authGroup.POST("/documents/:id/collaborators", docHandler.AddCollaborator)
 	authGroup.PUT("/documents/:id/collaborators", docHandler.ChangeCollaboratorRole)
 	authGroup.DELETE("/documents/:id/collaborators/:userId", docHandler.RemoveCollaborator)
+	authGroup.POST("/documents/:id/transfer", docHandler.TransferOwnership)
+	authGroup.GET("/documents/:id/share-links", docHandler.ListShareLinks)
+	authGroup.POST("/documents/:id/share-links", docHandler.CreateShareLink)
+	authGroup.DELETE("/documents/:id/share-links/:linkId", docHandler.RevokeShareLink)
+	authGroup.POST("/share-links/:token/redeem", docHandler.RedeemShareLink)
+	authGroup.GET("/documents/:id/invitations", docHandler.ListInvitations)
+	authGroup.POST("/documents/:id/invitations", docHandler.InviteCollaborator)
+	authGroup.DELETE("/documents/:id/invitations/:invitationId", docHandler.RevokeInvitation)
+	authGroup.POST("/invitations/:token/accept", docHandler.AcceptInvitation)
+	authGroup.GET("/documents/:id/teams", docHandler.ListTeamGrants)
+	authGroup.PUT("/documents/:id/teams/:teamId", docHandler.GrantTeam)
+	authGroup.DELETE("/documents/:id/teams/:teamId", docHandler.RevokeTeamGrant)
+	authGroup.GET("/teams", teamHandler.List)
+	authGroup.POST("/teams", teamHandler.Create)
+	authGroup.GET("/teams/:id", teamHandler.Show)
+	authGroup.DELETE("/teams/:id", teamHandler.Delete)
+	authGroup.POST("/teams/:id/members", teamHandler.AddMember)
+	authGroup.PUT("/teams/:id/members/:userId", teamHandler.ChangeMemberRole)
+	authGroup.DELETE("/teams/:id/members/:userId", teamHandler.RemoveMember)
+	authGroup.PUT("/documents/:id/workspace", docHandler.MoveToWorkspace)
+	authGroup.GET("/workspaces", workspaceHandler.List)
+	authGroup.POST("/workspaces", workspaceHandler.Create)
+	authGroup.GET("/workspaces/:id", workspaceHandler.Show)
+	authGroup.DELETE("/workspaces/:id", workspaceHandler.Delete)
+	authGroup.POST("/workspaces/:id/members", workspaceHandler.AddMember)
+	authGroup.PUT("/workspaces/:id/members/:userId", workspaceHandler.ChangeMemberRole)
+	authGroup.DELETE("/workspaces/:id/members/:userId", workspaceHandler.RemoveMember)
+	authGroup.GET("/documents/:id/snapshot-policy", docHandler.ShowSnapshotPolicy)
+	authGroup.PUT("/documents/:id/snapshot-policy", docHandler.UpdateSnapshotPolicy)
+	authGroup.GET("/documents/:id/versions", docHandler.ListVersions)
+	authGroup.POST("/documents/:id/versions", docHandler.CreateVersion)
+	authGroup.GET("/documents/:id/versions/:versionId", docHandler.ShowVersionState)
+	authGroup.POST("/documents/:id/versions/:versionId/restore", docHandler.RestoreVersion)
+	authGroup.GET("/documents/:id/content", docHandler.ShowContent)
+	authGroup.GET("/documents/:id/export", docHandler.Export)
+	authGroup.GET("/documents/:id/history/:seq", docHandler.ShowHistoryState)
 
 	// internal use routes
 	authInternalGroup := router.Group("/internal")
 	authInternalGroup.Use(authMiddleware.InternalAuthMiddleware())
 	authInternalGroup.GET("/documents/:id/permission", docHandler.ShowUserRole)
 	authInternalGroup.GET("/documents/:id/last-state", docHandler.ShowDocumentState)
+	authInternalGroup.GET("/documents/:id/updates", docHandler.ListUpdates)
 	authInternalGroup.POST("/documents/:id/update", docHandler.CreateUpdate)
+	authInternalGroup.POST("/documents/:id/updates", docHandler.CreateUpdates)
 	authInternalGroup.POST("/documents/:id/snapshot", docHandler.CreateSnapshot)
 
 	// Server configuration
@@ -220,11 +306,34 @@ func main() {
 		}
 	}()
 
+	// rewrite history written before compression and checksums existed
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if config.AppConfig.CompressLegacyRows {
+		go func() {
+			err := document.CompressLegacyHistory(jobsCtx, docRepo, 100, time.Second)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Error().Err(err).Msg("Legacy history compression stopped")
+			}
+		}()
+	}
+	// snapshot documents that went idle or old without a new update
+	if config.AppConfig.SnapshotSchedulerSeconds > 0 {
+		interval := time.Duration(config.AppConfig.SnapshotSchedulerSeconds) * time.Second
+		go document.RunSnapshotScheduler(jobsCtx, docService, interval)
+	}
+	// forget the dedup keys of old updates
+	if config.AppConfig.UpdateKeyRetentionHours > 0 {
+		retention := time.Duration(config.AppConfig.UpdateKeyRetentionHours) * time.Hour
+		go document.RunUpdateKeyPruner(jobsCtx, docRepo, retention, time.Hour)
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit // block until signal received
 	log.Info().Msg("Shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -0,0 +1,69 @@
+// Command verify reads back every stored snapshot and update and reports the
+// ones that do not match their checksum, can't be decompressed, or whose blob
+// is missing. It exits with status 1 when it finds any.
+//
+//	go run ./cmd/verify            # every document
+//	go run ./cmd/verify -doc 42    # a single document
+package main
+
+import (
+	"collaborative-markdown-editor/internal/blob"
+	"collaborative-markdown-editor/internal/config"
+	"collaborative-markdown-editor/internal/db"
+	"collaborative-markdown-editor/internal/document"
+	"collaborative-markdown-editor/internal/domain"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	logger "collaborative-markdown-editor/internal/logger"
+
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	docID := flag.Uint64("doc", 0, "verify only this document")
+	flag.Parse()
+
+	config.LoadConfig()
+	logger.Init(config.AppConfig.Environment)
+
+	db.ConnectDb()
+	defer db.CloseDb()
+
+	blobStore, err := blob.NewStore(db.AppDb)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize blob store")
+	}
+	// only reads, retention and compression settings are not used
+	repo := document.NewRepository(db.AppDb, document.HistoryRetention{}, document.BlobOffload{Store: blobStore}, document.Compression{})
+
+	ids := []uint64{*docID}
+	if *docID == 0 {
+		ids = nil
+		if err := db.AppDb.Model(&domain.Document{}).Order("id").Pluck("id", &ids).Error; err != nil {
+			log.Fatal().Err(err).Msg("Failed to list documents")
+		}
+	}
+
+	ctx := context.Background()
+	var issues, unchecked int
+	for _, id := range ids {
+		found, n, err := repo.VerifyDocument(ctx, id)
+		if err != nil {
+			log.Fatal().Err(err).Uint64("doc_id", id).Msg("Failed to verify document")
+		}
+		for _, issue := range found {
+			fmt.Printf("document %d: %s seq %d: %v\n", issue.DocumentID, issue.Kind, issue.Seq, issue.Err)
+		}
+		issues += len(found)
+		unchecked += n
+	}
+
+	fmt.Printf("verified %d documents: %d corrupt, %d rows without checksum\n", len(ids), issues, unchecked)
+	if issues > 0 {
+		db.CloseDb()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,54 @@
+// Package blob stores binary objects, like large snapshots and updates, outside
+// of the document tables
+package blob
+
+import (
+	"collaborative-markdown-editor/internal/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned by Get when no blob is stored under the key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore is a key value store for binary objects. Keys are slash separated
+// paths like "documents/1/snapshots/<id>".
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the blob, deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Checksum is the hex encoded SHA-256 of data, kept next to a blob reference
+// to detect a blob that was changed or swapped
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewStore creates the store selected by BLOB_BACKEND
+func NewStore(db *gorm.DB) (BlobStore, error) {
+	cfg := config.AppConfig
+	switch cfg.BlobBackend {
+	case "", "postgres":
+		return NewPostgresStore(db), nil
+	case "fs":
+		return NewFSStore(cfg.BlobFSRoot)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  cfg.BlobS3Endpoint,
+			Region:    cfg.BlobS3Region,
+			Bucket:    cfg.BlobS3Bucket,
+			AccessKey: cfg.BlobS3AccessKey,
+			SecretKey: cfg.BlobS3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.BlobBackend)
+	}
+}
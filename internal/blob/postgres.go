@@ -0,0 +1,45 @@
+package blob
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore keeps blobs in the blobs table of the application database
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Put(ctx context.Context, key string, data []byte) error {
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"data", "created_at"}),
+		}).
+		Create(&domain.Blob{Key: key, Data: data, CreatedAt: time.Now().UTC()}).Error
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var b domain.Blob
+	err := s.db.WithContext(ctx).Where("key = ?", key).First(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Data, nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("key = ?", key).Delete(&domain.Blob{}).Error
+}
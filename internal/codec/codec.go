@@ -0,0 +1,94 @@
+// Package codec compresses the snapshot and update binaries stored in the
+// database
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codecs of a stored binary. Rows written before compression existed have an
+// empty codec and hold raw bytes, like None. Unreadable marks those of them the
+// background compression could not read, they still hold raw bytes.
+const (
+	Legacy     = ""
+	None       = "none"
+	Gzip       = "gzip"
+	Zstd       = "zstd"
+	Unreadable = "unreadable"
+)
+
+// EncodeAll and DecodeAll are safe for concurrent use, one of each is enough
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Valid reports whether codec can be used to write new rows
+func Valid(codec string) bool {
+	switch codec {
+	case None, Gzip, Zstd:
+		return true
+	}
+	return false
+}
+
+// Compress encodes data with codec and returns the codec actually used: None
+// when compressing does not make data smaller, as for short updates.
+func Compress(codec string, data []byte) ([]byte, string, error) {
+	var out []byte
+	switch codec {
+	case None, Legacy:
+		return data, None, nil
+	case Zstd:
+		out = zstdEncoder.EncodeAll(data, nil)
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, "", err
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		out = buf.Bytes()
+	default:
+		return nil, "", fmt.Errorf("unknown codec %q", codec)
+	}
+
+	if len(out) >= len(data) {
+		return data, None, nil
+	}
+	return out, codec, nil
+}
+
+// Decompress returns the raw bytes of data stored with codec
+func Decompress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case None, Legacy, Unreadable:
+		return data, nil
+	case Zstd:
+		out, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return out, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer r.Close()
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown codec %q", codec)
+	}
+}
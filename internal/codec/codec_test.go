@@ -0,0 +1,61 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCompress_RoundTrip tests that every codec decodes what it encoded
+func TestCompress_RoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("# heading\nsome markdown text\n"), 200)
+
+	for _, c := range []string{None, Gzip, Zstd} {
+		out, used, err := Compress(c, data)
+		assert.NoError(t, err)
+		assert.Equal(t, c, used)
+		if c != None {
+			assert.Less(t, len(out), len(data))
+		}
+
+		raw, err := Decompress(used, out)
+		assert.NoError(t, err)
+		assert.Equal(t, data, raw)
+	}
+}
+
+// TestCompress_Incompressible tests that data that does not shrink is kept raw
+func TestCompress_Incompressible(t *testing.T) {
+	data := []byte{0x01, 0x01, 0x01, 0x00, 0x04, 0x01, 0x01, 0x74, 0x03, 0x61, 0x62, 0x63, 0x00}
+
+	out, used, err := Compress(Zstd, data)
+
+	assert.NoError(t, err)
+	assert.Equal(t, None, used)
+	assert.Equal(t, data, out)
+}
+
+// TestDecompress_Legacy tests that rows without codec, or marked unreadable,
+// are read as raw bytes
+func TestDecompress_Legacy(t *testing.T) {
+	for _, c := range []string{Legacy, Unreadable} {
+		raw, err := Decompress(c, []byte("abc"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("abc"), raw)
+	}
+}
+
+// TestDecompress_Errors tests corrupt data and unknown codecs
+func TestDecompress_Errors(t *testing.T) {
+	_, err := Decompress(Zstd, []byte("not zstd"))
+	assert.Error(t, err)
+
+	_, err = Decompress(Gzip, []byte("not gzip"))
+	assert.Error(t, err)
+
+	_, err = Decompress("lz4", []byte("abc"))
+	assert.Error(t, err)
+	assert.False(t, Valid("lz4"))
+}
@@ -42,9 +42,52 @@ type Config struct {
 
 	FrontendAddress string
 
-	DocumentSnapshotThreshold int
+	// global snapshot policy, a zero value disables its rule. Documents can
+	// override it, see internal/document/policy.go
+	DocumentSnapshotThreshold int // pending updates
+	SnapshotMaxPendingBytes   int
+	SnapshotMaxAgeHours       int
+	SnapshotIdleMinutes       int
+	SnapshotSchedulerSeconds  int // how often idle and old documents are checked, 0 disables
+
+	// name of the root Y.Text holding the markdown of a document
+	YjsTextName string
+
+	// history retention, both zero means updates are compacted on every snapshot
+	HistoryRetentionSnapshots int
+	HistoryRetentionDays      int
+
+	// deduplication of retried updates, by their update id and, when enabled,
+	// by content for updates sent without one
+	DedupUpdateContent      bool
+	UpdateKeyRetentionHours int // how long dedup keys are kept
 
 	KafkaBootstrapServers string
+
+	// blob storage for snapshots and updates larger than BlobOffloadThreshold
+	// bytes (0 keeps everything in the document tables)
+	BlobBackend          string // postgres, fs or s3
+	BlobOffloadThreshold int
+	BlobFSRoot           string
+	BlobS3Endpoint       string
+	BlobS3Region         string
+	BlobS3Bucket         string
+	BlobS3AccessKey      string
+	BlobS3SecretKey      string
+
+	// compression of stored snapshots and updates
+	StorageCodec       string // none, gzip or zstd
+	CompressionMinSize int    // binaries shorter than this are stored raw
+	CompressLegacyRows bool   // compress rows written before in the background
+
+	// outgoing mail, messages are only logged when SMTPHost is empty
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	InvitationExpiryDays int
 }
 
 // Global application configuration
@@ -88,6 +131,15 @@ func LoadConfig() {
 		RedisAddress:              getEnv("REDIS_ADDRESS", "localhost:6379"),
 		RedisPollSize:             getEnv("REDIS_POOL_SIZE", 10),
 		DocumentSnapshotThreshold: getEnv("SNAPSHOT_THRESHOLD", 200), // will snapshot document every X updates
+		SnapshotMaxPendingBytes:   getEnv("SNAPSHOT_MAX_PENDING_BYTES", 1<<20),
+		SnapshotMaxAgeHours:       getEnv("SNAPSHOT_MAX_AGE_HOURS", 24),
+		SnapshotIdleMinutes:       getEnv("SNAPSHOT_IDLE_MINUTES", 10),
+		SnapshotSchedulerSeconds:  getEnv("SNAPSHOT_SCHEDULER_SECONDS", 60),
+		HistoryRetentionSnapshots: getEnv("HISTORY_RETENTION_SNAPSHOTS", 0),
+		HistoryRetentionDays:      getEnv("HISTORY_RETENTION_DAYS", 0),
+		DedupUpdateContent:        getEnv("DEDUP_UPDATE_CONTENT", false),
+		UpdateKeyRetentionHours:   getEnv("UPDATE_KEY_RETENTION_HOURS", 24),
+		YjsTextName:               getEnv("YJS_TEXT_NAME", "content"),
 		SyncServerAddress:         getEnv("SYNC_ADDRESS", "http://localhost:8787"),
 		SyncServerGRPCAddress:     getEnv("SYNC_GRPC_ADDRESS", ""),
 		SyncServerSecret:          getEnv("SYNC_SECRET", "collab-sync-secret"),
@@ -96,6 +148,23 @@ func LoadConfig() {
 		FrontendAddress:           getEnv("FRONTEND_ADDRESS", "https://production-frontend.com"),
 		WorkerPollSize:            getEnv("WORKER_POOL_SIZE", 5),
 		KafkaBootstrapServers:     getEnv("KAFKA_BROKERS", ""),
+		BlobBackend:               getEnv("BLOB_BACKEND", "postgres"),
+		BlobOffloadThreshold:      getEnv("BLOB_OFFLOAD_THRESHOLD", 0),
+		BlobFSRoot:                getEnv("BLOB_FS_ROOT", "data/blobs"),
+		BlobS3Endpoint:            getEnv("BLOB_S3_ENDPOINT", ""),
+		BlobS3Region:              getEnv("BLOB_S3_REGION", "us-east-1"),
+		BlobS3Bucket:              getEnv("BLOB_S3_BUCKET", ""),
+		BlobS3AccessKey:           getEnv("BLOB_S3_ACCESS_KEY", ""),
+		BlobS3SecretKey:           getEnv("BLOB_S3_SECRET_KEY", ""),
+		StorageCodec:              getEnv("STORAGE_CODEC", "zstd"),
+		CompressionMinSize:        getEnv("COMPRESSION_MIN_SIZE", 256),
+		CompressLegacyRows:        getEnv("COMPRESS_LEGACY_ROWS", true),
+		SMTPHost:                  getEnv("SMTP_HOST", ""),
+		SMTPPort:                  getEnv("SMTP_PORT", 587),
+		SMTPUsername:              getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:              getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:                  getEnv("SMTP_FROM", "no-reply@localhost"),
+		InvitationExpiryDays:      getEnv("INVITATION_EXPIRY_DAYS", 14),
 	}
 }
 
@@ -13,12 +13,22 @@ import (
 func Migrate() {
 	err := AppDb.AutoMigrate(
 		&domain.User{},
+		&domain.Workspace{},
+		&domain.WorkspaceMember{},
 		&domain.Document{},
 		&domain.DocumentUpdate{},
+		&domain.DocumentUpdateKey{},
 		&domain.DocumentSnapshot{},
 		&domain.DocumentVersion{},
 		&domain.DocumentCollaborator{},
+		&domain.DocumentSnapshotPolicy{},
+		&domain.DocumentShareLink{},
+		&domain.DocumentInvitation{},
+		&domain.Team{},
+		&domain.TeamMember{},
+		&domain.DocumentTeamGrant{},
 		&domain.Event{},
+		&domain.Blob{},
 	)
 
 	if err != nil {
@@ -32,6 +42,25 @@ func Migrate() {
 		`CREATE INDEX IF NOT EXISTS idx_updates_doc_created ON document_updates (document_id, created_at);`,
 		`CREATE INDEX IF NOT EXISTS idx_versions_doc ON document_versions (document_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_snapshots_doc_seq ON document_snapshots (document_id, seq DESC);`,
+		// rows left for the legacy compression job
+		`CREATE INDEX IF NOT EXISTS idx_updates_legacy_codec ON document_updates (id) WHERE codec = '';`,
+		`CREATE INDEX IF NOT EXISTS idx_snapshots_legacy_codec ON document_snapshots (id) WHERE codec = '';`,
+		// documents with updates not covered by a snapshot yet, from before
+		// pending_since was tracked
+		`UPDATE documents d SET pending_since = now()
+			WHERE pending_since IS NULL
+			AND update_seq > COALESCE((SELECT MAX(seq) FROM document_snapshots s WHERE s.document_id = d.id), 0);`,
+		// emails are stored in lower case so the unique index on email covers
+		// every case; legacy rows clashing with another case are left as they are
+		`UPDATE users u SET email = LOWER(TRIM(email))
+			WHERE email <> LOWER(TRIM(email))
+			AND NOT EXISTS (SELECT 1 FROM users o WHERE o.id <> u.id AND LOWER(TRIM(o.email)) = LOWER(TRIM(u.email)));`,
+		`DROP INDEX IF EXISTS idx_users_email_lower;`,
+		// full-text search, 'simple' config since documents are in any language
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS title_tsv tsvector GENERATED ALWAYS AS (to_tsvector('simple', coalesce(title, ''))) STORED;`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS content_tsv tsvector;`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_title_tsv ON documents USING GIN (title_tsv);`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_content_tsv ON documents USING GIN (content_tsv);`,
 	}
 	err = RunSQL(statements)
 
@@ -60,7 +89,7 @@ func SeedData() {
 	// Check if user exists
 	_, err := userRepo.FindByEmail(ctx, testUser.Email)
 	if err != nil {
-		userService := user.NewService(userRepo, nil)
+		userService := user.NewService(userRepo, nil, nil)
 		// User doesn't exist, create it
 		if err := userService.Register(ctx, testUser); err != nil {
 			log.Error().Err(err).Msg("Error creating test user")
@@ -0,0 +1,34 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/rs/zerolog/log"
+)
+
+// CompressLegacyHistory compresses and checksums, batch by batch, the
+// snapshots and updates stored before compression was enabled. It returns once every row was
+// rewritten or ctx is done, and pauses between batches to leave the database
+// to live traffic.
+func CompressLegacyHistory(ctx context.Context, repo DocumentRepository, batchSize int, pause time.Duration) error {
+	total := 0
+	for {
+		n, err := repo.CompressLegacyRows(ctx, batchSize)
+		total += n
+		if err != nil {
+			return fmt.Errorf("compress legacy history after %d rows: %w", total, err)
+		}
+		if n == 0 {
+			log.Info().Int("rows", total).Msg("Legacy document history compressed")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package document
+
+import (
+	"context"
+	"time"
+
+	log "github.com/rs/zerolog/log"
+)
+
+// RunUpdateKeyPruner forgets, every interval, the dedup keys of updates stored
+// longer than maxAge ago. A retry arriving later than maxAge is stored again.
+// It returns when ctx is done.
+func RunUpdateKeyPruner(ctx context.Context, repo DocumentRepository, maxAge time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := repo.PruneUpdateKeys(ctx, time.Now().UTC().Add(-maxAge))
+			if err != nil {
+				log.Error().Err(err).Msg("Update key pruning failed")
+				continue
+			}
+			if n > 0 {
+				log.Info().Int64("keys", n).Msg("Pruned update keys")
+			}
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package document
 
 import (
+	"archive/zip"
 	"collaborative-markdown-editor/internal/domain"
 	"collaborative-markdown-editor/internal/errors"
 	"collaborative-markdown-editor/internal/utils"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"path"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,8 +28,14 @@ type CreateOrRenameRequest struct {
 	Title   string `json:"title" binding:"required,min=1,max=255"`
 }
 
+type CreateDocumentRequest struct {
+	CreateOrRenameRequest
+	// optional, the workspace owning the document
+	WorkspaceID *uint64 `json:"workspace_id"`
+}
+
 func (h *Handler) Create(c *gin.Context) {
-	var form CreateOrRenameRequest
+	var form CreateDocumentRequest
 	if err := c.ShouldBindJSON(&form); err != nil {
 		c.Error(errors.NewValidationError(err))
 		return
@@ -34,6 +45,7 @@ func (h *Handler) Create(c *gin.Context) {
 
 	doc := &domain.Document{
 		Title:   form.Title,
+		WorkspaceID: form.WorkspaceID,
 	}
 
 	if err := h.service.CreateUserDocument(c.Request.Context(), userID.(uint64), doc); err != nil {
@@ -69,11 +81,55 @@ func (h *Handler) Rename(c *gin.Context) {
     c.JSON(200, doc)
 }
 
+type ListDocumentsQuery struct {
+	Q       string `form:"q" binding:"max=255"`
+	Sort    string `form:"sort" binding:"omitempty,oneof=title created_at updated_at"`
+	Order   string `form:"order" binding:"omitempty,oneof=asc desc"`
+	Role    string `form:"role" binding:"omitempty,oneof=editor viewer"`
+	OwnerID uint64 `form:"owner_id"`
+	WorkspaceID uint64 `form:"workspace_id"`
+}
+
+func bindListFilter(c *gin.Context) (DocumentListFilter, error) {
+	var query ListDocumentsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return DocumentListFilter{}, errors.NewValidationError(err)
+	}
+
+	return DocumentListFilter{
+		Query:   strings.TrimSpace(query.Q),
+		Sort:    query.Sort,
+		Order:   query.Order,
+		Role:    query.Role,
+		OwnerID: query.OwnerID,
+		WorkspaceID: query.WorkspaceID,
+	}, nil
+}
+
 func (h *Handler) ShowUserDocuments(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
+	filter, err := bindListFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
 	page, pageSize := utils.GetPaginationParams(c)
-	result, err := h.service.GetUserDocuments(c.Request.Context(), userID.(uint64), page, pageSize)
+
+	// keyset pagination is opted into by passing cursor, empty for the first page
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		result, err := h.service.GetUserDocumentsAfter(c.Request.Context(), userID.(uint64), cursor, pageSize, filter)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	result, err := h.service.GetUserDocuments(c.Request.Context(), userID.(uint64), page, pageSize, filter)
 	if err != nil {
 		c.Error(err)
 		return
@@ -86,8 +142,27 @@ func (h *Handler) ShowUserDocuments(c *gin.Context) {
 func (h *Handler) ShowSharedDocuments(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
+	filter, err := bindListFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
 	page, pageSize := utils.GetPaginationParams(c)
-	result, err := h.service.GetSharedDocuments(c.Request.Context(), userID.(uint64), page, pageSize)
+
+	// keyset pagination is opted into by passing cursor, empty for the first page
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		result, err := h.service.GetSharedDocumentsAfter(c.Request.Context(), userID.(uint64), cursor, pageSize, filter)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	result, err := h.service.GetSharedDocuments(c.Request.Context(), userID.(uint64), page, pageSize, filter)
 	if err != nil {
 		c.Error(err)
 		return
@@ -123,14 +198,23 @@ func (h *Handler) ShowUserRole(c *gin.Context) {
 		return
 	}
 
+	// anonymous holders of a share link come without user_id
+	var share *ShareCredentials
+	if token := c.Query("share_token"); token != "" {
+		share = &ShareCredentials{Token: token, Password: c.Query("share_password")}
+	}
+
 	userIDStr := c.Query("user_id")
-	userIDUint, err := strconv.ParseUint(userIDStr, 10, 64)
-	if err != nil {
-		c.Error(err)
-		return
+	var userIDUint uint64
+	if userIDStr != "" || share == nil {
+		userIDUint, err = strconv.ParseUint(userIDStr, 10, 64)
+		if err != nil {
+			c.Error(err)
+			return
+		}
 	}
 
-	role, err := h.service.FetchUserRole(c.Request.Context(), docIDUint, userIDUint)
+	role, err := h.service.FetchUserRole(c.Request.Context(), docIDUint, userIDUint, share)
 	if err != nil {
 		c.Error(err)
 		return
@@ -147,6 +231,51 @@ func (h *Handler) ShowDocumentState(c *gin.Context) {
 		return
 	}
 	
+	// only the updates after since_seq, for a caller with a cached state
+	if since, ok := c.GetQuery("since_seq"); ok {
+		sinceSeq, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			c.Error(errors.BadRequest("Invalid since_seq", err))
+			return
+		}
+
+		state, err := h.service.GetDocumentStateSince(c.Request.Context(), docIDUint, sinceSeq)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, state)
+		return
+	}
+
+	// paged hydration when limit or after_seq is passed, the whole state otherwise
+	_, paged := c.GetQuery("limit")
+	if _, ok := c.GetQuery("after_seq"); ok {
+		paged = true
+	}
+	if paged {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+		if err != nil || limit < 1 || limit > 1000 {
+			c.Error(errors.BadRequest("limit must be between 1 and 1000", err))
+			return
+		}
+		afterSeq, err := strconv.ParseUint(c.DefaultQuery("after_seq", "0"), 10, 64)
+		if err != nil {
+			c.Error(errors.BadRequest("Invalid after_seq", err))
+			return
+		}
+
+		page, err := h.service.GetDocumentStatePage(c.Request.Context(), docIDUint, afterSeq, limit)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, page)
+		return
+	}
+
 	doc, err := h.service.GetDocumentState(c.Request.Context(), uint64(docIDUint))
 	if err != nil {
 		c.Error(err)
@@ -156,6 +285,29 @@ func (h *Handler) ShowDocumentState(c *gin.Context) {
 	c.JSON(http.StatusOK, doc)
 }
 
+func (h *Handler) ListUpdates(c *gin.Context) {
+	docIDStr := c.Param("id")
+	docID, err := strconv.ParseUint(docIDStr, 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.Error(errors.BadRequest("limit must be between 1 and 1000", err))
+		return
+	}
+
+	page, err := h.service.ListDocumentUpdates(c.Request.Context(), docID, c.Query("cursor"), limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
 func (h *Handler) CreateUpdate(c *gin.Context) {
 	docIDStr := c.Param("id")
 	docID, err := strconv.ParseUint(docIDStr, 10, 64)
@@ -179,20 +331,65 @@ func (h *Handler) CreateUpdate(c *gin.Context) {
 		return
 	}
 
-	err = h.service.CreateDocumentUpdate(
+	seq, err := h.service.CreateDocumentUpdate(
 		c.Request.Context(),
 		docID,
 		userID,
 		updateBinary,	// raw Yjs binary
+		c.GetHeader("X-Update-Id"),	// optional, lets a retry be recognized
 	)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
+	c.Header("X-Update-Seq", strconv.FormatUint(seq, 10))
 	c.Status(http.StatusNoContent)
 }
 
+type CreateUpdatesRequest struct {
+	// base64 encoded Yjs updates, stored in this order
+	Updates [][]byte `json:"updates" binding:"required,min=1,max=1000,dive,min=1"`
+	// optional, the id of each update as X-Update-Id, "" for none
+	UpdateIDs []string `json:"update_ids" binding:"omitempty,max=1000"`
+}
+
+type CreateUpdatesResponse struct {
+	Seqs []uint64 `json:"seqs"`
+}
+
+func (h *Handler) CreateUpdates(c *gin.Context) {
+	docIDStr := c.Param("id")
+	docID, err := strconv.ParseUint(docIDStr, 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, err := strconv.ParseUint(
+		c.GetHeader("X-User-Id"),
+		10, 64,
+	)
+	if err != nil {
+		c.Error(errors.UnprocessableEntity("X-User-Id not found in header", err))
+		return
+	}
+
+	var input CreateUpdatesRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
+	seqs, err := h.service.CreateDocumentUpdates(c.Request.Context(), docID, userID, input.Updates, input.UpdateIDs)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateUpdatesResponse{Seqs: seqs})
+}
+
 func (h *Handler) CreateSnapshot(c *gin.Context) {
 	docIDStr := c.Param("id")
 	docID, err := strconv.ParseUint(docIDStr, 10, 64)
@@ -345,17 +542,676 @@ func (h *Handler) RemoveCollaborator(c *gin.Context) {
 	})
 }
 
-func (h *Handler) DeleteDocument(c *gin.Context) {
-	docIDStr := c.Param("id")
-	docID, err := strconv.ParseUint(docIDStr, 10, 64)
+type TransferOwnershipRequest struct {
+	UserID uint64 `json:"user_id" binding:"required"`
+}
+
+func (h *Handler) TransferOwnership(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	var req TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
+	requesterID, _ := c.Get("user_id")
+
+	if err := h.service.TransferOwnership(c.Request.Context(), docID, requesterID.(uint64), req.UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) CreateShareLink(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.Error(errors.NotFound("Document not found", err))
 		return
 	}
 
+	var req ShareLinkOptions
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
 	userID, _ := c.Get("user_id")
 
-	if err := h.service.DeleteDocument(c.Request.Context(), docID, userID.(uint64)); err != nil {
+	result, err := h.service.CreateShareLink(c.Request.Context(), docID, userID.(uint64), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+func (h *Handler) ListShareLinks(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.ListShareLinks(c.Request.Context(), docID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) RevokeShareLink(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	linkID, err := strconv.ParseUint(c.Param("linkId"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Share link not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if err := h.service.RevokeShareLink(c.Request.Context(), docID, userID.(uint64), linkID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ShowShareLink is public, it tells the holder of a token what the link grants
+func (h *Handler) ShowShareLink(c *gin.Context) {
+	result, err := h.service.GetShareLink(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type RedeemShareLinkRequest struct {
+	Password string `json:"password"`
+}
+
+func (h *Handler) RedeemShareLink(c *gin.Context) {
+	var req RedeemShareLinkRequest
+	// the body is optional, only password protected links need one
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(errors.NewValidationError(err))
+			return
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.RedeemShareLink(c.Request.Context(), c.Param("token"), userID.(uint64), req.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type InviteCollaboratorRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=editor viewer"`
+}
+
+func (h *Handler) InviteCollaborator(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	var req InviteCollaboratorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
+	requesterID, _ := c.Get("user_id")
+
+	result, err := h.service.InviteCollaborator(c.Request.Context(), docID, requesterID.(uint64), req.Email, req.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+func (h *Handler) ListInvitations(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.ListInvitations(c.Request.Context(), docID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) RevokeInvitation(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	invitationID, err := strconv.ParseUint(c.Param("invitationId"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Invitation not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if err := h.service.RevokeInvitation(c.Request.Context(), docID, userID.(uint64), invitationID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.AcceptInvitation(c.Request.Context(), c.Param("token"), userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) ListTeamGrants(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.ListTeamGrants(c.Request.Context(), docID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type GrantTeamRequest struct {
+	Role string `json:"role" binding:"required,oneof=editor viewer"`
+}
+
+func (h *Handler) GrantTeam(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Team not found", err))
+		return
+	}
+
+	var req GrantTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.GrantTeam(c.Request.Context(), docID, userID.(uint64), teamID, req.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) RevokeTeamGrant(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Team not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if err := h.service.RevokeTeamGrant(c.Request.Context(), docID, userID.(uint64), teamID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) DeleteDocument(c *gin.Context) {
+	docIDStr := c.Param("id")
+	docID, err := strconv.ParseUint(docIDStr, 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if err := h.service.DeleteDocument(c.Request.Context(), docID, userID.(uint64)); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type CreateVersionRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=255"`
+}
+
+func (h *Handler) CreateVersion(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	var req CreateVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.CreateDocumentVersion(c.Request.Context(), docID, userID.(uint64), req.Name)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+func (h *Handler) ListVersions(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.ListDocumentVersions(c.Request.Context(), docID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) ShowVersionState(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	versionID, err := strconv.ParseUint(c.Param("versionId"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Version not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	state, err := h.service.GetDocumentVersionState(c.Request.Context(), docID, versionID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+func (h *Handler) ShowHistoryState(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	seq, err := strconv.ParseUint(c.Param("seq"), 10, 64)
+	if err != nil {
+		c.Error(errors.BadRequest("Invalid seq", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	state, err := h.service.GetDocumentStateAt(c.Request.Context(), docID, seq, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+func (h *Handler) RestoreVersion(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	versionID, err := strconv.ParseUint(c.Param("versionId"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Version not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.RestoreDocumentVersion(c.Request.Context(), docID, versionID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) ShowContent(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	content, err := h.service.GetDocumentContent(c.Request.Context(), docID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, content)
+}
+
+func (h *Handler) Export(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	export, err := h.service.ExportDocument(c.Request.Context(), docID, userID.(uint64), c.DefaultQuery("format", "md"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, export.Filename))
+	c.Data(http.StatusOK, export.ContentType, export.Body)
+}
+
+const (
+	maxImportUploadSize = 64 << 20 // whole multipart request
+	maxImportFileSize   = 5 << 20  // one markdown file, also inside a zip
+	maxImportFiles      = 1000
+)
+
+func (h *Handler) Import(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportUploadSize)
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.Error(errors.BadRequest("Upload must be multipart form data under 64MB", err))
+		return
+	}
+
+	uploads := form.File["file"]
+	if len(uploads) == 0 {
+		c.Error(errors.BadRequest("File is required", nil))
+		return
+	}
+
+	files, err := readImportFiles(uploads)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	docs, err := h.service.ImportDocuments(c.Request.Context(), userID.(uint64), files)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, docs)
+}
+
+// readImportFiles reads uploaded .md files and the .md files inside uploaded
+// zips, skipping directories and hidden entries like __MACOSX
+func readImportFiles(uploads []*multipart.FileHeader) ([]ImportFile, error) {
+	var files []ImportFile
+
+	for _, upload := range uploads {
+		f, err := upload.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		switch ext := strings.ToLower(path.Ext(upload.Filename)); ext {
+		case ".md", ".markdown":
+			content, err := readImportContent(upload.Filename, f)
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			files = append(files, ImportFile{Name: upload.Filename, Content: content})
+		case ".zip":
+			zipped, err := readImportZip(upload.Filename, f, upload.Size)
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			files = append(files, zipped...)
+		default:
+			f.Close()
+			return nil, errors.BadRequest(fmt.Sprintf("%s is not a .md or .zip file", upload.Filename), nil)
+		}
+		f.Close()
+
+		if len(files) > maxImportFiles {
+			return nil, errors.BadRequest(fmt.Sprintf("At most %d files can be imported at once", maxImportFiles), nil)
+		}
+	}
+
+	return files, nil
+}
+
+func readImportZip(name string, f multipart.File, size int64) ([]ImportFile, error) {
+	archive, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, errors.BadRequest(fmt.Sprintf("%s is not a valid zip file", name), err)
+	}
+
+	var files []ImportFile
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || !isImportableEntry(entry.Name) {
+			continue
+		}
+
+		r, err := entry.Open()
+		if err != nil {
+			return nil, errors.BadRequest(fmt.Sprintf("%s in %s cannot be read", entry.Name, name), err)
+		}
+		content, err := readImportContent(entry.Name, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, ImportFile{Name: entry.Name, Content: content})
+
+		if len(files) > maxImportFiles {
+			return nil, errors.BadRequest(fmt.Sprintf("At most %d files can be imported at once", maxImportFiles), nil)
+		}
+	}
+
+	return files, nil
+}
+
+func isImportableEntry(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return false
+		}
+	}
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// readImportContent reads at most maxImportFileSize bytes, so a zip entry
+// cannot expand without bound
+func readImportContent(name string, r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxImportFileSize+1))
+	if err != nil {
+		return nil, errors.BadRequest(fmt.Sprintf("%s cannot be read", name), err)
+	}
+	if len(content) > maxImportFileSize {
+		return nil, errors.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("%s is larger than 5MB", name), nil)
+	}
+	return content, nil
+}
+
+func (h *Handler) Search(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.Error(errors.BadRequest("Query is required", nil))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	page, pageSize := utils.GetPaginationParams(c)
+	result, err := h.service.SearchDocuments(c.Request.Context(), userID.(uint64), query, page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) ShowSnapshotPolicy(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.GetSnapshotPolicy(c.Request.Context(), docID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) UpdateSnapshotPolicy(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	var req SnapshotPolicyDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.UpdateSnapshotPolicy(c.Request.Context(), docID, userID.(uint64), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type MoveToWorkspaceRequest struct {
+	WorkspaceID uint64 `json:"workspace_id" binding:"required"`
+}
+
+func (h *Handler) MoveToWorkspace(c *gin.Context) {
+	docID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Document not found", err))
+		return
+	}
+
+	var req MoveToWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if err := h.service.MoveToWorkspace(c.Request.Context(), docID, userID.(uint64), req.WorkspaceID); err != nil {
 		c.Error(err)
 		return
 	}
@@ -1,11 +1,14 @@
 package document
 
 import (
+	"archive/zip"
 	"bytes"
 	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
 	"collaborative-markdown-editor/internal/middleware"
 	"context"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -34,21 +37,21 @@ func (m *MockService) RenameDocument(ctx context.Context, docID uint64, userID u
 	return args.Get(0).(*domain.Document), args.Error(1)
 }
 
-func (m *MockService) CreateDocumentUpdate(ctx context.Context, id uint64, userID uint64, content []byte) error {
-	args := m.Called(ctx, id, userID, content)
-	return args.Error(0)
+func (m *MockService) CreateDocumentUpdate(ctx context.Context, id uint64, userID uint64, content []byte, updateID string) (uint64, error) {
+	args := m.Called(ctx, id, userID, content, updateID)
+	return args.Get(0).(uint64), args.Error(1)
 }
 
-func (m *MockService) GetUserDocuments(ctx context.Context, userId uint64, page, pageSize int) (*PaginatedDocuments, error) {
-	args := m.Called(ctx, userId, page, pageSize)
+func (m *MockService) GetUserDocuments(ctx context.Context, userId uint64, page, pageSize int, filter DocumentListFilter) (*PaginatedDocuments, error) {
+	args := m.Called(ctx, userId, page, pageSize, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*PaginatedDocuments), args.Error(1)
 }
 
-func (m *MockService) GetSharedDocuments(ctx context.Context, userId uint64, page, pageSize int) (*PaginatedDocuments, error) {
-	args := m.Called(ctx, userId, page, pageSize)
+func (m *MockService) GetSharedDocuments(ctx context.Context, userId uint64, page, pageSize int, filter DocumentListFilter) (*PaginatedDocuments, error) {
+	args := m.Called(ctx, userId, page, pageSize, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -76,8 +79,8 @@ func (m *MockService) CreateDocumentSnapshot(ctx context.Context, docID uint64,
 	return args.Error(0)
 }
 
-func (m *MockService) FetchUserRole(ctx context.Context, docID, userID uint64) (string, error) {
-	args := m.Called(ctx, docID, userID)
+func (m *MockService) FetchUserRole(ctx context.Context, docID, userID uint64, share *ShareCredentials) (string, error) {
+	args := m.Called(ctx, docID, userID, share)
 	return args.String(0), args.Error(1)
 }
 
@@ -115,6 +118,257 @@ func (m *MockService) DeleteDocument(ctx context.Context, docID uint64, userID u
 	return args.Error(0)
 }
 
+func (m *MockService) CreateDocumentVersion(ctx context.Context, docID uint64, userID uint64, name string) (*DocumentVersionDTO, error) {
+	args := m.Called(ctx, docID, userID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DocumentVersionDTO), args.Error(1)
+}
+
+func (m *MockService) ListDocumentVersions(ctx context.Context, docID uint64, userID uint64) ([]DocumentVersionDTO, error) {
+	args := m.Called(ctx, docID, userID)
+	if args.Get(0) == nil {
+		return []DocumentVersionDTO{}, args.Error(1)
+	}
+	return args.Get(0).([]DocumentVersionDTO), args.Error(1)
+}
+
+func (m *MockService) GetDocumentVersionState(ctx context.Context, docID uint64, versionID uint64, userID uint64) (*DocumentStateResponse, error) {
+	args := m.Called(ctx, docID, versionID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DocumentStateResponse), args.Error(1)
+}
+
+func (m *MockService) GetDocumentStateAt(ctx context.Context, docID uint64, seq uint64, userID uint64) (*DocumentStateResponse, error) {
+	args := m.Called(ctx, docID, seq, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DocumentStateResponse), args.Error(1)
+}
+
+func (m *MockService) RestoreDocumentVersion(ctx context.Context, docID uint64, versionID uint64, userID uint64) (*RestoreResponse, error) {
+	args := m.Called(ctx, docID, versionID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*RestoreResponse), args.Error(1)
+}
+
+func (m *MockService) GetDocumentContent(ctx context.Context, docID uint64, userID uint64) (*DocumentContentResponse, error) {
+	args := m.Called(ctx, docID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DocumentContentResponse), args.Error(1)
+}
+
+func (m *MockService) ExportDocument(ctx context.Context, docID uint64, userID uint64, format string) (*DocumentExport, error) {
+	args := m.Called(ctx, docID, userID, format)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DocumentExport), args.Error(1)
+}
+
+func (m *MockService) ImportDocuments(ctx context.Context, userID uint64, files []ImportFile) ([]domain.Document, error) {
+	args := m.Called(ctx, userID, files)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Document), args.Error(1)
+}
+
+func (m *MockService) SearchDocuments(ctx context.Context, userID uint64, query string, page, pageSize int) (*PaginatedSearchResults, error) {
+	args := m.Called(ctx, userID, query, page, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*PaginatedSearchResults), args.Error(1)
+}
+
+func (m *MockService) GetSnapshotPolicy(ctx context.Context, docID uint64, userID uint64) (*SnapshotPolicyResponse, error) {
+	args := m.Called(ctx, docID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*SnapshotPolicyResponse), args.Error(1)
+}
+
+func (m *MockService) UpdateSnapshotPolicy(ctx context.Context, docID uint64, userID uint64, dto SnapshotPolicyDTO) (*SnapshotPolicyResponse, error) {
+	args := m.Called(ctx, docID, userID, dto)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*SnapshotPolicyResponse), args.Error(1)
+}
+
+func (m *MockService) ScheduleSnapshots(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockService) CreateShareLink(ctx context.Context, docID uint64, userID uint64, opts ShareLinkOptions) (*ShareLinkDTO, error) {
+	args := m.Called(ctx, docID, userID, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ShareLinkDTO), args.Error(1)
+}
+
+func (m *MockService) ListShareLinks(ctx context.Context, docID uint64, userID uint64) ([]ShareLinkDTO, error) {
+	args := m.Called(ctx, docID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]ShareLinkDTO), args.Error(1)
+}
+
+func (m *MockService) RevokeShareLink(ctx context.Context, docID uint64, userID uint64, linkID uint64) error {
+	args := m.Called(ctx, docID, userID, linkID)
+	return args.Error(0)
+}
+
+func (m *MockService) GetShareLink(ctx context.Context, token string) (*ShareLinkPreview, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ShareLinkPreview), args.Error(1)
+}
+
+func (m *MockService) RedeemShareLink(ctx context.Context, token string, userID uint64, password string) (*ShareLinkRedemption, error) {
+	args := m.Called(ctx, token, userID, password)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ShareLinkRedemption), args.Error(1)
+}
+
+func (m *MockService) InviteCollaborator(ctx context.Context, docID uint64, requesterID uint64, email string, role string) (*InvitationDTO, error) {
+	args := m.Called(ctx, docID, requesterID, email, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*InvitationDTO), args.Error(1)
+}
+
+func (m *MockService) ListInvitations(ctx context.Context, docID uint64, requesterID uint64) ([]InvitationDTO, error) {
+	args := m.Called(ctx, docID, requesterID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]InvitationDTO), args.Error(1)
+}
+
+func (m *MockService) RevokeInvitation(ctx context.Context, docID uint64, requesterID uint64, invitationID uint64) error {
+	args := m.Called(ctx, docID, requesterID, invitationID)
+	return args.Error(0)
+}
+
+func (m *MockService) AcceptInvitation(ctx context.Context, token string, userID uint64) (*InvitationAcceptance, error) {
+	args := m.Called(ctx, token, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*InvitationAcceptance), args.Error(1)
+}
+
+func (m *MockService) GrantTeam(ctx context.Context, docID uint64, requesterID uint64, teamID uint64, role string) (*TeamGrantDTO, error) {
+	args := m.Called(ctx, docID, requesterID, teamID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*TeamGrantDTO), args.Error(1)
+}
+
+func (m *MockService) ListTeamGrants(ctx context.Context, docID uint64, requesterID uint64) ([]TeamGrantDTO, error) {
+	args := m.Called(ctx, docID, requesterID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]TeamGrantDTO), args.Error(1)
+}
+
+func (m *MockService) RevokeTeamGrant(ctx context.Context, docID uint64, requesterID uint64, teamID uint64) error {
+	args := m.Called(ctx, docID, requesterID, teamID)
+	return args.Error(0)
+}
+
+func (m *MockService) NotifyAccessChanged(ctx context.Context, docIDs []uint64, userIDs []uint64) {
+	m.Called(ctx, docIDs, userIDs)
+}
+
+func (m *MockService) NotifyOwnershipChanged(ctx context.Context, docIDs []uint64, userIDs []uint64) {
+	m.Called(ctx, docIDs, userIDs)
+}
+
+func (m *MockService) MoveToWorkspace(ctx context.Context, docID uint64, userID uint64, workspaceID uint64) error {
+	args := m.Called(ctx, docID, userID, workspaceID)
+	return args.Error(0)
+}
+
+func (m *MockService) TransferOwnership(ctx context.Context, docID uint64, requesterID uint64, newOwnerID uint64) error {
+	args := m.Called(ctx, docID, requesterID, newOwnerID)
+	return args.Error(0)
+}
+
+func (m *MockService) GetUserDocumentsAfter(ctx context.Context, userID uint64, cursor string, pageSize int, filter DocumentListFilter) (*CursorDocuments, error) {
+	args := m.Called(ctx, userID, cursor, pageSize, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*CursorDocuments), args.Error(1)
+}
+
+func (m *MockService) GetSharedDocumentsAfter(ctx context.Context, userID uint64, cursor string, pageSize int, filter DocumentListFilter) (*CursorDocuments, error) {
+	args := m.Called(ctx, userID, cursor, pageSize, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*CursorDocuments), args.Error(1)
+}
+
+func (m *MockService) ListDocumentUpdates(ctx context.Context, docID uint64, cursor string, limit int) (*DocumentUpdatePage, error) {
+	args := m.Called(ctx, docID, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DocumentUpdatePage), args.Error(1)
+}
+
+func (m *MockService) GetDocumentStatePage(ctx context.Context, docID uint64, afterSeq uint64, limit int) (*DocumentStateResponse, error) {
+	args := m.Called(ctx, docID, afterSeq, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DocumentStateResponse), args.Error(1)
+}
+
+func (m *MockService) StreamDocumentState(ctx context.Context, docID uint64, send func(page *DocumentStateResponse) error) error {
+	args := m.Called(ctx, docID, send)
+	return args.Error(0)
+}
+
+func (m *MockService) CreateDocumentUpdates(ctx context.Context, docID uint64, userID uint64, updates [][]byte, updateIDs []string) ([]uint64, error) {
+	args := m.Called(ctx, docID, userID, updates, updateIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+func (m *MockService) GetDocumentStateSince(ctx context.Context, docID uint64, sinceSeq uint64) (*DocumentStateResponse, error) {
+	args := m.Called(ctx, docID, sinceSeq)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DocumentStateResponse), args.Error(1)
+}
+
 func setupRouter(handler *Handler) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -186,7 +440,7 @@ func TestShowUserDocuments_WithPagination(t *testing.T) {
 		Meta: DocumentsMeta{CurrentPage: 2, TotalPage: 3, Total: 25, PerPage: 15},
 	}
 
-	mockService.On("GetUserDocuments", mock.Anything, uint64(1), 2, 15).Return(result, nil)
+	mockService.On("GetUserDocuments", mock.Anything, uint64(1), 2, 15, DocumentListFilter{}).Return(result, nil)
 
 	router.GET("/documents", func(c *gin.Context) {
 		c.Set("user_id", uint64(1))
@@ -217,7 +471,7 @@ func TestShowSharedDocuments_Success(t *testing.T) {
 		Meta: DocumentsMeta{CurrentPage: 1, TotalPage: 1, Total: 2, PerPage: 10},
 	}
 
-	mockService.On("GetSharedDocuments", mock.Anything, uint64(1), 1, 10).Return(result, nil)
+	mockService.On("GetSharedDocuments", mock.Anything, uint64(1), 1, 10, DocumentListFilter{}).Return(result, nil)
 
 	router.GET("/documents/shared", func(c *gin.Context) {
 		c.Set("user_id", uint64(1))
@@ -295,7 +549,7 @@ func TestShowUserRole_Success(t *testing.T) {
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
-	mockService.On("FetchUserRole", mock.Anything, uint64(1), uint64(2)).Return("editor", nil)
+	mockService.On("FetchUserRole", mock.Anything, uint64(1), uint64(2), (*ShareCredentials)(nil)).Return("editor", nil)
 
 	router.GET("/documents/:id/role", func(c *gin.Context) {
 		handler.ShowUserRole(c)
@@ -358,169 +612,351 @@ func TestShowDocumentState_Success(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
-// TestCreateUpdate_Success tests creating a document update
-func TestCreateUpdate_Success(t *testing.T) {
+// TestCreateUpdates_Success tests storing several updates at once
+func TestCreateUpdates_Success(t *testing.T) {
 	mockService := new(MockService)
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
-	updateBinary := []byte("test update binary")
-	mockService.On("CreateDocumentUpdate", mock.Anything, uint64(1), uint64(2), updateBinary).Return(nil)
+	mockService.On("CreateDocumentUpdates", mock.Anything, uint64(1), uint64(2), [][]byte{{0x01}, {0x02}}, []string(nil)).
+		Return([]uint64{7, 8}, nil)
 
-	router.POST("/documents/:id/updates", func(c *gin.Context) {
-		handler.CreateUpdate(c)
-	})
+	router.POST("/documents/:id/updates", handler.CreateUpdates)
 
-	req := httptest.NewRequest("POST", "/documents/1/updates", bytes.NewBuffer(updateBinary))
+	// updates are base64 encoded in JSON
+	req := httptest.NewRequest("POST", "/documents/1/updates", bytes.NewBufferString(`{"updates":["AQ==","Ag=="]}`))
+	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-User-Id", "2")
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"seqs":[7,8]}`, w.Body.String())
 	mockService.AssertExpectations(t)
 }
 
-// TestCreateUpdate_InvalidDocID tests creating update with invalid doc ID
-func TestCreateUpdate_InvalidDocID(t *testing.T) {
+// TestCreateUpdates_UpdateIDs tests that update ids are passed on for
+// deduplication
+func TestCreateUpdates_UpdateIDs(t *testing.T) {
 	mockService := new(MockService)
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
-	router.POST("/documents/:id/updates", func(c *gin.Context) {
-		handler.CreateUpdate(c)
-	})
+	mockService.On("CreateDocumentUpdates", mock.Anything, uint64(1), uint64(2), [][]byte{{0x01}, {0x02}}, []string{"a", ""}).
+		Return([]uint64{7, 8}, nil)
 
-	req := httptest.NewRequest("POST", "/documents/invalid/updates", bytes.NewBuffer([]byte("test")))
+	router.POST("/documents/:id/updates", handler.CreateUpdates)
+
+	req := httptest.NewRequest("POST", "/documents/1/updates", bytes.NewBufferString(`{"updates":["AQ==","Ag=="],"update_ids":["a",""]}`))
+	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-User-Id", "2")
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockService.AssertExpectations(t)
 }
 
-// TestCreateUpdate_InvalidUserID tests creating update with invalid user ID
-func TestCreateUpdate_InvalidUserID(t *testing.T) {
+// TestCreateUpdates_EmptyUpdate tests that empty updates are rejected
+func TestCreateUpdates_EmptyUpdate(t *testing.T) {
 	mockService := new(MockService)
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
-	router.POST("/documents/:id/updates", func(c *gin.Context) {
-		handler.CreateUpdate(c)
-	})
+	router.POST("/documents/:id/updates", handler.CreateUpdates)
 
-	req := httptest.NewRequest("POST", "/documents/1/updates", bytes.NewBuffer([]byte("test")))
-	req.Header.Set("X-User-Id", "invalid")
+	req := httptest.NewRequest("POST", "/documents/1/updates", bytes.NewBufferString(`{"updates":["AQ==",""]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-Id", "2")
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
-	// 422 for unprocessable entity (invalid user ID format)
 	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	mockService.AssertNotCalled(t, "CreateDocumentUpdates")
 }
 
-// TestCreateSnapshot_Success tests creating a document snapshot
-func TestCreateSnapshot_Success(t *testing.T) {
+// TestShowDocumentState_Since tests fetching only the updates after since_seq
+func TestShowDocumentState_Since(t *testing.T) {
 	mockService := new(MockService)
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
-	snapshotBinary := []byte("test snapshot binary")
-	mockService.On("CreateDocumentSnapshot", mock.Anything, uint64(1), snapshotBinary).Return(nil)
+	state := &DocumentStateResponse{
+		Updates: []DocumentUpdateDTO{{Seq: 43, Binary: []byte{0x00, 0x00}}},
+		NextSeq: 43,
+	}
+	mockService.On("GetDocumentStateSince", mock.Anything, uint64(1), uint64(42)).Return(state, nil)
 
-	router.POST("/documents/:id/snapshots", func(c *gin.Context) {
-		handler.CreateSnapshot(c)
-	})
+	router.GET("/documents/:id/state", handler.ShowDocumentState)
 
-	req := httptest.NewRequest("POST", "/documents/1/snapshots", bytes.NewBuffer(snapshotBinary))
+	req := httptest.NewRequest("GET", "/documents/1/state?since_seq=42", nil)
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"snapshot_required":false`)
+	mockService.AssertNotCalled(t, "GetDocumentState")
 	mockService.AssertExpectations(t)
 }
 
-// TestListCollaborators_Success tests listing document collaborators
-func TestListCollaborators_Success(t *testing.T) {
+// TestShowDocumentState_InvalidSince tests a since_seq that is not a number
+func TestShowDocumentState_InvalidSince(t *testing.T) {
 	mockService := new(MockService)
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
-	collaborators := []DocumentCollaboratorDTO{
-		{User: UserDTO{ID: 2, Name: "User 2", Email: "user2@example.com"}, Role: "editor"},
-		{User: UserDTO{ID: 3, Name: "User 3", Email: "user3@example.com"}, Role: "viewer"},
-	}
-
-	mockService.On("ListCollaborators", mock.Anything, uint64(1), uint64(1)).Return(collaborators, nil)
-
-	router.GET("/documents/:id/collaborators", func(c *gin.Context) {
-		c.Set("user_id", uint64(1))
-		handler.ListCollaborators(c)
-	})
+	router.GET("/documents/:id/state", handler.ShowDocumentState)
 
-	req := httptest.NewRequest("GET", "/documents/1/collaborators", nil)
+	req := httptest.NewRequest("GET", "/documents/1/state?since_seq=latest", nil)
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusOK, w.Code)
-	mockService.AssertExpectations(t)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockService.AssertNotCalled(t, "GetDocumentStateSince")
 }
 
-// TestAddCollaborator_Success tests adding a collaborator
-func TestAddCollaborator_Success(t *testing.T) {
+// TestShowDocumentState_Paged tests hydration in pages with after_seq and limit
+func TestShowDocumentState_Paged(t *testing.T) {
 	mockService := new(MockService)
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
-	collaborator := &DocumentCollaboratorDTO{User: UserDTO{ID: 2, Name: "User 2", Email: "user2@example.com"}, Role: "editor"}
-	mockService.On("AddCollaborator", mock.Anything, uint64(1), uint64(1), uint64(2), "editor").Return(collaborator, nil)
+	page := &DocumentStateResponse{
+		SnapshotSeq: 0,
+		Updates:     []DocumentUpdateDTO{{Seq: 101, Binary: []byte{0x00, 0x00}}},
+		HasMore:     true,
+		NextSeq:     101,
+	}
+	mockService.On("GetDocumentStatePage", mock.Anything, uint64(1), uint64(100), 1).Return(page, nil)
 
-	router.POST("/documents/:id/collaborators", func(c *gin.Context) {
-		c.Set("user_id", uint64(1))
-		handler.AddCollaborator(c)
-	})
+	router.GET("/documents/:id/state", handler.ShowDocumentState)
 
-	payload := AddCollaboratorRequest{UserID: 2, Role: "editor"}
-	body, _ := json.Marshal(payload)
-	req := httptest.NewRequest("POST", "/documents/1/collaborators", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
+	req := httptest.NewRequest("GET", "/documents/1/state?after_seq=100&limit=1", nil)
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"has_more":true`)
+	assert.Contains(t, w.Body.String(), `"next_seq":101`)
+	mockService.AssertNotCalled(t, "GetDocumentState")
 	mockService.AssertExpectations(t)
 }
 
-// TestAddCollaborator_InvalidRole tests adding collaborator with invalid role
-func TestAddCollaborator_InvalidRole(t *testing.T) {
+// TestShowDocumentState_Compacted tests the conflict returned when history was
+// compacted between two pages
+func TestShowDocumentState_Compacted(t *testing.T) {
 	mockService := new(MockService)
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
-	router.POST("/documents/:id/collaborators", func(c *gin.Context) {
-		c.Set("user_id", uint64(1))
-		handler.AddCollaborator(c)
-	})
+	mockService.On("GetDocumentStatePage", mock.Anything, uint64(1), uint64(100), 500).
+		Return(nil, errors.Conflict("Document history was compacted, restart hydration", nil))
 
-	payload := AddCollaboratorRequest{UserID: 2, Role: "invalid_role"}
-	body, _ := json.Marshal(payload)
-	req := httptest.NewRequest("POST", "/documents/1/collaborators", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
+	router.GET("/documents/:id/state", handler.ShowDocumentState)
+
+	req := httptest.NewRequest("GET", "/documents/1/state?after_seq=100", nil)
 	w := httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 
-	// 422 for validation error (invalid role)
-	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	mockService.AssertExpectations(t)
 }
 
-// TestChangeCollaboratorRole_Success tests changing collaborator role
-func TestChangeCollaboratorRole_Success(t *testing.T) {
-	mockService := new(MockService)
+// TestCreateUpdate_Success tests creating a document update
+func TestCreateUpdate_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	updateBinary := []byte("test update binary")
+	mockService.On("CreateDocumentUpdate", mock.Anything, uint64(1), uint64(2), updateBinary, "").Return(uint64(5), nil)
+
+	router.POST("/documents/:id/updates", func(c *gin.Context) {
+		handler.CreateUpdate(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/updates", bytes.NewBuffer(updateBinary))
+	req.Header.Set("X-User-Id", "2")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "5", w.Header().Get("X-Update-Seq"))
+	mockService.AssertExpectations(t)
+}
+
+// TestCreateUpdate_Retry tests that the update id is passed on and the seq
+// stored the first time is returned
+func TestCreateUpdate_Retry(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	updateBinary := []byte("test update binary")
+	mockService.On("CreateDocumentUpdate", mock.Anything, uint64(1), uint64(2), updateBinary, "a1b2").Return(uint64(3), nil)
+
+	router.POST("/documents/:id/update", handler.CreateUpdate)
+
+	req := httptest.NewRequest("POST", "/documents/1/update", bytes.NewBuffer(updateBinary))
+	req.Header.Set("X-User-Id", "2")
+	req.Header.Set("X-Update-Id", "a1b2")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-Update-Seq"))
+	mockService.AssertExpectations(t)
+}
+
+// TestCreateUpdate_InvalidDocID tests creating update with invalid doc ID
+func TestCreateUpdate_InvalidDocID(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.POST("/documents/:id/updates", func(c *gin.Context) {
+		handler.CreateUpdate(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/invalid/updates", bytes.NewBuffer([]byte("test")))
+	req.Header.Set("X-User-Id", "2")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestCreateUpdate_InvalidUserID tests creating update with invalid user ID
+func TestCreateUpdate_InvalidUserID(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.POST("/documents/:id/updates", func(c *gin.Context) {
+		handler.CreateUpdate(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/updates", bytes.NewBuffer([]byte("test")))
+	req.Header.Set("X-User-Id", "invalid")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	// 422 for unprocessable entity (invalid user ID format)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+// TestCreateSnapshot_Success tests creating a document snapshot
+func TestCreateSnapshot_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	snapshotBinary := []byte("test snapshot binary")
+	mockService.On("CreateDocumentSnapshot", mock.Anything, uint64(1), snapshotBinary).Return(nil)
+
+	router.POST("/documents/:id/snapshots", func(c *gin.Context) {
+		handler.CreateSnapshot(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/snapshots", bytes.NewBuffer(snapshotBinary))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestListCollaborators_Success tests listing document collaborators
+func TestListCollaborators_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	collaborators := []DocumentCollaboratorDTO{
+		{User: UserDTO{ID: 2, Name: "User 2", Email: "user2@example.com"}, Role: "editor"},
+		{User: UserDTO{ID: 3, Name: "User 3", Email: "user3@example.com"}, Role: "viewer"},
+	}
+
+	mockService.On("ListCollaborators", mock.Anything, uint64(1), uint64(1)).Return(collaborators, nil)
+
+	router.GET("/documents/:id/collaborators", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ListCollaborators(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/collaborators", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestAddCollaborator_Success tests adding a collaborator
+func TestAddCollaborator_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	collaborator := &DocumentCollaboratorDTO{User: UserDTO{ID: 2, Name: "User 2", Email: "user2@example.com"}, Role: "editor"}
+	mockService.On("AddCollaborator", mock.Anything, uint64(1), uint64(1), uint64(2), "editor").Return(collaborator, nil)
+
+	router.POST("/documents/:id/collaborators", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.AddCollaborator(c)
+	})
+
+	payload := AddCollaboratorRequest{UserID: 2, Role: "editor"}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", "/documents/1/collaborators", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestAddCollaborator_InvalidRole tests adding collaborator with invalid role
+func TestAddCollaborator_InvalidRole(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.POST("/documents/:id/collaborators", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.AddCollaborator(c)
+	})
+
+	payload := AddCollaboratorRequest{UserID: 2, Role: "invalid_role"}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", "/documents/1/collaborators", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	// 422 for validation error (invalid role)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+// TestChangeCollaboratorRole_Success tests changing collaborator role
+func TestChangeCollaboratorRole_Success(t *testing.T) {
+	mockService := new(MockService)
 	handler := NewHandler(mockService)
 	router := setupRouter(handler)
 
@@ -606,3 +1042,1112 @@ func TestDeleteDocument_InvalidID(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
+
+// TestCreateVersion_Success tests creating a named version
+func TestCreateVersion_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	version := &DocumentVersionDTO{ID: 1, Name: "Release v2 draft", Seq: 42, CreatedBy: UserDTO{ID: 1}}
+	mockService.On("CreateDocumentVersion", mock.Anything, uint64(1), uint64(1), "Release v2 draft").Return(version, nil)
+
+	router.POST("/documents/:id/versions", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.CreateVersion(c)
+	})
+
+	payload := CreateVersionRequest{Name: "Release v2 draft"}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", "/documents/1/versions", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response DocumentVersionDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, uint64(42), response.Seq)
+	mockService.AssertExpectations(t)
+}
+
+// TestCreateVersion_InvalidInput tests creating a version without a name
+func TestCreateVersion_InvalidInput(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.POST("/documents/:id/versions", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.CreateVersion(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/versions", bytes.NewBuffer([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+// TestListVersions_Success tests listing document versions
+func TestListVersions_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	versions := []DocumentVersionDTO{
+		{ID: 2, Name: "Sent to legal", Seq: 120},
+		{ID: 1, Name: "First draft", Seq: 10},
+	}
+	mockService.On("ListDocumentVersions", mock.Anything, uint64(1), uint64(1)).Return(versions, nil)
+
+	router.GET("/documents/:id/versions", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ListVersions(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/versions", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []DocumentVersionDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response, 2)
+	mockService.AssertExpectations(t)
+}
+
+// TestShowVersionState_Success tests fetching the state of a version
+func TestShowVersionState_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	state := &DocumentStateResponse{
+		Snapshot:    []byte("snapshot"),
+		SnapshotSeq: 100,
+		Updates:     []DocumentUpdateDTO{{Seq: 101, Binary: []byte("update")}},
+	}
+	mockService.On("GetDocumentVersionState", mock.Anything, uint64(1), uint64(3), uint64(1)).Return(state, nil)
+
+	router.GET("/documents/:id/versions/:versionId", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowVersionState(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/versions/3", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestShowVersionState_InvalidVersionID tests fetching a version with invalid ID
+func TestShowVersionState_InvalidVersionID(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.GET("/documents/:id/versions/:versionId", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowVersionState(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/versions/invalid", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestShowHistoryState_Success tests rebuilding the state at a historical seq
+func TestShowHistoryState_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	state := &DocumentStateResponse{
+		Snapshot:    []byte("snapshot"),
+		SnapshotSeq: 200,
+		Updates:     []DocumentUpdateDTO{{Seq: 201, Binary: []byte("update")}},
+	}
+	mockService.On("GetDocumentStateAt", mock.Anything, uint64(1), uint64(201), uint64(1)).Return(state, nil)
+
+	router.GET("/documents/:id/history/:seq", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowHistoryState(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/history/201", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestShowHistoryState_InvalidSeq tests rebuilding the state with invalid seq
+func TestShowHistoryState_InvalidSeq(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.GET("/documents/:id/history/:seq", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowHistoryState(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/history/latest", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestRestoreVersion_Success tests restoring a document to a version
+func TestRestoreVersion_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	result := &RestoreResponse{VersionID: 3, Seq: 251}
+	mockService.On("RestoreDocumentVersion", mock.Anything, uint64(1), uint64(3), uint64(1)).Return(result, nil)
+
+	router.POST("/documents/:id/versions/:versionId/restore", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.RestoreVersion(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/versions/3/restore", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response RestoreResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, uint64(251), response.Seq)
+	mockService.AssertExpectations(t)
+}
+
+// TestRestoreVersion_Forbidden tests restoring a version as a viewer
+func TestRestoreVersion_Forbidden(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("RestoreDocumentVersion", mock.Anything, uint64(1), uint64(3), uint64(2)).
+		Return(nil, errors.Forbidden("Only owner or editor can restore version!", nil))
+
+	router.POST("/documents/:id/versions/:versionId/restore", func(c *gin.Context) {
+		c.Set("user_id", uint64(2))
+		handler.RestoreVersion(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/versions/3/restore", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestShowContent_Success tests fetching the decoded markdown of a document
+func TestShowContent_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	content := &DocumentContentResponse{Content: "# Title", Seq: 12}
+	mockService.On("GetDocumentContent", mock.Anything, uint64(1), uint64(1)).Return(content, nil)
+
+	router.GET("/documents/:id/content", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowContent(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/content", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response DocumentContentResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "# Title", response.Content)
+	mockService.AssertExpectations(t)
+}
+
+// TestShowContent_InvalidID tests fetching content with a non numeric id
+func TestShowContent_InvalidID(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.GET("/documents/:id/content", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowContent(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/abc/content", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockService.AssertNotCalled(t, "GetDocumentContent")
+}
+
+// TestExport_DefaultsToMarkdown tests exporting without a format
+func TestExport_DefaultsToMarkdown(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	export := &DocumentExport{Filename: "Notes.md", ContentType: "text/markdown; charset=utf-8", Body: []byte("# Notes")}
+	mockService.On("ExportDocument", mock.Anything, uint64(1), uint64(1), "md").Return(export, nil)
+
+	router.GET("/documents/:id/export", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Export(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/export", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="Notes.md"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "# Notes", w.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+// TestExport_InvalidFormat tests exporting with an unsupported format
+func TestExport_InvalidFormat(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("ExportDocument", mock.Anything, uint64(1), uint64(1), "pdf").
+		Return(nil, errors.BadRequest("Format must be one of md, html or json", nil))
+
+	router.GET("/documents/:id/export", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Export(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/export?format=pdf", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// multipartFiles builds a multipart body with every file under the "file" field
+func multipartFiles(t *testing.T, files map[string][]byte) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("file", name)
+		assert.NoError(t, err)
+		part.Write(content)
+	}
+	assert.NoError(t, writer.Close())
+	return body, writer.FormDataContentType()
+}
+
+// TestImport_Success tests importing a markdown file and a zip of markdown files
+func TestImport_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	for name, content := range map[string]string{
+		"wiki/Setup.md":            "# Setup",
+		"wiki/images/logo.png":     "png",
+		"__MACOSX/wiki/._Setup.md": "junk",
+	} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+
+	body, contentType := multipartFiles(t, map[string][]byte{
+		"Home.md":  []byte("# Home"),
+		"wiki.zip": archive.Bytes(),
+	})
+
+	expectFiles := mock.MatchedBy(func(files []ImportFile) bool {
+		names := map[string]string{}
+		for _, f := range files {
+			names[f.Name] = string(f.Content)
+		}
+		return len(files) == 2 && names["Home.md"] == "# Home" && names["wiki/Setup.md"] == "# Setup"
+	})
+	docs := []domain.Document{{ID: 1, Title: "Home"}, {ID: 2, Title: "Setup"}}
+	mockService.On("ImportDocuments", mock.Anything, uint64(1), expectFiles).Return(docs, nil)
+
+	router.POST("/documents/import", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Import(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/import", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response []domain.Document
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response, 2)
+	mockService.AssertExpectations(t)
+}
+
+// TestImport_UnsupportedFile tests importing a file that is not markdown or zip
+func TestImport_UnsupportedFile(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	body, contentType := multipartFiles(t, map[string][]byte{"notes.docx": []byte("binary")})
+
+	router.POST("/documents/import", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Import(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/import", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockService.AssertNotCalled(t, "ImportDocuments")
+}
+
+// TestImport_MissingFile tests importing without any file
+func TestImport_MissingFile(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	body, contentType := multipartFiles(t, map[string][]byte{})
+
+	router.POST("/documents/import", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Import(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/import", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockService.AssertNotCalled(t, "ImportDocuments")
+}
+
+// TestSearch_Success tests searching documents
+func TestSearch_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	result := &PaginatedSearchResults{
+		Data: []DocumentSearchResult{{ID: 1, Title: "Release plan", Role: "owner", TitleRank: 0.06}},
+		Meta: DocumentsMeta{Total: 1, CurrentPage: 1, PerPage: 10, TotalPage: 1},
+	}
+	mockService.On("SearchDocuments", mock.Anything, uint64(1), "release plan", 1, 10).Return(result, nil)
+
+	router.GET("/documents/search", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Search(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/search?q=+release+plan+", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response PaginatedSearchResults
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response.Data, 1)
+	assert.Equal(t, "Release plan", response.Data[0].Title)
+	mockService.AssertExpectations(t)
+}
+
+// TestSearch_EmptyQuery tests searching without a query
+func TestSearch_EmptyQuery(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.GET("/documents/search", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Search(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/search?q=%20", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockService.AssertNotCalled(t, "SearchDocuments")
+}
+
+// TestShowSharedDocuments_WithFilter tests filtering and sorting shared documents
+func TestShowSharedDocuments_WithFilter(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	result := &PaginatedDocuments{
+		Data: []DocumentShowResponse{{ID: 3, Title: "Roadmap", Role: "viewer"}},
+		Meta: DocumentsMeta{CurrentPage: 1, TotalPage: 1, Total: 1, PerPage: 10},
+	}
+	filter := DocumentListFilter{Query: "road", Sort: "title", Order: "asc", Role: "viewer", OwnerID: 7}
+	mockService.On("GetSharedDocuments", mock.Anything, uint64(1), 1, 10, filter).Return(result, nil)
+
+	router.GET("/documents/shared", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowSharedDocuments(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/shared?q=road&sort=title&order=asc&role=viewer&owner_id=7", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestShowUserDocuments_InvalidSort tests listing with an unknown sort column
+func TestShowUserDocuments_InvalidSort(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.GET("/documents", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowUserDocuments(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents?sort=owner", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	mockService.AssertNotCalled(t, "GetUserDocuments")
+}
+
+// TestShowUserDocuments_Cursor tests that passing cursor switches to keyset pagination
+func TestShowUserDocuments_Cursor(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	result := &CursorDocuments{
+		Data:       []DocumentShowResponse{{ID: 4, Title: "Notes", Role: "owner"}},
+		NextCursor: "eyJpZCI6NH0",
+	}
+	mockService.On("GetUserDocumentsAfter", mock.Anything, uint64(1), "", 1, DocumentListFilter{}).Return(result, nil)
+
+	router.GET("/documents", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.ShowUserDocuments(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents?cursor=&per_page=1", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"next_cursor":"eyJpZCI6NH0"`)
+	mockService.AssertNotCalled(t, "GetUserDocuments")
+	mockService.AssertExpectations(t)
+}
+
+// TestListUpdates_Success tests paging through updates after the snapshot
+func TestListUpdates_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	page := &DocumentUpdatePage{
+		Updates:    []DocumentUpdateDTO{{Seq: 11, Binary: []byte{0x00, 0x00}}},
+		NextCursor: "eyJzZXEiOjExfQ",
+	}
+	mockService.On("ListDocumentUpdates", mock.Anything, uint64(1), "eyJzZXEiOjEwfQ", 1).Return(page, nil)
+
+	router.GET("/internal/documents/:id/updates", handler.ListUpdates)
+
+	req := httptest.NewRequest("GET", "/internal/documents/1/updates?cursor=eyJzZXEiOjEwfQ&limit=1", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestListUpdates_InvalidLimit tests a limit above the maximum
+func TestListUpdates_InvalidLimit(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.GET("/internal/documents/:id/updates", handler.ListUpdates)
+
+	req := httptest.NewRequest("GET", "/internal/documents/1/updates?limit=5000", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockService.AssertNotCalled(t, "ListDocumentUpdates")
+}
+
+// TestUpdateSnapshotPolicy_Success tests setting a policy override
+func TestUpdateSnapshotPolicy_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	idle := int64(300)
+	result := toSnapshotPolicyResponse(SnapshotPolicy{MaxPendingUpdates: 200}, &domain.DocumentSnapshotPolicy{IdleSeconds: &idle})
+	mockService.On("UpdateSnapshotPolicy", mock.Anything, uint64(1), uint64(1), mock.MatchedBy(func(dto SnapshotPolicyDTO) bool {
+		return dto.IdleSeconds != nil && *dto.IdleSeconds == 300 && dto.MaxPendingUpdates == nil
+	})).Return(result, nil)
+
+	router.PUT("/documents/:id/snapshot-policy", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.UpdateSnapshotPolicy(c)
+	})
+
+	req := httptest.NewRequest("PUT", "/documents/1/snapshot-policy", bytes.NewBuffer([]byte(`{"idle_seconds":300}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response SnapshotPolicyResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, int64(300), *response.Override.IdleSeconds)
+	assert.Nil(t, response.Override.MaxPendingUpdates)
+	assert.Equal(t, uint64(200), *response.Effective.MaxPendingUpdates)
+	assert.Equal(t, int64(300), *response.Effective.IdleSeconds)
+	mockService.AssertExpectations(t)
+}
+
+// TestUpdateSnapshotPolicy_InvalidInput tests a negative window
+func TestUpdateSnapshotPolicy_InvalidInput(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.PUT("/documents/:id/snapshot-policy", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.UpdateSnapshotPolicy(c)
+	})
+
+	req := httptest.NewRequest("PUT", "/documents/1/snapshot-policy", bytes.NewBuffer([]byte(`{"max_age_seconds":-1}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	mockService.AssertNotCalled(t, "UpdateSnapshotPolicy")
+}
+
+// TestShowSnapshotPolicy_Forbidden tests reading the policy without access
+func TestShowSnapshotPolicy_Forbidden(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("GetSnapshotPolicy", mock.Anything, uint64(1), uint64(2)).
+		Return(nil, errors.Forbidden("You're not collaborator", nil))
+
+	router.GET("/documents/:id/snapshot-policy", func(c *gin.Context) {
+		c.Set("user_id", uint64(2))
+		handler.ShowSnapshotPolicy(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/snapshot-policy", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestShowUserRole_ShareToken tests the permission check of an anonymous
+// share link holder
+func TestShowUserRole_ShareToken(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("FetchUserRole", mock.Anything, uint64(1), uint64(0), &ShareCredentials{Token: "abc", Password: "pw"}).Return("viewer", nil)
+
+	router.GET("/documents/:id/role", func(c *gin.Context) {
+		handler.ShowUserRole(c)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1/role?share_token=abc&share_password=pw", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "viewer", response["role"])
+	mockService.AssertExpectations(t)
+}
+
+// TestCreateShareLink_Success tests creating a share link
+func TestCreateShareLink_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	maxUses := 5
+	result := &ShareLinkDTO{ID: 1, Token: "tok", Role: "viewer", MaxUses: &maxUses, AllowAnonymous: true}
+	mockService.On("CreateShareLink", mock.Anything, uint64(1), uint64(1), mock.MatchedBy(func(opts ShareLinkOptions) bool {
+		return opts.Role == "viewer" && opts.AllowAnonymous && *opts.MaxUses == 5
+	})).Return(result, nil)
+
+	router.POST("/documents/:id/share-links", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.CreateShareLink(c)
+	})
+
+	body := []byte(`{"role":"viewer","max_uses":5,"allow_anonymous":true}`)
+	req := httptest.NewRequest("POST", "/documents/1/share-links", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response ShareLinkDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "tok", response.Token)
+	mockService.AssertExpectations(t)
+}
+
+// TestCreateShareLink_InvalidInput tests the roles a link can grant
+func TestCreateShareLink_InvalidInput(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.POST("/documents/:id/share-links", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.CreateShareLink(c)
+	})
+
+	for _, body := range []string{`{"role":"owner"}`, `{"role":"viewer","max_uses":0}`} {
+		req := httptest.NewRequest("POST", "/documents/1/share-links", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+	}
+	mockService.AssertNotCalled(t, "CreateShareLink")
+}
+
+// TestRedeemShareLink_WithoutBody tests redeeming a link without password
+func TestRedeemShareLink_WithoutBody(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("RedeemShareLink", mock.Anything, "tok", uint64(2), "").
+		Return(&ShareLinkRedemption{DocumentID: 1, Role: "editor"}, nil)
+
+	router.POST("/share-links/:token/redeem", func(c *gin.Context) {
+		c.Set("user_id", uint64(2))
+		handler.RedeemShareLink(c)
+	})
+
+	req := httptest.NewRequest("POST", "/share-links/tok/redeem", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response ShareLinkRedemption
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, uint64(1), response.DocumentID)
+	assert.Equal(t, "editor", response.Role)
+	mockService.AssertExpectations(t)
+}
+
+// TestRedeemShareLink_WrongPassword tests that a rejected password is reported
+func TestRedeemShareLink_WrongPassword(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("RedeemShareLink", mock.Anything, "tok", uint64(2), "nope").
+		Return(nil, errors.Forbidden("Invalid share link password", nil))
+
+	router.POST("/share-links/:token/redeem", func(c *gin.Context) {
+		c.Set("user_id", uint64(2))
+		handler.RedeemShareLink(c)
+	})
+
+	req := httptest.NewRequest("POST", "/share-links/tok/redeem", bytes.NewBufferString(`{"password":"nope"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestInviteCollaborator_Success tests inviting an email without account
+func TestInviteCollaborator_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	result := &InvitationDTO{ID: 1, Email: "ana@example.com", Role: "editor", InvitedBy: 1}
+	mockService.On("InviteCollaborator", mock.Anything, uint64(1), uint64(1), "ana@example.com", "editor").Return(result, nil)
+
+	router.POST("/documents/:id/invitations", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.InviteCollaborator(c)
+	})
+
+	body := []byte(`{"email":"ana@example.com","role":"editor"}`)
+	req := httptest.NewRequest("POST", "/documents/1/invitations", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response InvitationDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "ana@example.com", response.Email)
+	mockService.AssertExpectations(t)
+}
+
+// TestInviteCollaborator_InvalidInput tests the email and role validation
+func TestInviteCollaborator_InvalidInput(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.POST("/documents/:id/invitations", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.InviteCollaborator(c)
+	})
+
+	for _, body := range []string{`{"email":"not-an-email","role":"viewer"}`, `{"email":"ana@example.com","role":"owner"}`} {
+		req := httptest.NewRequest("POST", "/documents/1/invitations", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+	}
+	mockService.AssertNotCalled(t, "InviteCollaborator")
+}
+
+// TestInviteCollaborator_Registered tests that a registered email is refused
+func TestInviteCollaborator_Registered(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("InviteCollaborator", mock.Anything, uint64(1), uint64(1), "bob@example.com", "viewer").
+		Return(nil, errors.Conflict("User already registered, add them as collaborator", nil))
+
+	router.POST("/documents/:id/invitations", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.InviteCollaborator(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/invitations", bytes.NewBufferString(`{"email":"bob@example.com","role":"viewer"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestAcceptInvitation_Success tests accepting an invitation with its token
+func TestAcceptInvitation_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("AcceptInvitation", mock.Anything, "tok", uint64(2)).
+		Return(&InvitationAcceptance{DocumentID: 1, Role: "viewer"}, nil)
+
+	router.POST("/invitations/:token/accept", func(c *gin.Context) {
+		c.Set("user_id", uint64(2))
+		handler.AcceptInvitation(c)
+	})
+
+	req := httptest.NewRequest("POST", "/invitations/tok/accept", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response InvitationAcceptance
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, uint64(1), response.DocumentID)
+	mockService.AssertExpectations(t)
+}
+
+// TestGrantTeam_Success tests sharing a document with a team
+func TestGrantTeam_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	result := &TeamGrantDTO{TeamID: 3, Name: "Design", Role: "editor", MemberCount: 4}
+	mockService.On("GrantTeam", mock.Anything, uint64(1), uint64(1), uint64(3), "editor").Return(result, nil)
+
+	router.PUT("/documents/:id/teams/:teamId", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.GrantTeam(c)
+	})
+
+	req := httptest.NewRequest("PUT", "/documents/1/teams/3", bytes.NewBufferString(`{"role":"editor"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response TeamGrantDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Design", response.Name)
+	assert.Equal(t, 4, response.MemberCount)
+	mockService.AssertExpectations(t)
+}
+
+// TestGrantTeam_InvalidRole tests that a team can't be made owner
+func TestGrantTeam_InvalidRole(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.PUT("/documents/:id/teams/:teamId", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.GrantTeam(c)
+	})
+
+	req := httptest.NewRequest("PUT", "/documents/1/teams/3", bytes.NewBufferString(`{"role":"owner"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	mockService.AssertNotCalled(t, "GrantTeam")
+}
+
+// TestRevokeTeamGrant_NotOwner tests that only the owner revokes team access
+func TestRevokeTeamGrant_NotOwner(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("RevokeTeamGrant", mock.Anything, uint64(1), uint64(2), uint64(3)).
+		Return(errors.Forbidden("Only owner can revoke team access", nil))
+
+	router.DELETE("/documents/:id/teams/:teamId", func(c *gin.Context) {
+		c.Set("user_id", uint64(2))
+		handler.RevokeTeamGrant(c)
+	})
+
+	req := httptest.NewRequest("DELETE", "/documents/1/teams/3", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestCreateDocument_InWorkspace tests creating a document owned by a workspace
+func TestCreateDocument_InWorkspace(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("CreateUserDocument", mock.Anything, uint64(1), mock.MatchedBy(func(doc *domain.Document) bool {
+		return doc.WorkspaceID != nil && *doc.WorkspaceID == 4
+	})).Return(nil)
+
+	router.POST("/documents", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Create(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents", bytes.NewBufferString(`{"title":"Roadmap","workspace_id":4}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestMoveToWorkspace_Success tests moving a document into a workspace
+func TestMoveToWorkspace_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("MoveToWorkspace", mock.Anything, uint64(1), uint64(1), uint64(4)).Return(nil)
+
+	router.PUT("/documents/:id/workspace", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.MoveToWorkspace(c)
+	})
+
+	req := httptest.NewRequest("PUT", "/documents/1/workspace", bytes.NewBufferString(`{"workspace_id":4}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestMoveToWorkspace_Guest tests that guests can't add documents to a workspace
+func TestMoveToWorkspace_Guest(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("MoveToWorkspace", mock.Anything, uint64(1), uint64(1), uint64(4)).
+		Return(errors.Forbidden("Guest can't add documents to workspace", nil))
+
+	router.PUT("/documents/:id/workspace", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.MoveToWorkspace(c)
+	})
+
+	req := httptest.NewRequest("PUT", "/documents/1/workspace", bytes.NewBufferString(`{"workspace_id":4}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestTransferOwnership_Success tests handing a document over to an editor
+func TestTransferOwnership_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("TransferOwnership", mock.Anything, uint64(1), uint64(1), uint64(2)).Return(nil)
+
+	router.POST("/documents/:id/transfer", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.TransferOwnership(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/transfer", bytes.NewBufferString(`{"user_id":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestTransferOwnership_NotEditor tests that only editors can become owner
+func TestTransferOwnership_NotEditor(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	mockService.On("TransferOwnership", mock.Anything, uint64(1), uint64(1), uint64(3)).
+		Return(errors.UnprocessableEntity("New owner must be an editor", ErrNotEditor))
+
+	router.POST("/documents/:id/transfer", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.TransferOwnership(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/transfer", bytes.NewBufferString(`{"user_id":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+// TestTransferOwnership_InvalidInput tests that the new owner is required
+func TestTransferOwnership_InvalidInput(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService)
+	router := setupRouter(handler)
+
+	router.POST("/documents/:id/transfer", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.TransferOwnership(c)
+	})
+
+	req := httptest.NewRequest("POST", "/documents/1/transfer", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	mockService.AssertNotCalled(t, "TransferOwnership")
+}
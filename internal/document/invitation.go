@@ -0,0 +1,193 @@
+package document
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
+	"collaborative-markdown-editor/internal/mail"
+	"context"
+	defError "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Invitations configures email invitations of people without an account.
+// AcceptURL is the page of the frontend the token is appended to.
+type Invitations struct {
+	Mailer    mail.Mailer
+	AcceptURL string
+	Expiry    time.Duration
+}
+
+type InvitationDTO struct {
+	ID        uint64    `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy uint64    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type InvitationAcceptance struct {
+	DocumentID uint64 `json:"document_id"`
+	Role       string `json:"role"`
+}
+
+func toInvitationDTO(invitation *domain.DocumentInvitation) InvitationDTO {
+	return InvitationDTO{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		InvitedBy: invitation.InvitedBy,
+		ExpiresAt: invitation.ExpiresAt,
+		CreatedAt: invitation.CreatedAt,
+	}
+}
+
+// InviteCollaborator invites an email that has no account yet. Inviting the
+// same email again renews the invitation and sends a new email. A registered
+// email is refused, the user is added with AddCollaborator instead.
+func (s *DefaultService) InviteCollaborator(ctx context.Context, docID uint64, requesterID uint64, email string, role string) (*InvitationDTO, error) {
+	requesterRole, err := s.repository.GetUserRole(ctx, docID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if requesterRole != "owner" {
+		return nil, errors.Forbidden("Only owner can invite collaborator!", nil)
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	if _, err := s.userProvider.GetUserByEmail(ctx, email); err == nil {
+		return nil, errors.Conflict("User already registered, add them as collaborator", nil)
+	} else if !defError.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	invitation := domain.DocumentInvitation{
+		DocumentID: docID,
+		Email:      email,
+		Role:       role,
+		TokenHash:  hashToken(token),
+		InvitedBy:  requesterID,
+		ExpiresAt:  now.Add(s.invitations.Expiry),
+		CreatedAt:  now,
+	}
+	if err := s.repository.SaveInvitation(ctx, &invitation); err != nil {
+		return nil, err
+	}
+
+	s.workerPool.Submit(func(bgCtx context.Context) error {
+		return s.sendInvitation(bgCtx, invitation, token)
+	})
+
+	dto := toInvitationDTO(&invitation)
+	return &dto, nil
+}
+
+func (s *DefaultService) sendInvitation(ctx context.Context, invitation domain.DocumentInvitation, token string) error {
+	doc, err := s.repository.FindByID(ctx, invitation.DocumentID)
+	if err != nil {
+		return err
+	}
+	inviter, err := s.userProvider.GetUserByID(ctx, invitation.InvitedBy)
+	if err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("%s invited you to %q", inviter.Name, doc.Title),
+		Body: fmt.Sprintf(
+			"%s invited you to the document %q as %s.\n\n"+
+				"Create your account with this email address to get access, or open\n%s%s\n\n"+
+				"The invitation expires on %s.\n",
+			inviter.Name, doc.Title, invitation.Role,
+			s.invitations.AcceptURL, token,
+			invitation.ExpiresAt.Format("January 2, 2006"),
+		),
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := s.invitations.Mailer.Send(timeoutCtx, msg); err != nil {
+		log.Error().Err(err).Uint64("doc_id", invitation.DocumentID).Msg("failed to send invitation")
+		return err
+	}
+	return nil
+}
+
+func (s *DefaultService) ListInvitations(ctx context.Context, docID uint64, requesterID uint64) ([]InvitationDTO, error) {
+	role, err := s.repository.GetUserRole(ctx, docID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if role != "owner" {
+		return nil, errors.Forbidden("Only owner can show invitations", nil)
+	}
+
+	invitations, err := s.repository.ListInvitations(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]InvitationDTO, 0, len(invitations))
+	for i := range invitations {
+		result = append(result, toInvitationDTO(&invitations[i]))
+	}
+	return result, nil
+}
+
+func (s *DefaultService) RevokeInvitation(ctx context.Context, docID uint64, requesterID uint64, invitationID uint64) error {
+	role, err := s.repository.GetUserRole(ctx, docID, requesterID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return errors.Forbidden("Only owner can revoke invitation", nil)
+	}
+
+	if err := s.repository.DeleteInvitation(ctx, docID, invitationID); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("Invitation not found", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// AcceptInvitation lets a signed in user accept an invitation with its token,
+// e.g. when they registered with another email than the invited one
+func (s *DefaultService) AcceptInvitation(ctx context.Context, token string, userID uint64) (*InvitationAcceptance, error) {
+	var invitation domain.DocumentInvitation
+	if err := s.repository.FindInvitation(ctx, hashToken(token), &invitation); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Invitation not found", err)
+		}
+		return nil, err
+	}
+	if !invitation.ExpiresAt.After(time.Now()) {
+		return nil, errors.NotFound("Invitation has expired", nil)
+	}
+
+	role, changed, err := s.repository.AcceptInvitation(ctx, invitation.ID, userID)
+	if err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Invitation not found", err)
+		}
+		return nil, err
+	}
+
+	if changed {
+		s.NotifyAccessChanged(ctx, []uint64{invitation.DocumentID}, []uint64{userID})
+	}
+
+	return &InvitationAcceptance{DocumentID: invitation.DocumentID, Role: role}, nil
+}
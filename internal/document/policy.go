@@ -0,0 +1,133 @@
+package document
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"context"
+	"time"
+
+	log "github.com/rs/zerolog/log"
+)
+
+// SnapshotPolicy decides when a document gets a new snapshot. Any rule that
+// is met triggers it, a zero field disables its rule.
+type SnapshotPolicy struct {
+	MaxPendingUpdates uint64        // updates since the last snapshot
+	MaxPendingBytes   int64         // total raw size of those updates
+	MaxAge            time.Duration // time since the last snapshot
+	IdleAfter         time.Duration // time since the last update
+}
+
+// PendingUpdates describes the updates not covered by a snapshot yet
+type PendingUpdates struct {
+	Count          uint64
+	Bytes          int64
+	FirstUpdateAt  time.Time
+	LastUpdateAt   time.Time
+	LastSnapshotAt time.Time // zero when the document has no snapshot
+}
+
+// due reports whether pending updates should be snapshotted at now
+func (p SnapshotPolicy) due(pending PendingUpdates, now time.Time) bool {
+	if pending.Count == 0 {
+		return false
+	}
+	if p.MaxPendingUpdates > 0 && pending.Count >= p.MaxPendingUpdates {
+		return true
+	}
+	if p.MaxPendingBytes > 0 && pending.Bytes >= p.MaxPendingBytes {
+		return true
+	}
+	if p.MaxAge > 0 {
+		// without a snapshot the age counts from the first update
+		since := pending.LastSnapshotAt
+		if since.IsZero() {
+			since = pending.FirstUpdateAt
+		}
+		if now.Sub(since) >= p.MaxAge {
+			return true
+		}
+	}
+	return p.IdleAfter > 0 && now.Sub(pending.LastUpdateAt) >= p.IdleAfter
+}
+
+// withOverride applies the fields a document sets
+func (p SnapshotPolicy) withOverride(o *domain.DocumentSnapshotPolicy) SnapshotPolicy {
+	if o == nil {
+		return p
+	}
+	if o.MaxPendingUpdates != nil {
+		p.MaxPendingUpdates = *o.MaxPendingUpdates
+	}
+	if o.MaxPendingBytes != nil {
+		p.MaxPendingBytes = *o.MaxPendingBytes
+	}
+	if o.MaxAgeSeconds != nil {
+		p.MaxAge = time.Duration(*o.MaxAgeSeconds) * time.Second
+	}
+	if o.IdleSeconds != nil {
+		p.IdleAfter = time.Duration(*o.IdleSeconds) * time.Second
+	}
+	return p
+}
+
+// SnapshotPolicyDTO is a policy in its JSON form. In an override a null field
+// uses the global value.
+type SnapshotPolicyDTO struct {
+	MaxPendingUpdates *uint64 `json:"max_pending_updates"`
+	MaxPendingBytes   *int64  `json:"max_pending_bytes" binding:"omitempty,min=0"`
+	MaxAgeSeconds     *int64  `json:"max_age_seconds" binding:"omitempty,min=0"`
+	IdleSeconds       *int64  `json:"idle_seconds" binding:"omitempty,min=0"`
+}
+
+type SnapshotPolicyResponse struct {
+	Override  SnapshotPolicyDTO `json:"override"`
+	Effective SnapshotPolicyDTO `json:"effective"`
+}
+
+func toSnapshotPolicyResponse(global SnapshotPolicy, o *domain.DocumentSnapshotPolicy) *SnapshotPolicyResponse {
+	effective := global.withOverride(o)
+	maxAge := int64(effective.MaxAge / time.Second)
+	idle := int64(effective.IdleAfter / time.Second)
+
+	resp := &SnapshotPolicyResponse{
+		Effective: SnapshotPolicyDTO{
+			MaxPendingUpdates: &effective.MaxPendingUpdates,
+			MaxPendingBytes:   &effective.MaxPendingBytes,
+			MaxAgeSeconds:     &maxAge,
+			IdleSeconds:       &idle,
+		},
+	}
+	if o != nil {
+		resp.Override = SnapshotPolicyDTO{
+			MaxPendingUpdates: o.MaxPendingUpdates,
+			MaxPendingBytes:   o.MaxPendingBytes,
+			MaxAgeSeconds:     o.MaxAgeSeconds,
+			IdleSeconds:       o.IdleSeconds,
+		}
+	}
+	return resp
+}
+
+// RunSnapshotScheduler checks documents with pending updates every interval,
+// so idle and old ones get a snapshot even when no new update triggers the
+// check. It returns when ctx is done.
+func RunSnapshotScheduler(ctx context.Context, service Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := service.ScheduleSnapshots(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Snapshot scheduler failed")
+				continue
+			}
+			if n > 0 {
+				log.Info().Int("documents", n).Msg("Scheduled snapshots")
+			}
+		}
+	}
+}
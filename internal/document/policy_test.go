@@ -0,0 +1,81 @@
+package document
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSnapshotPolicy_Due tests every rule of the policy on its own
+func TestSnapshotPolicy_Due(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	policy := SnapshotPolicy{
+		MaxPendingUpdates: 200,
+		MaxPendingBytes:   1 << 20,
+		MaxAge:            24 * time.Hour,
+		IdleAfter:         10 * time.Minute,
+	}
+	recent := PendingUpdates{
+		Count:          5,
+		Bytes:          100,
+		FirstUpdateAt:  now.Add(-time.Minute),
+		LastUpdateAt:   now.Add(-time.Minute),
+		LastSnapshotAt: now.Add(-time.Hour),
+	}
+
+	tests := []struct {
+		name    string
+		pending func(p PendingUpdates) PendingUpdates
+		due     bool
+	}{
+		{"nothing reached", func(p PendingUpdates) PendingUpdates { return p }, false},
+		{"update count", func(p PendingUpdates) PendingUpdates { p.Count = 200; return p }, true},
+		{"pending bytes", func(p PendingUpdates) PendingUpdates { p.Bytes = 2 << 20; return p }, true},
+		{"snapshot age", func(p PendingUpdates) PendingUpdates { p.LastSnapshotAt = now.Add(-25 * time.Hour); return p }, true},
+		{"age without snapshot", func(p PendingUpdates) PendingUpdates {
+			p.LastSnapshotAt = time.Time{}
+			p.FirstUpdateAt = now.Add(-25 * time.Hour)
+			return p
+		}, true},
+		{"idle", func(p PendingUpdates) PendingUpdates { p.LastUpdateAt = now.Add(-11 * time.Minute); return p }, true},
+		{"no pending updates", func(p PendingUpdates) PendingUpdates {
+			return PendingUpdates{LastSnapshotAt: now.Add(-48 * time.Hour)}
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.due, policy.due(tt.pending(recent), now))
+		})
+	}
+}
+
+// TestSnapshotPolicy_Disabled tests that zero values disable their rule
+func TestSnapshotPolicy_Disabled(t *testing.T) {
+	now := time.Now()
+	pending := PendingUpdates{
+		Count:         1000,
+		Bytes:         10 << 20,
+		FirstUpdateAt: now.Add(-72 * time.Hour),
+		LastUpdateAt:  now.Add(-72 * time.Hour),
+	}
+
+	assert.False(t, SnapshotPolicy{}.due(pending, now))
+}
+
+// TestSnapshotPolicy_WithOverride tests that only set fields are overridden
+func TestSnapshotPolicy_WithOverride(t *testing.T) {
+	global := SnapshotPolicy{MaxPendingUpdates: 200, IdleAfter: 10 * time.Minute}
+	zero := uint64(0)
+	age := int64(3600)
+
+	effective := global.withOverride(&domain.DocumentSnapshotPolicy{
+		MaxPendingUpdates: &zero,
+		MaxAgeSeconds:     &age,
+	})
+
+	assert.Equal(t, SnapshotPolicy{MaxAge: time.Hour, IdleAfter: 10 * time.Minute}, effective)
+	assert.Equal(t, global, global.withOverride(nil))
+}
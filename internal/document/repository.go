@@ -1,46 +1,290 @@
 package document
 
 import (
+	"collaborative-markdown-editor/internal/blob"
+	"collaborative-markdown-editor/internal/codec"
 	"collaborative-markdown-editor/internal/domain"
 	"context"
+	defError "errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	log "github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
 type DocumentRepository interface {
 	Create(ctx context.Context, userID uint64, document *domain.Document) error
-	UpdateTitle(ctx context.Context, docID uint64, userID uint64, newTitle string) (*domain.Document, error)
-	CreateUpdate(ctx context.Context, id uint64, userID uint64, content []byte) error
-	ListDocumentByUserID(ctx context.Context, userID uint64, page, pageSize int) ([]DocumentShowResponse, DocumentsMeta, error)
-	ListSharedDocuments(ctx context.Context, userID uint64, page, pageSize int) ([]DocumentShowResponse, DocumentsMeta, error)
+	CreateImported(ctx context.Context, userID uint64, documents []domain.Document, states [][]byte, texts []string) error
+	UpdateTitle(ctx context.Context, docID uint64, newTitle string) (*domain.Document, error)
+	CreateUpdate(ctx context.Context, id uint64, userID uint64, content []byte, key string) (uint64, error)
+	CreateUpdates(ctx context.Context, docID uint64, userID uint64, contents [][]byte, keys []string) ([]uint64, error)
+	PruneUpdateKeys(ctx context.Context, cutoff time.Time) (int64, error)
+	ListDocumentByUserID(ctx context.Context, userID uint64, page, pageSize int, filter DocumentListFilter) ([]DocumentShowResponse, DocumentsMeta, error)
+	ListSharedDocuments(ctx context.Context, userID uint64, page, pageSize int, filter DocumentListFilter) ([]DocumentShowResponse, DocumentsMeta, error)
+	ListDocumentByUserIDAfter(ctx context.Context, userID uint64, cursor *DocumentCursor, limit int, filter DocumentListFilter) ([]DocumentShowResponse, error)
+	ListSharedDocumentsAfter(ctx context.Context, userID uint64, cursor *DocumentCursor, limit int, filter DocumentListFilter) ([]DocumentShowResponse, error)
 	GetUserRole(ctx context.Context, docID uint64, userID uint64) (string, error)
+	ListDocumentAccess(ctx context.Context, docID uint64) ([]documentAccessRow, error)
+	GetWorkspaceRole(ctx context.Context, workspaceID uint64, userID uint64) (string, error)
+	WorkspaceAdminIDs(ctx context.Context, workspaceID uint64) ([]uint64, error)
+	SetWorkspace(ctx context.Context, docID uint64, workspaceID uint64) error
 	FindByID(ctx context.Context, id uint64) (*domain.Document, error)
 	CurrentSeq(ctx context.Context, docID uint64, currentSeq *uint64) error
 	CreateSnapshot(ctx context.Context, docID uint64, state []byte) error
+	CreateSnapshotAt(ctx context.Context, docID uint64, seq uint64, state []byte) error
 	LastSnapshot(ctx context.Context, docID uint64, snapshot *domain.DocumentSnapshot) error
 	LastSnapshotSeq(ctx context.Context, docID uint64, lastSnapshotSeq *uint64) error
-	UpdatesFromSnapshot(ctx context.Context, docID uint64, snapshotSeq uint64, updates *[]domain.DocumentUpdate) error
+	PendingUpdates(ctx context.Context, docID uint64) (PendingUpdates, error)
+	GetSnapshotPolicy(ctx context.Context, docID uint64) (*domain.DocumentSnapshotPolicy, error)
+	SaveSnapshotPolicy(ctx context.Context, policy *domain.DocumentSnapshotPolicy) error
+	DeleteSnapshotPolicy(ctx context.Context, docID uint64) error
+	SnapshotCandidates(ctx context.Context, defaults SnapshotPolicy, now time.Time, retryAfter time.Duration, limit int) ([]uint64, error)
+	UpdatesFromSnapshot(ctx context.Context, docID uint64, afterSeq uint64, limit int, updates *[]domain.DocumentUpdate) error
 	GetCollaborator(ctx context.Context, docID uint64, userID uint64, collab *domain.DocumentCollaborator) error
 	ListDocumentCollaborators(ctx context.Context, docID uint64) ([]collaboratorRow, error)
 	AddCollaborator(ctx context.Context, docID uint64, userID uint64, role string) error
 	UpdateCollaboratorRole(ctx context.Context, docID uint64, userID uint64, role string) error
 	RemoveCollaborator(ctx context.Context, docID uint64, userID uint64) error
+	TransferOwnership(ctx context.Context, docID uint64, ownerID uint64, newOwnerID uint64) error
+	CreateShareLink(ctx context.Context, link *domain.DocumentShareLink) error
+	ListShareLinks(ctx context.Context, docID uint64) ([]domain.DocumentShareLink, error)
+	FindShareLink(ctx context.Context, tokenHash string, link *domain.DocumentShareLink) error
+	DeleteShareLink(ctx context.Context, docID uint64, linkID uint64) error
+	RedeemShareLink(ctx context.Context, linkID uint64, userID uint64) (string, bool, error)
+	SaveInvitation(ctx context.Context, invitation *domain.DocumentInvitation) error
+	ListInvitations(ctx context.Context, docID uint64) ([]domain.DocumentInvitation, error)
+	FindInvitation(ctx context.Context, tokenHash string, invitation *domain.DocumentInvitation) error
+	DeleteInvitation(ctx context.Context, docID uint64, invitationID uint64) error
+	AcceptInvitation(ctx context.Context, invitationID uint64, userID uint64) (string, bool, error)
+	ClaimInvitations(ctx context.Context, userID uint64, email string) (int, error)
+	IsTeamMember(ctx context.Context, teamID uint64, userID uint64) (bool, error)
+	TeamMemberIDs(ctx context.Context, teamID uint64) ([]uint64, error)
+	SaveTeamGrant(ctx context.Context, grant *domain.DocumentTeamGrant) error
+	ListTeamGrants(ctx context.Context, docID uint64) ([]teamGrantRow, error)
+	DeleteTeamGrant(ctx context.Context, docID uint64, teamID uint64) error
+	EffectiveRoles(ctx context.Context, docIDs []uint64, userIDs []uint64) ([]userRoleRow, error)
 	DeleteDocument(ctx context.Context, docID uint64) error
+	CreateVersion(ctx context.Context, version *domain.DocumentVersion) error
+	ListVersions(ctx context.Context, docID uint64) ([]versionRow, error)
+	FindVersion(ctx context.Context, docID uint64, versionID uint64, version *domain.DocumentVersion) error
+	SnapshotAtSeq(ctx context.Context, docID uint64, seq uint64, snapshot *domain.DocumentSnapshot) error
+	UpdatesInRange(ctx context.Context, docID uint64, fromSeq uint64, toSeq uint64, updates *[]domain.DocumentUpdate) error
+	RestoreState(ctx context.Context, docID uint64, snapshot []byte, updates []domain.DocumentUpdate) (uint64, error)
+	UpdateSearchContent(ctx context.Context, docID uint64, content string) error
+	SearchDocuments(ctx context.Context, userID uint64, query string, page, pageSize int) ([]DocumentSearchResult, DocumentsMeta, error)
+	CompressLegacyRows(ctx context.Context, limit int) (int, error)
+	VerifyDocument(ctx context.Context, docID uint64) ([]BinaryIssue, int, error)
+}
+
+// HistoryRetention controls how much history is kept when a snapshot is created.
+// With both limits at zero every snapshot compacts the updates before it.
+type HistoryRetention struct {
+	MaxSnapshots int           // keep at most this many snapshots (0 = no count limit)
+	MaxAge       time.Duration // keep snapshots younger than this (0 = no age limit)
+}
+
+func (h HistoryRetention) enabled() bool {
+	return h.MaxSnapshots > 0 || h.MaxAge > 0
+}
+
+// BlobOffload moves snapshot and update binaries larger than Threshold bytes
+// to Store, the row then keeps only the blob key and checksum. Store is also
+// needed to read rows offloaded before, even with a zero Threshold.
+type BlobOffload struct {
+	Store     blob.BlobStore
+	Threshold int
+}
+
+// Compression of the binaries written, see internal/codec. Binaries shorter
+// than MinSize are stored raw. Rows are read with the codec they were written
+// with, so Codec can be changed at any time.
+type Compression struct {
+	Codec   string
+	MinSize int
 }
 
 type DocumentRepositoryImpl struct {
-	db *gorm.DB
+	db          *gorm.DB
+	retention   HistoryRetention
+	blobs       BlobOffload
+	compression Compression
 }
 
 // NewRepository creates a new user repository
-func NewRepository(db *gorm.DB) DocumentRepository {
-	return &DocumentRepositoryImpl{db: db}
+func NewRepository(db *gorm.DB, retention HistoryRetention, blobs BlobOffload, compression Compression) DocumentRepository {
+	return &DocumentRepositoryImpl{db: db, retention: retention, blobs: blobs, compression: compression}
+}
+
+// ErrCorruptBinary is returned when a stored snapshot or update does not match
+// its checksum, or can't be decompressed
+var ErrCorruptBinary = defError.New("stored binary is corrupt")
+
+// storedBinary is a binary as written to its row: compressed with codec,
+// offloaded when blobKey is set (data is then empty), and checksum is the
+// SHA-256 of the bytes as stored
+type storedBinary struct {
+	data     []byte
+	codec    string
+	blobKey  *string
+	checksum string
+}
+
+// storeBinary compresses raw and offloads the result when it is still large
+func (r *DocumentRepositoryImpl) storeBinary(ctx context.Context, docID uint64, kind string, raw []byte) (storedBinary, error) {
+	data, used := raw, codec.None
+	if len(raw) >= r.compression.MinSize {
+		var err error
+		data, used, err = codec.Compress(r.compression.Codec, raw)
+		if err != nil {
+			return storedBinary{}, err
+		}
+	}
+
+	bin := storedBinary{data: data, codec: used, checksum: blob.Checksum(data)}
+	key, err := r.offload(ctx, docID, kind, data)
+	if err != nil {
+		return storedBinary{}, err
+	}
+	if key != "" {
+		bin.data = []byte{}
+		bin.blobKey = &key
+	}
+	return bin, nil
+}
+
+// offload stores data in the blob store when it is over the threshold, under
+// a new key so a row that is never written can't clash with another one. It
+// returns "" when data stays inline.
+func (r *DocumentRepositoryImpl) offload(ctx context.Context, docID uint64, kind string, data []byte) (string, error) {
+	if r.blobs.Store == nil || r.blobs.Threshold <= 0 || len(data) <= r.blobs.Threshold {
+		return "", nil
+	}
+
+	key := fmt.Sprintf("documents/%d/%s/%s", docID, kind, uuid.NewString())
+	if err := r.blobs.Store.Put(ctx, key, data); err != nil {
+		return "", fmt.Errorf("offload %s of document %d: %w", kind, docID, err)
+	}
+	return key, nil
+}
+
+// discardBlobs deletes blobs no row refers to anymore. Failures are only
+// logged, a leftover blob takes space but is never read.
+func (r *DocumentRepositoryImpl) discardBlobs(ctx context.Context, keys []string) {
+	if r.blobs.Store == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := r.blobs.Store.Delete(ctx, key); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("failed to delete blob")
+		}
+	}
+}
+
+// loadBinary returns the raw bytes of a row's binary: read from the blob store
+// when it was offloaded, checked against the checksum and decompressed. Rows
+// written before checksums existed have none and are not checked.
+func (r *DocumentRepositoryImpl) loadBinary(ctx context.Context, data []byte, blobKey *string, checksum string, rowCodec string) ([]byte, error) {
+	if blobKey != nil {
+		if r.blobs.Store == nil {
+			return nil, fmt.Errorf("blob %s: no blob store configured", *blobKey)
+		}
+		var err error
+		if data, err = r.blobs.Store.Get(ctx, *blobKey); err != nil {
+			return nil, fmt.Errorf("blob %s: %w", *blobKey, err)
+		}
+	}
+
+	if checksum != "" && blob.Checksum(data) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptBinary)
+	}
+	raw, err := codec.Decompress(rowCodec, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBinary, err)
+	}
+	return raw, nil
+}
+
+func (r *DocumentRepositoryImpl) loadSnapshotBinary(ctx context.Context, snapshot *domain.DocumentSnapshot) error {
+	data, err := r.loadBinary(ctx, snapshot.SnapshotBinary, snapshot.BlobKey, snapshot.Checksum, snapshot.Codec)
+	if err != nil {
+		return fmt.Errorf("snapshot %d of document %d: %w", snapshot.Seq, snapshot.DocumentID, err)
+	}
+	snapshot.SnapshotBinary = data
+	return nil
+}
+
+func (r *DocumentRepositoryImpl) loadUpdateBinaries(ctx context.Context, updates []domain.DocumentUpdate) error {
+	for i := range updates {
+		u := &updates[i]
+		data, err := r.loadBinary(ctx, u.UpdateBinary, u.BlobKey, u.Checksum, u.Codec)
+		if err != nil {
+			return fmt.Errorf("update %d of document %d: %w", u.Seq, u.DocumentID, err)
+		}
+		u.UpdateBinary = data
+	}
+	return nil
+}
+
+// newSnapshotRow builds the row of a snapshot, compressed and offloaded as
+// configured
+func (r *DocumentRepositoryImpl) newSnapshotRow(ctx context.Context, docID uint64, state []byte) (domain.DocumentSnapshot, error) {
+	bin, err := r.storeBinary(ctx, docID, "snapshots", state)
+	if err != nil {
+		return domain.DocumentSnapshot{}, err
+	}
+	return domain.DocumentSnapshot{
+		DocumentID:     docID,
+		SnapshotBinary: bin.data,
+		BlobKey:        bin.blobKey,
+		Checksum:       bin.checksum,
+		Codec:          bin.codec,
+	}, nil
+}
+
+// storeUpdates prepares the binaries of several updates
+func (r *DocumentRepositoryImpl) storeUpdates(ctx context.Context, docID uint64, contents [][]byte) ([]storedBinary, error) {
+	bins := make([]storedBinary, len(contents))
+	for i, content := range contents {
+		bin, err := r.storeBinary(ctx, docID, "updates", content)
+		if err != nil {
+			r.discardBlobs(ctx, blobKeys(bins, nil))
+			return nil, err
+		}
+		bins[i] = bin
+	}
+	return bins, nil
+}
+
+// blobKeys lists the offloaded blobs of the binaries whose position is not kept
+func blobKeys(bins []storedBinary, kept []bool) []string {
+	var keys []string
+	for i, bin := range bins {
+		if bin.blobKey != nil && (kept == nil || !kept[i]) {
+			keys = append(keys, *bin.blobKey)
+		}
+	}
+	return keys
+}
+
+func setUpdateBinary(update *domain.DocumentUpdate, bin storedBinary) {
+	update.UpdateBinary = bin.data
+	update.BlobKey = bin.blobKey
+	update.Checksum = bin.checksum
+	update.Codec = bin.codec
 }
 
 // Create creates a new user
 func (r *DocumentRepositoryImpl) Create(ctx context.Context, userID uint64, document *domain.Document) error {
+	setOwner(document, userID)
+	return r.db.WithContext(ctx).Create(document).Error
+}
+
+func setOwner(document *domain.Document, userID uint64) {
 	document.UserID = userID
 	document.CreatedAt = time.Now().UTC() // Use UTC for consistency
 	document.UpdatedAt = time.Now().UTC()
@@ -51,16 +295,70 @@ func (r *DocumentRepositoryImpl) Create(ctx context.Context, userID uint64, docu
 			AddedAt: time.Now().UTC(),
 		},
 	}
-	return r.db.WithContext(ctx).Create(document).Error
 }
 
-func (r *DocumentRepositoryImpl) UpdateTitle(ctx context.Context, docID uint64, userID uint64, newTitle string) (*domain.Document, error) {
+// CreateImported creates documents of userID, each seeded with a snapshot of
+// its state and the search content of its text. Either all of them are
+// created or none is.
+func (r *DocumentRepositoryImpl) CreateImported(ctx context.Context, userID uint64, documents []domain.Document, states [][]byte, texts []string) error {
+	// the blob keys need the ids of the documents, reserving them lets the
+	// snapshots be offloaded before the transaction like the other binaries
+	var ids []uint64
+	if err := r.db.WithContext(ctx).Raw(
+		`SELECT nextval(pg_get_serial_sequence('documents', 'id')) FROM generate_series(1, ?)`,
+		len(documents),
+	).Scan(&ids).Error; err != nil {
+		return err
+	}
+	if len(ids) != len(documents) {
+		return fmt.Errorf("reserved %d document ids for %d documents", len(ids), len(documents))
+	}
+
+	snapshots := make([]domain.DocumentSnapshot, len(documents))
+	var offloaded []string
+	for i := range documents {
+		snapshot, err := r.newSnapshotRow(ctx, ids[i], states[i])
+		if err != nil {
+			r.discardBlobs(ctx, offloaded)
+			return err
+		}
+		if snapshot.BlobKey != nil {
+			offloaded = append(offloaded, *snapshot.BlobKey)
+		}
+		snapshots[i] = snapshot
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range documents {
+			setOwner(&documents[i], userID)
+			documents[i].ID = ids[i]
+			if err := tx.Create(&documents[i]).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&snapshots[i]).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Exec(`UPDATE documents SET content_tsv = to_tsvector('simple', ?) WHERE id = ?`,
+				texts[i], documents[i].ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.discardBlobs(ctx, offloaded)
+	}
+	return err
+}
+
+func (r *DocumentRepositoryImpl) UpdateTitle(ctx context.Context, docID uint64, newTitle string) (*domain.Document, error) {
 	var doc domain.Document
 
 	result := r.db.WithContext(ctx).
 		Model(&doc).
 		Clauses(clause.Returning{}). // tells Postgres to return the updated row
-		Where("id = ? AND user_id = ?", docID, userID).
+		Where("id = ?", docID).
 		Update("title", newTitle)
 
 	if result.Error != nil {
@@ -80,63 +378,176 @@ type DocumentsMeta struct {
 	TotalPage   int   `json:"total_page"`
 }
 
-func (r *DocumentRepositoryImpl) ListDocumentByUserID(ctx context.Context, userID uint64, page, pageSize int) ([]DocumentShowResponse, DocumentsMeta, error) {
-	var docs []DocumentShowResponse
-	var totalRecords int64
+// DocumentListFilter narrows and orders the document listings. Role and
+// OwnerID only apply to shared documents.
+type DocumentListFilter struct {
+	Query       string // case-insensitive title substring
+	Sort        string // title, created_at or updated_at (default)
+	Order       string // asc or desc, defaults to asc for title and desc otherwise
+	Role        string // editor or viewer
+	OwnerID     uint64
+	WorkspaceID uint64 // documents owned by this workspace
+}
+
+var listSortColumns = map[string]string{
+	"title":      "documents.title",
+	"created_at": "documents.created_at",
+	"updated_at": "documents.updated_at",
+}
+
+// sorting resolves the defaults of Sort and Order
+func (f DocumentListFilter) sorting() (sort string, order string) {
+	sort = f.Sort
+	if _, ok := listSortColumns[sort]; !ok {
+		sort = "updated_at"
+	}
+
+	order = strings.ToLower(f.Order)
+	if order != "asc" && order != "desc" {
+		order = "desc"
+		if sort == "title" {
+			order = "asc"
+		}
+	}
+	return sort, order
+}
 
+// orderBy returns the ORDER BY clause, with the id as tie breaker so pages
+// stay stable when the sort column has duplicates
+func (f DocumentListFilter) orderBy() string {
+	sort, order := f.sorting()
+	return fmt.Sprintf("%s %s, documents.id %s", listSortColumns[sort], order, order)
+}
+
+// DocumentCursor is the position of the last row of a keyset page: its sort
+// column value and id
+type DocumentCursor struct {
+	Value string
+	ID    uint64
+}
+
+// applyCursor keeps the rows after cursor in the filter's order
+func applyCursor(query *gorm.DB, filter DocumentListFilter, cursor *DocumentCursor) *gorm.DB {
+	if cursor == nil {
+		return query
+	}
+
+	sort, order := filter.sorting()
+	op := "<"
+	if order == "asc" {
+		op = ">"
+	}
+	value := "?"
+	if sort != "title" {
+		value = "?::timestamptz"
+	}
+	return query.Where(fmt.Sprintf("(%s, documents.id) %s (%s, ?)", listSortColumns[sort], op, value), cursor.Value, cursor.ID)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// applyListFilter applies the filters common to all listings
+func applyListFilter(query *gorm.DB, filter DocumentListFilter) *gorm.DB {
+	if filter.WorkspaceID != 0 {
+		query = query.Where("documents.workspace_id = ?", filter.WorkspaceID)
+	}
+	if filter.Query == "" {
+		return query
+	}
+	return query.Where("documents.title ILIKE ?", "%"+likeEscaper.Replace(filter.Query)+"%")
+}
+
+func (r *DocumentRepositoryImpl) ownedDocuments(ctx context.Context, userID uint64, filter DocumentListFilter) *gorm.DB {
 	data := r.db.WithContext(ctx).Table("documents").
 		Select(`
 				documents.id,
 				documents.title,
+				documents.created_at,
 				documents.updated_at,
-				'owner' as role,
+				access.role,
             	users.name as owner_name,
-				documents.user_id as owner_id
+				documents.user_id as owner_id,
+				documents.workspace_id
 			`).
+		// the admins of a workspace can demote or remove the creator
+		Joins(userAccessSQL, userID).
 		Joins("LEFT JOIN users ON users.id = documents.user_id").
 		Where("documents.user_id = ?", userID)
+	return applyListFilter(data, filter)
+}
 
-	// Count total records
-	if err := data.Count(&totalRecords).Error; err != nil {
-		return docs, DocumentsMeta{}, err
-	}
+// accessGrantsSQL selects every (document_id, user_id, role) grant: direct
+// ones, those given to the teams of the user and the owner rights of admins
+// of the workspace owning the document
+const accessGrantsSQL = `(
+	SELECT document_id, user_id, role FROM document_collaborators
+	UNION ALL
+	SELECT document_team_grants.document_id, team_members.user_id, document_team_grants.role
+	FROM document_team_grants
+	JOIN team_members ON team_members.team_id = document_team_grants.team_id
+	UNION ALL
+	SELECT documents.id, workspace_members.user_id, 'owner'
+	FROM documents
+	JOIN workspace_members ON workspace_members.workspace_id = documents.workspace_id
+	WHERE workspace_members.role = 'admin'
+) AS grants`
 
-	offset := (page - 1) * pageSize
-	err := data.Offset(offset).
-		Limit(pageSize).
-		Order("documents.updated_at DESC").
-		Find(&docs).Error
-	if err != nil {
-		return docs, DocumentsMeta{}, err
-	}
+// roleRankSQL orders roles so the highest grant of a user can be picked
+const roleRankSQL = `CASE grants.role WHEN 'owner' THEN 3 WHEN 'editor' THEN 2 WHEN 'viewer' THEN 1 ELSE 0 END`
 
-	totalPages := int((totalRecords + int64(pageSize) - 1) / int64(pageSize))
+// roleRanks orders roles like roleRankSQL, for grants resolved in Go
+var roleRanks = map[string]int{"viewer": 1, "editor": 2, "owner": 3}
 
-	return docs, DocumentsMeta{
-		Total:       totalRecords,
-		PerPage:     pageSize,
-		TotalPage:   totalPages,
-		CurrentPage: page,
-	}, err
+// higherRole returns the higher of two roles, unknown roles and "none" rank
+// below every role
+func higherRole(a string, b string) string {
+	if roleRanks[b] > roleRanks[a] {
+		return b
+	}
+	return a
 }
 
-func (r *DocumentRepositoryImpl) ListSharedDocuments(ctx context.Context, userID uint64, page, pageSize int) ([]DocumentShowResponse, DocumentsMeta, error) {
-	var docs []DocumentShowResponse
-	var totalRecords int64
+// highestRoleSQL is the highest role of grouped grants
+const highestRoleSQL = `(ARRAY['viewer', 'editor', 'owner'])[MAX(` + roleRankSQL + `)]`
+
+// userAccessSQL joins the role of a user on the documents they can open as
+// access.role
+const userAccessSQL = `JOIN (
+	SELECT grants.document_id, ` + highestRoleSQL + ` AS role
+	FROM ` + accessGrantsSQL + `
+	WHERE grants.user_id = ?
+	GROUP BY grants.document_id
+) AS access ON access.document_id = documents.id`
 
+func (r *DocumentRepositoryImpl) sharedDocuments(ctx context.Context, userID uint64, filter DocumentListFilter) *gorm.DB {
 	data := r.db.WithContext(ctx).Table("documents").
 		Select(`
 				documents.id,
 				documents.title,
-				document_collaborators.role,
+				access.role,
+				documents.created_at,
 				documents.updated_at,
 				users.name as owner_name,
-				documents.user_id as owner_id
+				documents.user_id as owner_id,
+				documents.workspace_id
 			`).
-		Joins(`JOIN document_collaborators ON document_collaborators.document_id = documents.id`).
+		Joins(userAccessSQL, userID).
 		Joins("JOIN users ON users.id = documents.user_id").
-		Where("document_collaborators.user_id = ?", userID).
 		Where("documents.user_id != ?", userID) // except own document
+	data = applyListFilter(data, filter)
+	if filter.Role != "" {
+		data = data.Where("access.role = ?", filter.Role)
+	}
+	if filter.OwnerID != 0 {
+		data = data.Where("documents.user_id = ?", filter.OwnerID)
+	}
+	return data
+}
+
+// paginate runs an offset page of a listing query
+func paginate(data *gorm.DB, page, pageSize int, filter DocumentListFilter) ([]DocumentShowResponse, DocumentsMeta, error) {
+	var docs []DocumentShowResponse
+	var totalRecords int64
 
 	// Count total records
 	if err := data.Count(&totalRecords).Error; err != nil {
@@ -146,7 +557,7 @@ func (r *DocumentRepositoryImpl) ListSharedDocuments(ctx context.Context, userID
 	offset := (page - 1) * pageSize
 	err := data.Offset(offset).
 		Limit(pageSize).
-		Order("documents.updated_at DESC").
+		Order(filter.orderBy()).
 		Find(&docs).Error
 	if err != nil {
 		return docs, DocumentsMeta{}, err
@@ -162,16 +573,88 @@ func (r *DocumentRepositoryImpl) ListSharedDocuments(ctx context.Context, userID
 	}, err
 }
 
+func (r *DocumentRepositoryImpl) ListDocumentByUserID(ctx context.Context, userID uint64, page, pageSize int, filter DocumentListFilter) ([]DocumentShowResponse, DocumentsMeta, error) {
+	return paginate(r.ownedDocuments(ctx, userID, filter), page, pageSize, filter)
+}
+
+func (r *DocumentRepositoryImpl) ListSharedDocuments(ctx context.Context, userID uint64, page, pageSize int, filter DocumentListFilter) ([]DocumentShowResponse, DocumentsMeta, error) {
+	return paginate(r.sharedDocuments(ctx, userID, filter), page, pageSize, filter)
+}
+
+// ListDocumentByUserIDAfter returns up to limit owned documents after cursor,
+// without counting the total
+func (r *DocumentRepositoryImpl) ListDocumentByUserIDAfter(ctx context.Context, userID uint64, cursor *DocumentCursor, limit int, filter DocumentListFilter) ([]DocumentShowResponse, error) {
+	var docs []DocumentShowResponse
+	err := applyCursor(r.ownedDocuments(ctx, userID, filter), filter, cursor).
+		Order(filter.orderBy()).
+		Limit(limit).
+		Find(&docs).Error
+	return docs, err
+}
+
+// ListSharedDocumentsAfter returns up to limit shared documents after cursor,
+// without counting the total
+func (r *DocumentRepositoryImpl) ListSharedDocumentsAfter(ctx context.Context, userID uint64, cursor *DocumentCursor, limit int, filter DocumentListFilter) ([]DocumentShowResponse, error) {
+	var docs []DocumentShowResponse
+	err := applyCursor(r.sharedDocuments(ctx, userID, filter), filter, cursor).
+		Order(filter.orderBy()).
+		Limit(limit).
+		Find(&docs).Error
+	return docs, err
+}
+
 func (r *DocumentRepositoryImpl) FindByID(ctx context.Context, id uint64) (*domain.Document, error) {
 	var doc domain.Document
 	err := r.db.WithContext(ctx).First(&doc, id).Error
 	return &doc, err
 }
 
+// GetUserRole returns the highest role of userID on a document, from their
+// direct role, the roles granted to their teams and the owner rights of the
+// admins of the workspace owning it, "none" without access
 func (r *DocumentRepositoryImpl) GetUserRole(ctx context.Context, docID uint64, userID uint64) (string, error) {
+	var grants []string
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT grants.role FROM `+accessGrantsSQL+`
+		WHERE grants.document_id = ? AND grants.user_id = ?
+	`, docID, userID).Scan(&grants).Error
+	if err != nil {
+		return "none", err
+	}
+
+	role := "none"
+	for _, grant := range grants {
+		role = higherRole(role, grant)
+	}
+	return role, nil
+}
+
+type documentAccessRow struct {
+	UserID  uint64
+	Role    string
+	IsOwner bool // the document is in the owned documents of the user
+}
+
+// ListDocumentAccess returns everyone who can open a document with their
+// role, to invalidate their document listings
+func (r *DocumentRepositoryImpl) ListDocumentAccess(ctx context.Context, docID uint64) ([]documentAccessRow, error) {
+	var rows []documentAccessRow
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT grants.user_id, `+highestRoleSQL+` AS role, grants.user_id = documents.user_id AS is_owner
+		FROM `+accessGrantsSQL+`
+		JOIN documents ON documents.id = grants.document_id
+		WHERE grants.document_id = ?
+		GROUP BY grants.user_id, documents.user_id
+	`, docID).Scan(&rows).Error
+	return rows, err
+}
+
+// GetWorkspaceRole returns the role of userID in a workspace, "none" when they
+// are not a member
+func (r *DocumentRepositoryImpl) GetWorkspaceRole(ctx context.Context, workspaceID uint64, userID uint64) (string, error) {
 	var role string
-	err := r.db.WithContext(ctx).Model(&domain.DocumentCollaborator{}).
-		Where("document_id = ? AND user_id = ?", docID, userID).
+	err := r.db.WithContext(ctx).Model(&domain.WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
 		Select("role").
 		Scan(&role).Error
 	if err != nil || role == "" {
@@ -181,41 +664,211 @@ func (r *DocumentRepositoryImpl) GetUserRole(ctx context.Context, docID uint64,
 	return role, nil
 }
 
-func (r *DocumentRepositoryImpl) CreateUpdate(ctx context.Context, id uint64, userID uint64, content []byte) error {
-	var seq uint64
+func (r *DocumentRepositoryImpl) WorkspaceAdminIDs(ctx context.Context, workspaceID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Model(&domain.WorkspaceMember{}).
+		Where("workspace_id = ? AND role = ?", workspaceID, "admin").
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// SetWorkspace makes a workspace the owner of a document
+func (r *DocumentRepositoryImpl) SetWorkspace(ctx context.Context, docID uint64, workspaceID uint64) error {
+	result := r.db.WithContext(ctx).
+		Model(&domain.Document{}).
+		Where("id = ?", docID).
+		Update("workspace_id", workspaceID)
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *DocumentRepositoryImpl) CreateUpdate(ctx context.Context, id uint64, userID uint64, content []byte, key string) (uint64, error) {
+	seqs, err := r.CreateUpdates(ctx, id, userID, [][]byte{content}, []string{key})
+	if err != nil {
+		return 0, err
+	}
+	return seqs[0], nil
+}
+
+// CreateUpdates stores contents in order under one range of seqs, reserved
+// with a single UPDATE so the documents row is locked once per batch. It
+// returns the seq given to each content.
+//
+// keys, when not empty, holds one key per content ("" for none) and
+// deduplicates retries: a content whose key is already stored for the
+// document, or repeated in the batch, gets the existing seq and is not stored
+// again. Duplicates are filtered before seqs are reserved, so
+// seqs stay contiguous. Keys are kept in document_update_keys, which snapshot
+// compaction leaves alone, until PruneUpdateKeys removes them.
+//
+// Large contents are offloaded before the transaction, so the document is not
+// locked while they are uploaded.
+func (r *DocumentRepositoryImpl) CreateUpdates(ctx context.Context, docID uint64, userID uint64, contents [][]byte, keys []string) ([]uint64, error) {
+	if len(contents) == 0 {
+		return nil, nil
+	}
+	if len(keys) == 0 {
+		keys = make([]string, len(contents))
+	} else if len(keys) != len(contents) {
+		return nil, fmt.Errorf("got %d update keys for %d updates", len(keys), len(contents))
+	}
+
+	bins, err := r.storeUpdates(ctx, docID, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs := make([]uint64, len(contents))
+	stored := make([]bool, len(contents))
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// lock the document first, a concurrent retry waits here and then
+		// finds the key stored
+		var exists bool
+		if err := tx.Raw("SELECT true FROM documents WHERE id = ? FOR UPDATE", docID).
+			Scan(&exists).Error; err != nil {
+			return err
+		}
+		if !exists {
+			return gorm.ErrRecordNotFound
+		}
+
+		existing, err := storedUpdateKeys(tx, docID, keys)
+		if err != nil {
+			return err
+		}
+
+		// positions of the contents to store, and of the first one of each key
+		var fresh []int
+		first := make(map[string]int)
+		for i, key := range keys {
+			if key == "" {
+				fresh = append(fresh, i)
+				continue
+			}
+			if seq, ok := existing[key]; ok {
+				seqs[i] = seq
+				continue
+			}
+			if _, ok := first[key]; ok {
+				// repeated in the batch, gets the seq of the first one below
+				continue
+			}
+			first[key] = i
+			fresh = append(fresh, i)
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
 
-	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		now := time.Now().UTC()
-		// increment sequence on document
+		var lastSeq uint64
 		if err := tx.Raw(`
 			UPDATE documents
-			SET update_seq = update_seq + 1,
-			    updated_at = ?
+			SET update_seq = update_seq + ?,
+			    updated_at = ?,
+			    pending_since = COALESCE(pending_since, ?)
 			WHERE id = ?
 			RETURNING update_seq
-		`, now, id).Scan(&seq).Error; err != nil {
+		`, len(fresh), now, now, docID).Scan(&lastSeq).Error; err != nil {
 			return err
 		}
 
-		// Insert document update with the generated seq
-		if err := tx.Create(&domain.DocumentUpdate{
-			DocumentID:   id,
-			Seq:          seq,
-			UpdateBinary: content,
-			UserID:       userID,
-			CreatedAt:    now,
-		}).Error; err != nil {
-			return err
+		firstSeq := lastSeq - uint64(len(fresh)) + 1
+		updates := make([]domain.DocumentUpdate, len(fresh))
+		var updateKeys []domain.DocumentUpdateKey
+		for n, i := range fresh {
+			seqs[i] = firstSeq + uint64(n)
+			updates[n] = domain.DocumentUpdate{
+				DocumentID: docID,
+				Seq:        seqs[i],
+				UserID:     userID,
+				Size:       len(contents[i]),
+				CreatedAt:  now,
+			}
+			if keys[i] != "" {
+				updateKeys = append(updateKeys, domain.DocumentUpdateKey{
+					DocumentID: docID,
+					UpdateKey:  keys[i],
+					Seq:        seqs[i],
+					CreatedAt:  now,
+				})
+			}
+			setUpdateBinary(&updates[n], bins[i])
+			stored[i] = true
+		}
+		for i, key := range keys {
+			if j, ok := first[key]; ok && j != i {
+				seqs[i] = seqs[j]
+			}
 		}
 
-		return nil
+		if err := tx.CreateInBatches(&updates, 100).Error; err != nil {
+			return err
+		}
+		if len(updateKeys) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&updateKeys, 100).Error
 	})
+	if err != nil {
+		r.discardBlobs(ctx, blobKeys(bins, nil))
+		return nil, err
+	}
+	// duplicates were not stored
+	r.discardBlobs(ctx, blobKeys(bins, stored))
 
-	return err
+	return seqs, nil
+}
+
+// storedUpdateKeys maps the keys already stored for docID to their seq
+func storedUpdateKeys(tx *gorm.DB, docID uint64, keys []string) (map[string]uint64, error) {
+	var wanted []string
+	for _, key := range keys {
+		if key != "" {
+			wanted = append(wanted, key)
+		}
+	}
+	stored := make(map[string]uint64)
+	if len(wanted) == 0 {
+		return stored, nil
+	}
+
+	var rows []domain.DocumentUpdateKey
+	if err := tx.Where("document_id = ? AND update_key IN ?", docID, wanted).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		stored[row.UpdateKey] = row.Seq
+	}
+	return stored, nil
+}
+
+// PruneUpdateKeys forgets the dedup keys stored before cutoff, a retry of
+// those updates is stored again. Returns how many keys were removed.
+func (r *DocumentRepositoryImpl) PruneUpdateKeys(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("created_at < ?", cutoff).
+		Delete(&domain.DocumentUpdateKey{})
+	return result.RowsAffected, result.Error
 }
 
 func (r *DocumentRepositoryImpl) CreateSnapshot(ctx context.Context, docID uint64, state []byte) error {
-	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	snapshot, err := r.newSnapshotRow(ctx, docID, state)
+	if err != nil {
+		return err
+	}
+
+	var inserted bool
+	var released []string
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var lastSeq uint64
 
 		// Get latest update seq
@@ -239,52 +892,488 @@ func (r *DocumentRepositoryImpl) CreateSnapshot(ctx context.Context, docID uint6
 			return nil // snapshot already exists
 		}
 
-		// create snapshot
-		snapshot := domain.DocumentSnapshot{
-			DocumentID:     docID,
-			Seq:            lastSeq,
-			SnapshotBinary: state,
-		}
-		if err := tx.Create(&snapshot).Error; err != nil {
+		snapshot.Seq = lastSeq
+		released, err = r.insertSnapshot(tx, &snapshot)
+		inserted = err == nil
+		return err
+	})
+	r.afterSnapshot(ctx, &snapshot, inserted && err == nil, released)
+	return err
+}
+
+// CreateSnapshotAt stores a state that covers the updates up to seq, for
+// states built from the stored history rather than taken from the sync server.
+// It does nothing when a snapshot at seq or later already exists.
+func (r *DocumentRepositoryImpl) CreateSnapshotAt(ctx context.Context, docID uint64, seq uint64, state []byte) error {
+	snapshot, err := r.newSnapshotRow(ctx, docID, state)
+	if err != nil {
+		return err
+	}
+	snapshot.Seq = seq
+
+	var inserted bool
+	var released []string
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// lock the document so no snapshot is written concurrently
+		var currentSeq uint64
+		if err := tx.Raw("SELECT update_seq FROM documents WHERE id = ? FOR UPDATE", docID).
+			Scan(&currentSeq).Error; err != nil {
 			return err
 		}
+		if seq > currentSeq {
+			return fmt.Errorf("snapshot seq %d is ahead of the document at %d", seq, currentSeq)
+		}
 
-		// cleanup old updates
-		if err := tx.Where("document_id = ? AND seq <= ?", docID, lastSeq).
-			Delete(&domain.DocumentUpdate{}).Error; err != nil {
+		var newer bool
+		if err := tx.Model(&domain.DocumentSnapshot{}).
+			Select("count(1) > 0").
+			Where("document_id = ? AND seq >= ?", docID, seq).
+			Find(&newer).Error; err != nil {
 			return err
 		}
+		if newer {
+			return nil
+		}
 
-		return nil
+		released, err = r.insertSnapshot(tx, &snapshot)
+		inserted = err == nil
+		return err
 	})
+	r.afterSnapshot(ctx, &snapshot, inserted && err == nil, released)
 	return err
 }
 
-func (r *DocumentRepositoryImpl) CurrentSeq(ctx context.Context, docID uint64, currentSeq *uint64) error {
-	return r.db.WithContext(ctx).Model(&domain.Document{}).
-		Where("id = ?", docID).
-		Select("update_seq").
-		Scan(currentSeq).Error
-}
+// insertSnapshot writes the snapshot and compacts the history before it. It
+// returns the blob keys of the rows compacted away.
+func (r *DocumentRepositoryImpl) insertSnapshot(tx *gorm.DB, snapshot *domain.DocumentSnapshot) ([]string, error) {
+	if err := tx.Create(snapshot).Error; err != nil {
+		return nil, err
+	}
 
-func (r *DocumentRepositoryImpl) LastSnapshot(ctx context.Context, docID uint64, snapshot *domain.DocumentSnapshot) error {
-	return r.db.WithContext(ctx).Where("document_id = ?", docID).
-		Order("seq DESC").
-		First(&snapshot).Error
-}
+	// nothing is pending once the snapshot covers every update
+	if err := tx.Model(&domain.Document{}).
+		Where("id = ? AND update_seq <= ?", snapshot.DocumentID, snapshot.Seq).
+		UpdateColumns(map[string]interface{}{"pending_since": nil, "snapshot_attempt_at": nil}).Error; err != nil {
+		return nil, err
+	}
 
-func (r *DocumentRepositoryImpl) LastSnapshotSeq(ctx context.Context, docID uint64, lastSnapshotSeq *uint64) error {
-	return r.db.WithContext(ctx).Model(&domain.DocumentSnapshot{}).
-		Where("document_id = ?", docID).
-		Select("COALESCE(MAX(seq), 0)").
-		Scan(lastSnapshotSeq).Error
+	return r.compactHistory(tx, snapshot.DocumentID, snapshot.Seq)
 }
 
-func (r *DocumentRepositoryImpl) UpdatesFromSnapshot(ctx context.Context, docID uint64, snapshotSeq uint64, updates *[]domain.DocumentUpdate) error {
-	return r.db.WithContext(ctx).Where("document_id = ? AND seq > ?", docID, snapshotSeq).
+// afterSnapshot deletes the blobs of compacted rows once the snapshot is
+// committed, or the blob of the snapshot itself when it was not written
+func (r *DocumentRepositoryImpl) afterSnapshot(ctx context.Context, snapshot *domain.DocumentSnapshot, committed bool, released []string) {
+	if !committed {
+		released = nil
+		if snapshot.BlobKey != nil {
+			released = []string{*snapshot.BlobKey}
+		}
+	}
+	if len(released) > 0 {
+		r.discardBlobs(ctx, released)
+	}
+}
+
+// RestoreState appends a historical state on top of the current history: a new
+// snapshot holding the historical snapshot, followed by copies of the
+// historical updates, attributed to the given UserID. Returns the new update
+// seq of the document.
+func (r *DocumentRepositoryImpl) RestoreState(ctx context.Context, docID uint64, snapshot []byte, updates []domain.DocumentUpdate) (uint64, error) {
+	if snapshot == nil {
+		snapshot = []byte{} // restoring to an empty document
+	}
+	snapshotRow, err := r.newSnapshotRow(ctx, docID, snapshot)
+	if err != nil {
+		return 0, err
+	}
+	contents := make([][]byte, len(updates))
+	for i, u := range updates {
+		contents[i] = u.UpdateBinary
+	}
+	bins, err := r.storeUpdates(ctx, docID, contents)
+	if err != nil {
+		r.afterSnapshot(ctx, &snapshotRow, false, nil)
+		return 0, err
+	}
+
+	var lastSeq uint64
+	var released []string
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		// the restored updates are pending, the snapshot covers the rest
+		var pendingSince *time.Time
+		if len(updates) > 0 {
+			pendingSince = &now
+		}
+		// reserve one seq for the snapshot and one for every update
+		if err := tx.Raw(`
+			UPDATE documents
+			SET update_seq = update_seq + ?,
+			    updated_at = ?,
+			    pending_since = ?
+			WHERE id = ?
+			RETURNING update_seq
+		`, len(updates)+1, now, pendingSince, docID).Scan(&lastSeq).Error; err != nil {
+			return err
+		}
+		if lastSeq == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		snapshotSeq := lastSeq - uint64(len(updates))
+		snapshotRow.Seq = snapshotSeq
+		snapshotRow.CreatedAt = now
+		if err := tx.Create(&snapshotRow).Error; err != nil {
+			return err
+		}
+
+		if len(updates) > 0 {
+			restored := make([]domain.DocumentUpdate, 0, len(updates))
+			for i, u := range updates {
+				restored = append(restored, domain.DocumentUpdate{
+					DocumentID: docID,
+					Seq:        snapshotSeq + uint64(i) + 1,
+					UserID:     u.UserID,
+					Size:       len(u.UpdateBinary),
+					CreatedAt:  now,
+				})
+				setUpdateBinary(&restored[i], bins[i])
+			}
+			if err := tx.Create(&restored).Error; err != nil {
+				return err
+			}
+		}
+
+		released, err = r.compactHistory(tx, docID, snapshotSeq)
+		return err
+	})
+	if err != nil {
+		r.afterSnapshot(ctx, &snapshotRow, false, nil)
+		r.discardBlobs(ctx, blobKeys(bins, nil))
+		return lastSeq, err
+	}
+	r.afterSnapshot(ctx, &snapshotRow, true, released)
+
+	return lastSeq, nil
+}
+
+// compactHistory runs after a snapshot at snapshotSeq was written. It returns
+// the blob keys of the rows it deleted, to be deleted after commit.
+func (r *DocumentRepositoryImpl) compactHistory(tx *gorm.DB, docID uint64, snapshotSeq uint64) ([]string, error) {
+	if r.retention.enabled() {
+		return r.pruneHistory(tx, docID)
+	}
+
+	// cleanup old updates
+	return deleteUpdatesUpTo(tx, docID, snapshotSeq)
+}
+
+// deleteUpdatesUpTo removes updates with seq <= uptoSeq, except the ones a named
+// version still needs to be rebuilt from its nearest earlier snapshot
+func deleteUpdatesUpTo(tx *gorm.DB, docID uint64, uptoSeq uint64) ([]string, error) {
+	var keys []string
+	err := tx.Raw(`
+		WITH deleted AS (
+			DELETE FROM document_updates u
+			WHERE u.document_id = ? AND u.seq <= ?
+			AND NOT EXISTS (
+				SELECT 1 FROM document_versions v
+				WHERE v.document_id = u.document_id
+				AND u.seq <= v.seq
+				AND u.seq > COALESCE((
+					SELECT MAX(s.seq) FROM document_snapshots s
+					WHERE s.document_id = v.document_id AND s.seq <= v.seq
+				), 0)
+			)
+			RETURNING u.blob_key
+		)
+		SELECT blob_key FROM deleted WHERE blob_key IS NOT NULL
+	`, docID, uptoSeq).Scan(&keys).Error
+	return keys, err
+}
+
+// pruneHistory drops snapshots outside the retention window, and the updates
+// that are covered by the oldest snapshot still retained
+func (r *DocumentRepositoryImpl) pruneHistory(tx *gorm.DB, docID uint64) ([]string, error) {
+	var snapshots []domain.DocumentSnapshot
+	if err := tx.Select("id", "seq", "created_at").
+		Where("document_id = ?", docID).
+		Order("seq DESC").
+		Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().UTC().Add(-r.retention.MaxAge)
+	retained := 0
+	for i, snap := range snapshots {
+		// the latest snapshot is always kept
+		if i > 0 && r.retention.MaxSnapshots > 0 && i >= r.retention.MaxSnapshots {
+			break
+		}
+		if i > 0 && r.retention.MaxAge > 0 && snap.CreatedAt.Before(cutoff) {
+			break
+		}
+		retained++
+	}
+
+	// every snapshot is inside the window, history back to seq 0 is kept
+	if retained == len(snapshots) {
+		return nil, nil
+	}
+	floorSeq := snapshots[retained-1].Seq
+
+	// keep snapshots that are still the base of a named version
+	var keys []string
+	if err := tx.Raw(`
+		WITH deleted AS (
+			DELETE FROM document_snapshots s
+			WHERE s.document_id = ? AND s.seq < ?
+			AND NOT EXISTS (
+				SELECT 1 FROM document_versions v
+				WHERE v.document_id = s.document_id
+				AND v.seq >= s.seq
+				AND NOT EXISTS (
+					SELECT 1 FROM document_snapshots s2
+					WHERE s2.document_id = s.document_id
+					AND s2.seq > s.seq AND s2.seq <= v.seq
+				)
+			)
+			RETURNING s.blob_key
+		)
+		SELECT blob_key FROM deleted WHERE blob_key IS NOT NULL
+	`, docID, floorSeq).Scan(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	updateKeys, err := deleteUpdatesUpTo(tx, docID, floorSeq)
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, updateKeys...), nil
+}
+
+func (r *DocumentRepositoryImpl) CurrentSeq(ctx context.Context, docID uint64, currentSeq *uint64) error {
+	return r.db.WithContext(ctx).Model(&domain.Document{}).
+		Where("id = ?", docID).
+		Select("update_seq").
+		Scan(currentSeq).Error
+}
+
+// LastSnapshot finds the latest snapshot that passes verification, see
+// verifiedSnapshot
+func (r *DocumentRepositoryImpl) LastSnapshot(ctx context.Context, docID uint64, snapshot *domain.DocumentSnapshot) error {
+	return r.verifiedSnapshot(ctx, docID, nil, snapshot)
+}
+
+// verifiedSnapshot finds the latest snapshot, at or before maxSeq when set. A
+// corrupt snapshot is replaced by the one before it (or by none, an empty
+// snapshot at seq 0) as long as the updates between the two are still stored,
+// so the same state can be rebuilt from them. Otherwise the corruption error is
+// returned. Without history retention every snapshot deletes the updates it
+// covers, so there is nothing to fall back to unless a named version kept them.
+func (r *DocumentRepositoryImpl) verifiedSnapshot(ctx context.Context, docID uint64, maxSeq *uint64, snapshot *domain.DocumentSnapshot) error {
+	query := r.db.WithContext(ctx).Where("document_id = ?", docID)
+	if maxSeq != nil {
+		query = query.Where("seq <= ?", *maxSeq)
+	}
+	if err := query.Order("seq DESC").First(snapshot).Error; err != nil {
+		return err
+	}
+
+	corruptSeq := snapshot.Seq
+	for {
+		err := r.loadSnapshotBinary(ctx, snapshot)
+		if err == nil || !defError.Is(err, ErrCorruptBinary) {
+			return err
+		}
+		log.Error().Err(err).Uint64("doc_id", docID).Msg("corrupt snapshot, falling back to the previous one")
+
+		var previous domain.DocumentSnapshot
+		perr := r.db.WithContext(ctx).
+			Where("document_id = ? AND seq < ?", docID, snapshot.Seq).
+			Order("seq DESC").
+			First(&previous).Error
+		if perr != nil && !defError.Is(perr, gorm.ErrRecordNotFound) {
+			return perr
+		}
+
+		var stored int64
+		if cerr := r.db.WithContext(ctx).Model(&domain.DocumentUpdate{}).
+			Where("document_id = ? AND seq > ? AND seq <= ?", docID, previous.Seq, corruptSeq).
+			Count(&stored).Error; cerr != nil {
+			return cerr
+		}
+		if uint64(stored) != corruptSeq-previous.Seq {
+			return err
+		}
+
+		*snapshot = previous
+		if previous.ID == 0 {
+			return nil // every update since the start is stored
+		}
+	}
+}
+
+func (r *DocumentRepositoryImpl) LastSnapshotSeq(ctx context.Context, docID uint64, lastSnapshotSeq *uint64) error {
+	return r.db.WithContext(ctx).Model(&domain.DocumentSnapshot{}).
+		Where("document_id = ?", docID).
+		Select("COALESCE(MAX(seq), 0)").
+		Scan(lastSnapshotSeq).Error
+}
+
+// PendingUpdates summarizes the updates after the latest snapshot. Rows
+// written before sizes were tracked count with their stored size, or with the
+// offload threshold when they were offloaded, which they were larger than.
+func (r *DocumentRepositoryImpl) PendingUpdates(ctx context.Context, docID uint64) (PendingUpdates, error) {
+	var row struct {
+		Count          uint64
+		Bytes          int64
+		FirstUpdateAt  *time.Time
+		LastUpdateAt   *time.Time
+		LastSnapshotAt *time.Time
+	}
+	if err := r.db.WithContext(ctx).Raw(`
+		SELECT COUNT(u.id) AS count,
+		       COALESCE(SUM(CASE
+		           WHEN u.size > 0 THEN u.size
+		           WHEN u.blob_key IS NOT NULL THEN ?
+		           ELSE octet_length(u.update_binary)
+		       END), 0) AS bytes,
+		       MIN(u.created_at) AS first_update_at,
+		       MAX(u.created_at) AS last_update_at,
+		       s.created_at AS last_snapshot_at
+		FROM documents d
+		LEFT JOIN LATERAL (
+			SELECT seq, created_at FROM document_snapshots
+			WHERE document_id = d.id
+			ORDER BY seq DESC
+			LIMIT 1
+		) s ON true
+		LEFT JOIN document_updates u ON u.document_id = d.id AND u.seq > COALESCE(s.seq, 0)
+		WHERE d.id = ?
+		GROUP BY s.created_at
+	`, r.blobs.Threshold+1, docID).Scan(&row).Error; err != nil {
+		return PendingUpdates{}, err
+	}
+
+	pending := PendingUpdates{Count: row.Count, Bytes: row.Bytes}
+	if row.FirstUpdateAt != nil {
+		pending.FirstUpdateAt = *row.FirstUpdateAt
+	}
+	if row.LastUpdateAt != nil {
+		pending.LastUpdateAt = *row.LastUpdateAt
+	}
+	if row.LastSnapshotAt != nil {
+		pending.LastSnapshotAt = *row.LastSnapshotAt
+	}
+	return pending, nil
+}
+
+// GetSnapshotPolicy returns the policy override of a document, nil without one
+func (r *DocumentRepositoryImpl) GetSnapshotPolicy(ctx context.Context, docID uint64) (*domain.DocumentSnapshotPolicy, error) {
+	var policy domain.DocumentSnapshotPolicy
+	err := r.db.WithContext(ctx).Where("document_id = ?", docID).First(&policy).Error
+	if defError.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *DocumentRepositoryImpl) SaveSnapshotPolicy(ctx context.Context, policy *domain.DocumentSnapshotPolicy) error {
+	policy.UpdatedAt = time.Now().UTC()
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}},
+		UpdateAll: true,
+	}).Create(policy).Error
+}
+
+func (r *DocumentRepositoryImpl) DeleteSnapshotPolicy(ctx context.Context, docID uint64) error {
+	return r.db.WithContext(ctx).
+		Where("document_id = ?", docID).
+		Delete(&domain.DocumentSnapshotPolicy{}).Error
+}
+
+// SnapshotCandidates claims up to limit documents whose pending updates are
+// due by the idle or age rule of their effective policy, longest idle first.
+// The count and size rules are checked when updates arrive instead. Only
+// documents with pending_since set are looked at. A claimed document gets
+// snapshot_attempt_at set to now and is skipped until retryAfter has passed,
+// so one whose snapshot keeps failing doesn't hold up the others.
+func (r *DocumentRepositoryImpl) SnapshotCandidates(ctx context.Context, defaults SnapshotPolicy, now time.Time, retryAfter time.Duration, limit int) ([]uint64, error) {
+	idle := int64(defaults.IdleAfter / time.Second)
+	maxAge := int64(defaults.MaxAge / time.Second)
+
+	var ids []uint64
+	err := r.db.WithContext(ctx).Raw(`
+		WITH due AS (
+			SELECT d.id, u.last_at
+			FROM documents d
+			LEFT JOIN document_snapshot_policies p ON p.document_id = d.id
+			LEFT JOIN LATERAL (
+				SELECT seq, created_at FROM document_snapshots
+				WHERE document_id = d.id
+				ORDER BY seq DESC
+				LIMIT 1
+			) s ON true
+			CROSS JOIN LATERAL (
+				SELECT MIN(created_at) AS first_at, MAX(created_at) AS last_at
+				FROM document_updates
+				WHERE document_id = d.id AND seq > COALESCE(s.seq, 0)
+			) u
+			WHERE d.pending_since IS NOT NULL
+			  AND (d.snapshot_attempt_at IS NULL OR d.snapshot_attempt_at <= ?::timestamptz - ? * interval '1 second')
+			  AND d.update_seq > COALESCE(s.seq, 0)
+			  AND u.last_at IS NOT NULL
+			  AND (
+				(COALESCE(p.idle_seconds, ?) > 0
+				 AND u.last_at <= ?::timestamptz - COALESCE(p.idle_seconds, ?) * interval '1 second')
+				OR (COALESCE(p.max_age_seconds, ?) > 0
+				 AND COALESCE(s.created_at, u.first_at) <= ?::timestamptz - COALESCE(p.max_age_seconds, ?) * interval '1 second')
+			  )
+			ORDER BY u.last_at
+			LIMIT ?
+		), claimed AS (
+			UPDATE documents d SET snapshot_attempt_at = ?
+			FROM due
+			WHERE d.id = due.id
+			RETURNING d.id
+		)
+		SELECT due.id FROM due JOIN claimed ON claimed.id = due.id
+		ORDER BY due.last_at
+	`, now, int64(retryAfter/time.Second), idle, now, idle, maxAge, now, maxAge, limit, now).Scan(&ids).Error
+	return ids, err
+}
+
+// UpdatesFromSnapshot returns up to limit updates with seq > afterSeq in order.
+// Updates are verified against their checksum, a corrupt one fails the read
+// with ErrCorruptBinary since no other copy of it exists.
+func (r *DocumentRepositoryImpl) UpdatesFromSnapshot(ctx context.Context, docID uint64, afterSeq uint64, limit int, updates *[]domain.DocumentUpdate) error {
+	if err := r.db.WithContext(ctx).Where("document_id = ? AND seq > ?", docID, afterSeq).
+		Order("seq ASC").
+		Limit(limit).
+		Find(updates).Error; err != nil {
+		return err
+	}
+	return r.loadUpdateBinaries(ctx, *updates)
+}
+
+// SnapshotAtSeq finds the latest snapshot taken at or before the given seq
+func (r *DocumentRepositoryImpl) SnapshotAtSeq(ctx context.Context, docID uint64, seq uint64, snapshot *domain.DocumentSnapshot) error {
+	return r.verifiedSnapshot(ctx, docID, &seq, snapshot)
+}
+
+// UpdatesInRange returns updates with fromSeq < seq <= toSeq in order
+func (r *DocumentRepositoryImpl) UpdatesInRange(ctx context.Context, docID uint64, fromSeq uint64, toSeq uint64, updates *[]domain.DocumentUpdate) error {
+	if err := r.db.WithContext(ctx).
+		Where("document_id = ? AND seq > ? AND seq <= ?", docID, fromSeq, toSeq).
 		Order("seq ASC").
-		Limit(500).
-		Find(&updates).Error
+		Find(updates).Error; err != nil {
+		return err
+	}
+	return r.loadUpdateBinaries(ctx, *updates)
 }
 
 type collaboratorRow struct {
@@ -361,10 +1450,707 @@ func (r *DocumentRepositoryImpl) RemoveCollaborator(ctx context.Context, docID u
 	return nil
 }
 
+// ErrNotEditor is returned when ownership is transferred to a user who isn't
+// a direct editor of the document
+var ErrNotEditor = defError.New("new owner is not an editor")
+
+// ErrNotOwner is returned when the creator of a document no longer holds its
+// owner role, a workspace admin demoted or removed them
+var ErrNotOwner = defError.New("creator is not the owner")
+
+// TransferOwnership makes newOwnerID the owner of a document and ownerID one
+// of its editors, swapping their collaborator roles. It returns ErrNotOwner
+// when ownerID doesn't hold the owner role anymore.
+func (r *DocumentRepositoryImpl) TransferOwnership(ctx context.Context, docID uint64, ownerID uint64, newOwnerID uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// lock the document so concurrent transfers can't both succeed
+		var doc domain.Document
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ? AND user_id = ?", docID, ownerID).
+			First(&doc).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&domain.DocumentCollaborator{}).
+			Where("document_id = ? AND user_id = ? AND role = ?", docID, newOwnerID, "editor").
+			Update("role", "owner")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotEditor
+		}
+
+		result = tx.Model(&domain.DocumentCollaborator{}).
+			Where("document_id = ? AND user_id = ? AND role = ?", docID, ownerID, "owner").
+			Update("role", "editor")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrNotOwner
+		}
+
+		return tx.Model(&domain.Document{}).
+			Where("id = ?", docID).
+			Update("user_id", newOwnerID).Error
+	})
+}
+
+func (r *DocumentRepositoryImpl) CreateShareLink(ctx context.Context, link *domain.DocumentShareLink) error {
+	return r.db.WithContext(ctx).Create(link).Error
+}
+
+func (r *DocumentRepositoryImpl) ListShareLinks(ctx context.Context, docID uint64) ([]domain.DocumentShareLink, error) {
+	var links []domain.DocumentShareLink
+	err := r.db.WithContext(ctx).
+		Where("document_id = ?", docID).
+		Order("created_at DESC").
+		Find(&links).Error
+	return links, err
+}
+
+func (r *DocumentRepositoryImpl) FindShareLink(ctx context.Context, tokenHash string, link *domain.DocumentShareLink) error {
+	return r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(link).Error
+}
+
+func (r *DocumentRepositoryImpl) DeleteShareLink(ctx context.Context, docID uint64, linkID uint64) error {
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND document_id = ?", linkID, docID).
+		Delete(&domain.DocumentShareLink{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ErrShareLinkUsedUp is returned when a share link reached its max uses
+var ErrShareLinkUsedUp = defError.New("share link has no uses left")
+
+// RedeemShareLink makes userID a collaborator with the role of the link, or
+// upgrades a viewer to editor, and counts a use. A user who already has that
+// access keeps it without using the link up. It returns the role of the user
+// and whether it changed.
+func (r *DocumentRepositoryImpl) RedeemShareLink(ctx context.Context, linkID uint64, userID uint64) (string, bool, error) {
+	var role string
+	changed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// lock the link so concurrent redemptions can't exceed max uses
+		var link domain.DocumentShareLink
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&link, linkID).Error; err != nil {
+			return err
+		}
+
+		var current string
+		if err := tx.Model(&domain.DocumentCollaborator{}).
+			Where("document_id = ? AND user_id = ?", link.DocumentID, userID).
+			Select("role").
+			Scan(&current).Error; err != nil {
+			return err
+		}
+		if current == "owner" || current == "editor" || current == link.Role {
+			role = current
+			return nil
+		}
+
+		if link.MaxUses != nil && link.Uses >= *link.MaxUses {
+			return ErrShareLinkUsedUp
+		}
+
+		if current == "" {
+			if err := tx.Create(&domain.DocumentCollaborator{
+				DocumentID: link.DocumentID,
+				UserID:     userID,
+				Role:       link.Role,
+				AddedAt:    time.Now().UTC(),
+			}).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(&domain.DocumentCollaborator{}).
+			Where("document_id = ? AND user_id = ?", link.DocumentID, userID).
+			Update("role", link.Role).Error; err != nil {
+			return err
+		}
+
+		role = link.Role
+		changed = true
+		return tx.Model(&link).Update("uses", gorm.Expr("uses + 1")).Error
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return role, changed, nil
+}
+
+// SaveInvitation creates the invitation, or renews the one of the same
+// document and email with a new role, token and expiry
+func (r *DocumentRepositoryImpl) SaveInvitation(ctx context.Context, invitation *domain.DocumentInvitation) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}, {Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "token_hash", "invited_by", "expires_at", "created_at"}),
+	}).Create(invitation).Error
+}
+
+func (r *DocumentRepositoryImpl) ListInvitations(ctx context.Context, docID uint64) ([]domain.DocumentInvitation, error) {
+	var invitations []domain.DocumentInvitation
+	err := r.db.WithContext(ctx).
+		Where("document_id = ?", docID).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *DocumentRepositoryImpl) FindInvitation(ctx context.Context, tokenHash string, invitation *domain.DocumentInvitation) error {
+	return r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(invitation).Error
+}
+
+func (r *DocumentRepositoryImpl) DeleteInvitation(ctx context.Context, docID uint64, invitationID uint64) error {
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND document_id = ?", invitationID, docID).
+		Delete(&domain.DocumentInvitation{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation gives userID the role of an invitation and deletes it. A
+// collaborator keeps a higher role. It returns the role of the user and
+// whether it changed.
+func (r *DocumentRepositoryImpl) AcceptInvitation(ctx context.Context, invitationID uint64, userID uint64) (string, bool, error) {
+	var role string
+	changed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var invitation domain.DocumentInvitation
+		result := tx.Clauses(clause.Returning{}).
+			Where("id = ?", invitationID).
+			Delete(&invitation)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound // accepted concurrently
+		}
+
+		var current string
+		if err := tx.Model(&domain.DocumentCollaborator{}).
+			Where("document_id = ? AND user_id = ?", invitation.DocumentID, userID).
+			Select("role").
+			Scan(&current).Error; err != nil {
+			return err
+		}
+		if current == "owner" || current == "editor" || current == invitation.Role {
+			role = current
+			return nil
+		}
+
+		role = invitation.Role
+		changed = true
+		if current == "" {
+			return tx.Create(&domain.DocumentCollaborator{
+				DocumentID: invitation.DocumentID,
+				UserID:     userID,
+				Role:       invitation.Role,
+				AddedAt:    time.Now().UTC(),
+			}).Error
+		}
+		return tx.Model(&domain.DocumentCollaborator{}).
+			Where("document_id = ? AND user_id = ?", invitation.DocumentID, userID).
+			Update("role", invitation.Role).Error
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return role, changed, nil
+}
+
+// ClaimInvitations makes a new user a collaborator of the documents their
+// email is invited to, and deletes the invitations of the email. Expired ones
+// are deleted too, no one can use them anymore. It returns how many
+// invitations were claimed.
+func (r *DocumentRepositoryImpl) ClaimInvitations(ctx context.Context, userID uint64, email string) (int, error) {
+	claimed := 0
+	email = strings.ToLower(strings.TrimSpace(email))
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		result := tx.Exec(`
+			INSERT INTO document_collaborators (document_id, user_id, role, added_at)
+			SELECT document_id, ?, role, ?
+			FROM document_invitations
+			WHERE email = ? AND expires_at > ?
+			ON CONFLICT DO NOTHING
+		`, userID, now, email, now)
+		if result.Error != nil {
+			return result.Error
+		}
+		claimed = int(result.RowsAffected)
+
+		return tx.Where("email = ?", email).Delete(&domain.DocumentInvitation{}).Error
+	})
+	return claimed, err
+}
+
+func (r *DocumentRepositoryImpl) IsTeamMember(ctx context.Context, teamID uint64, userID uint64) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&domain.TeamMember{}).
+		Where("team_id = ? AND user_id = ?", teamID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *DocumentRepositoryImpl) TeamMemberIDs(ctx context.Context, teamID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Model(&domain.TeamMember{}).
+		Where("team_id = ?", teamID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// SaveTeamGrant grants a team a role on a document, or changes the role of an
+// existing grant
+func (r *DocumentRepositoryImpl) SaveTeamGrant(ctx context.Context, grant *domain.DocumentTeamGrant) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "document_id"}, {Name: "team_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "granted_by"}),
+		}).
+		Create(grant).Error
+}
+
+type teamGrantRow struct {
+	TeamID      uint64
+	Name        string
+	Role        string
+	MemberCount int
+	CreatedAt   time.Time
+}
+
+func (r *DocumentRepositoryImpl) ListTeamGrants(ctx context.Context, docID uint64) ([]teamGrantRow, error) {
+	var rows []teamGrantRow
+
+	err := r.db.WithContext(ctx).
+		Table("document_team_grants g").
+		Select(`
+			t.id AS team_id,
+			t.name AS name,
+			g.role AS role,
+			(SELECT COUNT(*) FROM team_members m WHERE m.team_id = t.id) AS member_count,
+			g.created_at AS created_at
+		`).
+		Joins("JOIN teams t ON t.id = g.team_id").
+		Where("g.document_id = ?", docID).
+		Order("g.created_at ASC").
+		Scan(&rows).Error
+
+	return rows, err
+}
+
+func (r *DocumentRepositoryImpl) DeleteTeamGrant(ctx context.Context, docID uint64, teamID uint64) error {
+	result := r.db.WithContext(ctx).
+		Where("document_id = ? AND team_id = ?", docID, teamID).
+		Delete(&domain.DocumentTeamGrant{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type userRoleRow struct {
+	DocumentID uint64
+	UserID     uint64
+	Role       string
+}
+
+// EffectiveRoles returns the role of every user of userIDs on every document
+// of docIDs, "none" without access
+func (r *DocumentRepositoryImpl) EffectiveRoles(ctx context.Context, docIDs []uint64, userIDs []uint64) ([]userRoleRow, error) {
+	var rows []userRoleRow
+	if len(docIDs) == 0 || len(userIDs) == 0 {
+		return rows, nil
+	}
+
+	var grants []userRoleRow
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT grants.document_id, grants.user_id, grants.role
+		FROM `+accessGrantsSQL+`
+		WHERE grants.document_id IN ? AND grants.user_id IN ?
+	`, docIDs, userIDs).Scan(&grants).Error
+	if err != nil {
+		return nil, err
+	}
+
+	type docUser struct{ docID, userID uint64 }
+	highest := make(map[docUser]string)
+	for _, g := range grants {
+		key := docUser{g.DocumentID, g.UserID}
+		highest[key] = higherRole(highest[key], g.Role)
+	}
+
+	rows = make([]userRoleRow, 0, len(docIDs)*len(userIDs))
+	for _, docID := range docIDs {
+		for _, userID := range userIDs {
+			role := highest[docUser{docID, userID}]
+			if role == "" {
+				role = "none"
+			}
+			rows = append(rows, userRoleRow{DocumentID: docID, UserID: userID, Role: role})
+		}
+	}
+	return rows, nil
+}
+
 func (r *DocumentRepositoryImpl) DeleteDocument(ctx context.Context, docID uint64) error {
+	var keys []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// blobs are not covered by the cascade, collect them first
+		if err := tx.Raw(`
+			SELECT blob_key FROM document_snapshots WHERE document_id = ? AND blob_key IS NOT NULL
+			UNION ALL
+			SELECT blob_key FROM document_updates WHERE document_id = ? AND blob_key IS NOT NULL
+		`, docID, docID).Scan(&keys).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", docID).
+			Delete(&domain.Document{}).Error
+		// automatically delete all the relationships
+		// gorm:"constraint:OnDelete:CASCADE"
+	})
+	if err != nil {
+		return err
+	}
+
+	r.discardBlobs(ctx, keys)
+	return nil
+}
+
+// CreateVersion pins a named version at the document's current update seq
+func (r *DocumentRepositoryImpl) CreateVersion(ctx context.Context, version *domain.DocumentVersion) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc domain.Document
+		if err := tx.Select("id", "update_seq").First(&doc, version.DocumentID).Error; err != nil {
+			return err
+		}
+
+		version.Seq = doc.UpdateSeq
+		version.CreatedAt = time.Now().UTC()
+		return tx.Create(version).Error
+	})
+}
+
+type versionRow struct {
+	ID           uint64
+	Name         string
+	Seq          uint64
+	CreatedBy    uint64
+	CreatorName  string
+	CreatorEmail string
+	CreatedAt    time.Time
+}
+
+func (r *DocumentRepositoryImpl) ListVersions(ctx context.Context, docID uint64) ([]versionRow, error) {
+	var rows []versionRow
+
+	err := r.db.WithContext(ctx).
+		Table("document_versions dv").
+		Select(`
+			dv.id,
+			dv.name,
+			dv.seq,
+			dv.created_by,
+			u.name AS creator_name,
+			u.email AS creator_email,
+			dv.created_at
+		`).
+		Joins("LEFT JOIN users u ON u.id = dv.created_by").
+		Where("dv.document_id = ?", docID).
+		Order("dv.seq DESC, dv.id DESC").
+		Scan(&rows).Error
+
+	return rows, err
+}
+
+func (r *DocumentRepositoryImpl) FindVersion(ctx context.Context, docID uint64, versionID uint64, version *domain.DocumentVersion) error {
 	return r.db.WithContext(ctx).
-		Where("id = ?", docID).
-		Delete(&domain.Document{}).Error
-	// automatically delete all the relationships
-	// gorm:"constraint:OnDelete:CASCADE"
+		Where("id = ? AND document_id = ?", versionID, docID).
+		First(version).Error
+}
+
+// UpdateSearchContent refreshes the full-text index of the document content.
+// updated_at is left alone since the document itself did not change.
+func (r *DocumentRepositoryImpl) UpdateSearchContent(ctx context.Context, docID uint64, content string) error {
+	return r.db.WithContext(ctx).
+		Exec(`UPDATE documents SET content_tsv = to_tsvector('simple', ?) WHERE id = ?`, content, docID).
+		Error
+}
+
+type DocumentSearchResult struct {
+	ID          uint64    `json:"id"`
+	Title       string    `json:"title"`
+	Role        string    `json:"role"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	OwnerName   string    `json:"owner_name"`
+	OwnerId     uint64    `json:"owner_id"`
+	TitleRank   float32   `json:"title_rank"`
+	ContentRank float32   `json:"content_rank"`
+}
+
+// SearchDocuments matches query against titles and content of the documents
+// the user collaborates on. Title matches rank before content matches.
+func (r *DocumentRepositoryImpl) SearchDocuments(ctx context.Context, userID uint64, query string, page, pageSize int) ([]DocumentSearchResult, DocumentsMeta, error) {
+	var docs []DocumentSearchResult
+	var totalRecords int64
+
+	data := r.db.WithContext(ctx).Table("documents").
+		Select(`
+				documents.id,
+				documents.title,
+				access.role,
+				documents.updated_at,
+				users.name as owner_name,
+				documents.user_id as owner_id,
+				ts_rank(documents.title_tsv, search_query) as title_rank,
+				coalesce(ts_rank(documents.content_tsv, search_query), 0) as content_rank
+			`).
+		Joins(userAccessSQL, userID).
+		Joins("JOIN users ON users.id = documents.user_id").
+		Joins("CROSS JOIN websearch_to_tsquery('simple', ?) AS search_query", query).
+		Where("documents.title_tsv @@ search_query OR documents.content_tsv @@ search_query")
+
+	// Count total records
+	if err := data.Count(&totalRecords).Error; err != nil {
+		return docs, DocumentsMeta{}, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := data.Offset(offset).
+		Limit(pageSize).
+		Order("title_rank DESC, content_rank DESC, documents.updated_at DESC").
+		Find(&docs).Error
+	if err != nil {
+		return docs, DocumentsMeta{}, err
+	}
+
+	totalPages := int((totalRecords + int64(pageSize) - 1) / int64(pageSize))
+
+	return docs, DocumentsMeta{
+		Total:       totalRecords,
+		PerPage:     pageSize,
+		TotalPage:   totalPages,
+		CurrentPage: page,
+	}, err
+}
+
+// CompressLegacyRows rewrites up to limit snapshots and updates stored before
+// compression, with the configured codec and a checksum. Every row it reads gets a codec,
+// "none" when compressing did not help, so it returns 0 once no legacy row is
+// left. A row deleted or rewritten concurrently is left alone, and one that
+// can't be read is logged and marked unreadable so later batches skip it.
+func (r *DocumentRepositoryImpl) CompressLegacyRows(ctx context.Context, limit int) (int, error) {
+	var snapshots []domain.DocumentSnapshot
+	if err := r.db.WithContext(ctx).
+		Where("codec = ?", codec.Legacy).
+		Order("id").
+		Limit(limit).
+		Find(&snapshots).Error; err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for i := range snapshots {
+		s := &snapshots[i]
+		oldKey := s.BlobKey
+		if err := r.loadSnapshotBinary(ctx, s); err != nil {
+			if err := r.markUnreadable(ctx, &domain.DocumentSnapshot{}, s.ID, err); err != nil {
+				return done, err
+			}
+			done++
+			continue
+		}
+		bin, err := r.storeBinary(ctx, s.DocumentID, "snapshots", s.SnapshotBinary)
+		if err != nil {
+			return done, err
+		}
+
+		result := r.db.WithContext(ctx).Model(&domain.DocumentSnapshot{}).
+			Where("id = ? AND codec = ?", s.ID, codec.Legacy).
+			Updates(map[string]any{
+				"snapshot_binary": bin.data,
+				"blob_key":        bin.blobKey,
+				"checksum":        bin.checksum,
+				"codec":           bin.codec,
+			})
+		if err := r.afterRewrite(ctx, result, oldKey, bin); err != nil {
+			return done, err
+		}
+		done++
+	}
+	if done == limit {
+		return done, nil
+	}
+
+	var updates []domain.DocumentUpdate
+	if err := r.db.WithContext(ctx).
+		Where("codec = ?", codec.Legacy).
+		Order("id").
+		Limit(limit - done).
+		Find(&updates).Error; err != nil {
+		return done, err
+	}
+
+	for i := range updates {
+		u := &updates[i]
+		oldKey := u.BlobKey
+		if err := r.loadUpdateBinaries(ctx, updates[i:i+1]); err != nil {
+			if err := r.markUnreadable(ctx, &domain.DocumentUpdate{}, u.ID, err); err != nil {
+				return done, err
+			}
+			done++
+			continue
+		}
+		bin, err := r.storeBinary(ctx, u.DocumentID, "updates", u.UpdateBinary)
+		if err != nil {
+			return done, err
+		}
+
+		result := r.db.WithContext(ctx).Model(&domain.DocumentUpdate{}).
+			Where("id = ? AND codec = ?", u.ID, codec.Legacy).
+			Updates(map[string]any{
+				"update_binary": bin.data,
+				"blob_key":      bin.blobKey,
+				"checksum":      bin.checksum,
+				"codec":         bin.codec,
+				"size":          len(u.UpdateBinary),
+			})
+		if err := r.afterRewrite(ctx, result, oldKey, bin); err != nil {
+			return done, err
+		}
+		done++
+	}
+
+	return done, nil
+}
+
+// markUnreadable gives a legacy row that failed to load with cause the
+// Unreadable codec, its binary is left as is for cmd/verify to report. Errors
+// other than a corrupt binary or a missing blob, like an unreachable blob
+// store, are returned instead.
+func (r *DocumentRepositoryImpl) markUnreadable(ctx context.Context, model any, id uint64, cause error) error {
+	if !defError.Is(cause, ErrCorruptBinary) && !defError.Is(cause, blob.ErrNotFound) {
+		return cause
+	}
+	log.Error().Err(cause).Msg("Legacy row can't be read, skipping it")
+	return r.db.WithContext(ctx).Model(model).
+		Where("id = ? AND codec = ?", id, codec.Legacy).
+		Update("codec", codec.Unreadable).Error
+}
+
+// afterRewrite deletes the blob the rewritten row no longer uses, or the new
+// one when the row was not rewritten
+func (r *DocumentRepositoryImpl) afterRewrite(ctx context.Context, result *gorm.DB, oldKey *string, bin storedBinary) error {
+	if result.Error != nil || result.RowsAffected == 0 {
+		r.discardBlobs(ctx, blobKeys([]storedBinary{bin}, nil))
+		return result.Error
+	}
+	if oldKey != nil {
+		r.discardBlobs(ctx, []string{*oldKey})
+	}
+	return nil
+}
+
+// BinaryIssue is a stored snapshot or update that can't be read back
+type BinaryIssue struct {
+	Kind       string // "snapshot" or "update"
+	DocumentID uint64
+	Seq        uint64
+	Err        error
+}
+
+// verifyBatchSize is how many rows VerifyDocument loads at once
+const verifyBatchSize = 100
+
+// VerifyDocument reads back every snapshot and update of a document and
+// returns the ones that are corrupt or whose blob is missing. It also returns
+// how many rows were written before checksums, which are only checked to be
+// readable.
+func (r *DocumentRepositoryImpl) VerifyDocument(ctx context.Context, docID uint64) ([]BinaryIssue, int, error) {
+	var issues []BinaryIssue
+	unchecked := 0
+
+	check := func(kind string, seq uint64, checksum string, err error) error {
+		if checksum == "" {
+			unchecked++
+		}
+		if err == nil {
+			return nil
+		}
+		if !defError.Is(err, ErrCorruptBinary) && !defError.Is(err, blob.ErrNotFound) {
+			return err
+		}
+		issues = append(issues, BinaryIssue{Kind: kind, DocumentID: docID, Seq: seq, Err: err})
+		return nil
+	}
+
+	var afterSeq uint64
+	for {
+		var snapshots []domain.DocumentSnapshot
+		if err := r.db.WithContext(ctx).
+			Where("document_id = ? AND seq > ?", docID, afterSeq).
+			Order("seq").
+			Limit(verifyBatchSize).
+			Find(&snapshots).Error; err != nil {
+			return nil, 0, err
+		}
+		for i := range snapshots {
+			s := &snapshots[i]
+			if err := check("snapshot", s.Seq, s.Checksum, r.loadSnapshotBinary(ctx, s)); err != nil {
+				return nil, 0, err
+			}
+			afterSeq = s.Seq
+		}
+		if len(snapshots) < verifyBatchSize {
+			break
+		}
+	}
+
+	afterSeq = 0
+	for {
+		var updates []domain.DocumentUpdate
+		if err := r.db.WithContext(ctx).
+			Where("document_id = ? AND seq > ?", docID, afterSeq).
+			Order("seq").
+			Limit(verifyBatchSize).
+			Find(&updates).Error; err != nil {
+			return nil, 0, err
+		}
+		for i := range updates {
+			u := &updates[i]
+			if err := check("update", u.Seq, u.Checksum, r.loadUpdateBinaries(ctx, updates[i:i+1])); err != nil {
+				return nil, 0, err
+			}
+			afterSeq = u.Seq
+		}
+		if len(updates) < verifyBatchSize {
+			break
+		}
+	}
+
+	return issues, unchecked, nil
 }
@@ -0,0 +1,640 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"collaborative-markdown-editor/internal/blob"
+	"collaborative-markdown-editor/internal/codec"
+	"collaborative-markdown-editor/internal/domain"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newBinaryRepo(t *testing.T, threshold int) *DocumentRepositoryImpl {
+	store, err := blob.NewFSStore(t.TempDir())
+	assert.NoError(t, err)
+	return &DocumentRepositoryImpl{
+		blobs:       BlobOffload{Store: store, Threshold: threshold},
+		compression: Compression{Codec: codec.Zstd, MinSize: 64},
+	}
+}
+
+// newSQLRepo returns a repository on a mocked database, queries are expected
+// in order
+func newSQLRepo(t *testing.T, retention HistoryRetention) (*DocumentRepositoryImpl, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+
+	repo := newBinaryRepo(t, 0)
+	repo.db = db
+	repo.retention = retention
+	return repo, mock
+}
+
+// sql matches a query by its fragments, in order
+func sql(fragments ...string) string {
+	for i, f := range fragments {
+		fragments[i] = regexp.QuoteMeta(f)
+	}
+	return strings.Join(fragments, ".*")
+}
+
+// TestStoreBinary_RoundTrip tests that stored binaries read back raw, whether
+// kept inline or offloaded
+func TestStoreBinary_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	raw := bytes.Repeat([]byte("yjs update "), 100)
+
+	for _, threshold := range []int{0, 16} {
+		repo := newBinaryRepo(t, threshold)
+
+		bin, err := repo.storeBinary(ctx, 1, "snapshots", raw)
+		assert.NoError(t, err)
+		assert.Equal(t, codec.Zstd, bin.codec)
+		assert.NotEmpty(t, bin.checksum)
+		assert.Equal(t, threshold > 0, bin.blobKey != nil)
+
+		data, err := repo.loadBinary(ctx, bin.data, bin.blobKey, bin.checksum, bin.codec)
+		assert.NoError(t, err)
+		assert.Equal(t, raw, data)
+	}
+}
+
+// TestLoadBinary_Corrupt tests that a binary that does not match its checksum
+// is rejected, and that legacy rows without checksum are read as is
+func TestLoadBinary_Corrupt(t *testing.T) {
+	ctx := context.Background()
+	repo := newBinaryRepo(t, 0)
+
+	bin, err := repo.storeBinary(ctx, 1, "updates", []byte("short update"))
+	assert.NoError(t, err)
+	assert.Equal(t, codec.None, bin.codec)
+
+	corrupt := append([]byte{}, bin.data...)
+	corrupt[0] ^= 0xff
+	_, err = repo.loadBinary(ctx, corrupt, nil, bin.checksum, bin.codec)
+	assert.ErrorIs(t, err, ErrCorruptBinary)
+
+	data, err := repo.loadBinary(ctx, corrupt, nil, "", codec.Legacy)
+	assert.NoError(t, err)
+	assert.Equal(t, corrupt, data)
+}
+
+// TestLoadBinary_MissingBlob tests an offloaded binary whose blob is gone
+func TestLoadBinary_MissingBlob(t *testing.T) {
+	ctx := context.Background()
+	repo := newBinaryRepo(t, 1)
+
+	bin, err := repo.storeBinary(ctx, 1, "updates", []byte("offloaded update"))
+	assert.NoError(t, err)
+	repo.discardBlobs(ctx, []string{*bin.blobKey})
+
+	_, err = repo.loadBinary(ctx, bin.data, bin.blobKey, bin.checksum, bin.codec)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+}
+
+// TestCreateUpdate_RetryAfterSnapshot tests that a retried update is found by
+// its key once the snapshot compacted the update away, and gets its first seq
+func TestCreateUpdate_RetryAfterSnapshot(t *testing.T) {
+	ctx := context.Background()
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+	content := []byte("update")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(sql("SELECT true FROM documents", "FOR UPDATE")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"bool"}).AddRow(true))
+	mock.ExpectQuery(sql(`FROM "document_update_keys"`, "update_key IN")).
+		WithArgs(1, "id:retry-1").
+		WillReturnRows(sqlmock.NewRows([]string{"document_id", "update_key", "seq"}))
+	mock.ExpectQuery(sql("UPDATE documents", "RETURNING update_seq")).
+		WillReturnRows(sqlmock.NewRows([]string{"update_seq"}).AddRow(5))
+	mock.ExpectQuery(sql(`INSERT INTO "document_updates"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(50))
+	mock.ExpectExec(sql(`INSERT INTO "document_update_keys"`)).
+		WithArgs(1, "id:retry-1", 5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	seq, err := repo.CreateUpdate(ctx, 1, 2, content, "id:retry-1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), seq)
+
+	// the snapshot deletes the update, the key is not touched
+	mock.ExpectBegin()
+	mock.ExpectQuery(sql(`SELECT "update_seq" FROM "documents"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"update_seq"}).AddRow(5))
+	mock.ExpectQuery(sql(`FROM "document_snapshots"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(sql(`INSERT INTO "document_snapshots"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(sql(`UPDATE "documents" SET "pending_since"=$1,"snapshot_attempt_at"=$2`, "update_seq <= $4")).
+		WithArgs(nil, nil, 1, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(sql("DELETE FROM document_updates")).
+		WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"blob_key"}))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.CreateSnapshot(ctx, 1, []byte("state")))
+
+	// the retry stores nothing
+	mock.ExpectBegin()
+	mock.ExpectQuery(sql("SELECT true FROM documents", "FOR UPDATE")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"bool"}).AddRow(true))
+	mock.ExpectQuery(sql(`FROM "document_update_keys"`, "update_key IN")).
+		WithArgs(1, "id:retry-1").
+		WillReturnRows(sqlmock.NewRows([]string{"document_id", "update_key", "seq"}).AddRow(1, "id:retry-1", 5))
+	mock.ExpectCommit()
+
+	seq, err = repo.CreateUpdate(ctx, 1, 2, content, "id:retry-1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), seq)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// keptArg matches any string argument and keeps it
+type keptArg struct{ value *string }
+
+func (a keptArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*a.value = s
+	return ok
+}
+
+// TestCompressLegacyHistory tests that the job rewrites legacy rows until none
+// is left, and that a row rewritten concurrently keeps its binary while the
+// blob written for it is discarded
+func TestCompressLegacyHistory(t *testing.T) {
+	ctx := context.Background()
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+	repo.blobs.Threshold = 16
+	raw := bytes.Repeat([]byte("legacy update "), 100)
+	columns := []string{"id", "document_id", "seq", "snapshot_binary", "blob_key", "checksum", "codec"}
+	updateColumns := []string{"id", "document_id", "seq", "update_binary", "blob_key", "checksum", "codec", "user_id"}
+
+	var snapshotKey, updateKey, lostKey string
+	mock.ExpectQuery(sql(`FROM "document_snapshots" WHERE codec = $1`)).
+		WithArgs("", 10).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 1, 5, raw, nil, "", ""))
+	mock.ExpectBegin()
+	mock.ExpectExec(sql(`UPDATE "document_snapshots" SET`, "WHERE id = $5 AND codec = $6")).
+		WithArgs(keptArg{&snapshotKey}, sqlmock.AnyArg(), codec.Zstd, []byte{}, 1, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(sql(`FROM "document_updates" WHERE codec = $1`)).
+		WithArgs("", 9).
+		WillReturnRows(sqlmock.NewRows(updateColumns).
+			AddRow(10, 1, 6, raw, nil, "", "", 2).
+			AddRow(11, 1, 7, raw, nil, "", "", 2))
+	mock.ExpectBegin()
+	mock.ExpectExec(sql(`UPDATE "document_updates" SET`, "WHERE id = $6 AND codec = $7")).
+		WithArgs(keptArg{&updateKey}, sqlmock.AnyArg(), codec.Zstd, len(raw), []byte{}, 10, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// rewritten since it was read
+	mock.ExpectBegin()
+	mock.ExpectExec(sql(`UPDATE "document_updates" SET`, "WHERE id = $6 AND codec = $7")).
+		WithArgs(keptArg{&lostKey}, sqlmock.AnyArg(), codec.Zstd, len(raw), []byte{}, 11, "").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	// nothing left
+	mock.ExpectQuery(sql(`FROM "document_snapshots" WHERE codec = $1`)).
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(sql(`FROM "document_updates" WHERE codec = $1`)).
+		WillReturnRows(sqlmock.NewRows(updateColumns))
+
+	err := CompressLegacyHistory(ctx, repo, 10, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	for _, key := range []string{snapshotKey, updateKey} {
+		data, err := repo.loadBinary(ctx, nil, &key, "", codec.Zstd)
+		assert.NoError(t, err)
+		assert.Equal(t, raw, data)
+	}
+	assert.NotEmpty(t, lostKey)
+	_, err = repo.blobs.Store.Get(ctx, lostKey)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+}
+
+// TestCompressLegacyRows_Unreadable tests that a legacy row whose blob is gone
+// is marked and skipped, and the batch goes on
+func TestCompressLegacyRows_Unreadable(t *testing.T) {
+	ctx := context.Background()
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+	updateColumns := []string{"id", "document_id", "seq", "update_binary", "blob_key", "checksum", "codec", "user_id"}
+	missing := "documents/1/updates/missing"
+
+	mock.ExpectQuery(sql(`FROM "document_snapshots" WHERE codec = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(sql(`FROM "document_updates" WHERE codec = $1`)).
+		WillReturnRows(sqlmock.NewRows(updateColumns).
+			AddRow(10, 1, 6, []byte{}, missing, "", "", 2).
+			AddRow(11, 1, 7, []byte("update"), nil, "", "", 2))
+	mock.ExpectBegin()
+	mock.ExpectExec(sql(`UPDATE "document_updates" SET "codec"=$1`, "WHERE id = $2 AND codec = $3")).
+		WithArgs(codec.Unreadable, 10, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(sql(`UPDATE "document_updates" SET`, "WHERE id = $6 AND codec = $7")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), codec.None, 6, []byte("update"), 11, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := repo.CompressLegacyRows(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectCorruptLatestSnapshot expects the reads of LastSnapshot when the
+// snapshot at seq 10 is corrupt and the previous one is at seq 4
+func expectCorruptLatestSnapshot(t *testing.T, repo *DocumentRepositoryImpl, mock sqlmock.Sqlmock, storedUpdates int) []byte {
+	columns := []string{"id", "document_id", "seq", "snapshot_binary", "blob_key", "checksum", "codec"}
+	state := []byte("previous state")
+	previous, err := repo.storeBinary(context.Background(), 1, "snapshots", state)
+	assert.NoError(t, err)
+	latest, err := repo.storeBinary(context.Background(), 1, "snapshots", []byte("latest state"))
+	assert.NoError(t, err)
+	latest.data[0] ^= 0xff
+
+	mock.ExpectQuery(sql(`FROM "document_snapshots" WHERE document_id = $1 ORDER BY seq DESC`)).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2, 1, 10, latest.data, nil, latest.checksum, latest.codec))
+	mock.ExpectQuery(sql(`FROM "document_snapshots" WHERE document_id = $1 AND seq < $2`)).
+		WithArgs(1, 10, 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 1, 4, previous.data, nil, previous.checksum, previous.codec))
+	mock.ExpectQuery(sql(`SELECT count(*) FROM "document_updates"`, "seq > $2 AND seq <= $3")).
+		WithArgs(1, 4, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(storedUpdates))
+	return state
+}
+
+// TestLastSnapshot_CorruptFallsBack tests that a corrupt latest snapshot is
+// replaced by the previous one when the updates in between are stored
+func TestLastSnapshot_CorruptFallsBack(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{MaxSnapshots: 2})
+	state := expectCorruptLatestSnapshot(t, repo, mock, 6)
+
+	var snapshot domain.DocumentSnapshot
+	err := repo.LastSnapshot(context.Background(), 1, &snapshot)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), snapshot.Seq)
+	assert.Equal(t, state, snapshot.SnapshotBinary)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestLastSnapshot_CorruptUpdatesMissing tests that a corrupt latest snapshot
+// fails the read when some updates since the previous one were compacted
+func TestLastSnapshot_CorruptUpdatesMissing(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{MaxSnapshots: 2})
+	expectCorruptLatestSnapshot(t, repo, mock, 2)
+
+	var snapshot domain.DocumentSnapshot
+	err := repo.LastSnapshot(context.Background(), 1, &snapshot)
+
+	assert.ErrorIs(t, err, ErrCorruptBinary)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCreateUpdates_WithoutKeys tests that every content is stored when no
+// keys are given, and that keys not matching the contents are rejected
+func TestCreateUpdates_WithoutKeys(t *testing.T) {
+	ctx := context.Background()
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+	contents := [][]byte{[]byte("first"), []byte("second")}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(sql("SELECT true FROM documents", "FOR UPDATE")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"bool"}).AddRow(true))
+	mock.ExpectQuery(sql("UPDATE documents", "RETURNING update_seq")).
+		WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"update_seq"}).AddRow(8))
+	mock.ExpectQuery(sql(`INSERT INTO "document_updates"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(70).AddRow(71))
+	mock.ExpectCommit()
+
+	seqs, err := repo.CreateUpdates(ctx, 1, 2, contents, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{7, 8}, seqs)
+
+	_, err = repo.CreateUpdates(ctx, 1, 2, contents, []string{"id:only-one"})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSnapshotCandidates_Claims tests that due documents are claimed, and that
+// documents claimed within retryAfter are skipped
+func TestSnapshotCandidates_Claims(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	defaults := SnapshotPolicy{IdleAfter: 10 * time.Minute, MaxAge: time.Hour}
+
+	mock.ExpectQuery(sql(
+		"WITH due AS",
+		"d.snapshot_attempt_at IS NULL OR d.snapshot_attempt_at <= $1::timestamptz - $2 * interval '1 second'",
+		"LIMIT $9",
+		"UPDATE documents d SET snapshot_attempt_at = $10",
+		"RETURNING d.id",
+	)).
+		WithArgs(now, 300, 600, now, 600, 3600, now, 3600, 50, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4).AddRow(2))
+
+	ids, err := repo.SnapshotCandidates(context.Background(), defaults, now, 5*time.Minute, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{4, 2}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// failingStore is a blob store whose writes fail
+type failingStore struct{ blob.BlobStore }
+
+func (failingStore) Put(ctx context.Context, key string, data []byte) error {
+	return errors.New("store unavailable")
+}
+
+// TestCreateImported_OffloadsBeforeTransaction tests that the snapshots of
+// imported documents are offloaded under their reserved ids before the
+// transaction is opened
+func TestCreateImported_OffloadsBeforeTransaction(t *testing.T) {
+	ctx := context.Background()
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+	repo.blobs.Threshold = 16
+	state := bytes.Repeat([]byte("imported state "), 100)
+
+	var key string
+	mock.ExpectQuery(sql("SELECT nextval(pg_get_serial_sequence('documents', 'id'))", "generate_series(1, $1)")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(41))
+	mock.ExpectBegin()
+	mock.ExpectQuery(sql(`INSERT INTO "documents"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(41))
+	mock.ExpectExec(sql(`INSERT INTO "document_collaborators"`)).
+		WithArgs(41, 2, "owner", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(sql(`INSERT INTO "document_snapshots"`)).
+		WithArgs(41, 0, []byte{}, keptArg{&key}, sqlmock.AnyArg(), codec.Zstd, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(sql("UPDATE documents SET content_tsv")).
+		WithArgs("imported", 41).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	documents := []domain.Document{{Title: "Imported"}}
+	err := repo.CreateImported(ctx, 2, documents, [][]byte{state}, []string{"imported"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(41), documents[0].ID)
+	assert.True(t, strings.HasPrefix(key, "documents/41/snapshots/"))
+	data, err := repo.loadBinary(ctx, nil, &key, "", codec.Zstd)
+	assert.NoError(t, err)
+	assert.Equal(t, state, data)
+
+	// a failed upload never opens the transaction
+	repo.blobs.Store = failingStore{repo.blobs.Store}
+	mock.ExpectQuery(sql("SELECT nextval")).
+		WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(42))
+
+	err = repo.CreateImported(ctx, 2, []domain.Document{{Title: "Lost"}}, [][]byte{state}, []string{"lost"})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectLockedShareLink expects the share link 5 of document 1 to be locked
+// and read with uses and maxUses (nil for no limit), then the current role of
+// user 3
+func expectLockedShareLink(mock sqlmock.Sqlmock, role string, uses int, maxUses any, current string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(sql(`SELECT * FROM "document_share_links" WHERE "document_share_links"."id" = $1`, "FOR UPDATE")).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "document_id", "role", "uses", "max_uses"}).
+			AddRow(5, 1, role, uses, maxUses))
+	rows := sqlmock.NewRows([]string{"role"})
+	if current != "" {
+		rows.AddRow(current)
+	}
+	mock.ExpectQuery(sql(`SELECT "role" FROM "document_collaborators"`, "document_id = $1 AND user_id = $2")).
+		WithArgs(1, 3).
+		WillReturnRows(rows)
+}
+
+// TestRedeemShareLink_NewCollaborator tests that redeeming a link under its
+// lock adds the user and counts a use
+func TestRedeemShareLink_NewCollaborator(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+
+	expectLockedShareLink(mock, "viewer", 1, 2, "")
+	mock.ExpectExec(sql(`INSERT INTO "document_collaborators"`)).
+		WithArgs(1, 3, "viewer", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(sql(`UPDATE "document_share_links" SET "uses"=uses + 1`, `"id" = $1`)).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	role, changed, err := repo.RedeemShareLink(context.Background(), 5, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "viewer", role)
+	assert.True(t, changed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRedeemShareLink_UpgradesViewer tests that an editor link upgrades a
+// viewer and counts a use
+func TestRedeemShareLink_UpgradesViewer(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+
+	expectLockedShareLink(mock, "editor", 0, nil, "viewer")
+	mock.ExpectExec(sql(`UPDATE "document_collaborators" SET "role"=$1`, "document_id = $2 AND user_id = $3")).
+		WithArgs("editor", 1, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(sql(`UPDATE "document_share_links" SET "uses"=uses + 1`)).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	role, changed, err := repo.RedeemShareLink(context.Background(), 5, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "editor", role)
+	assert.True(t, changed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRedeemShareLink_KeepsAccess tests that owners and editors are never
+// downgraded by a link, and don't use it up
+func TestRedeemShareLink_KeepsAccess(t *testing.T) {
+	for _, current := range []string{"owner", "editor", "viewer"} {
+		repo, mock := newSQLRepo(t, HistoryRetention{})
+
+		// used up, but not needed
+		expectLockedShareLink(mock, "viewer", 2, 2, current)
+		mock.ExpectCommit()
+
+		role, changed, err := repo.RedeemShareLink(context.Background(), 5, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, current, role)
+		assert.False(t, changed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+// TestRedeemShareLink_UsedUp tests that a link at its max uses, as read under
+// the lock, adds no one
+func TestRedeemShareLink_UsedUp(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+
+	expectLockedShareLink(mock, "editor", 2, 2, "viewer")
+	mock.ExpectRollback()
+
+	_, changed, err := repo.RedeemShareLink(context.Background(), 5, 3)
+	assert.ErrorIs(t, err, ErrShareLinkUsedUp)
+	assert.False(t, changed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetUserRole_HighestGrant tests that the role of a user is the highest of
+// their direct, team and workspace grants
+func TestGetUserRole_HighestGrant(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+	grants := sql("SELECT grants.role",
+		"FROM document_collaborators", "JOIN team_members", "JOIN workspace_members",
+		"WHERE grants.document_id = $1 AND grants.user_id = $2")
+
+	mock.ExpectQuery(grants).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("viewer").AddRow("editor").AddRow("viewer"))
+	mock.ExpectQuery(grants).
+		WithArgs(1, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("editor").AddRow("owner"))
+	mock.ExpectQuery(grants).
+		WithArgs(1, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}))
+
+	for _, tc := range []struct {
+		userID uint64
+		want   string
+	}{{2, "editor"}, {3, "owner"}, {4, "none"}} {
+		role, err := repo.GetUserRole(context.Background(), 1, tc.userID)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, role, "user %d", tc.userID)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestEffectiveRoles tests that every user gets their highest role on every
+// document, "none" without grant
+func TestEffectiveRoles(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+
+	mock.ExpectQuery(sql("SELECT grants.document_id, grants.user_id, grants.role",
+		"WHERE grants.document_id IN ($1,$2) AND grants.user_id IN ($3,$4)")).
+		WithArgs(1, 2, 5, 6).
+		WillReturnRows(sqlmock.NewRows([]string{"document_id", "user_id", "role"}).
+			AddRow(1, 5, "editor").
+			AddRow(1, 5, "viewer").
+			AddRow(2, 5, "viewer").
+			AddRow(2, 6, "viewer").
+			AddRow(2, 6, "owner"))
+
+	rows, err := repo.EffectiveRoles(context.Background(), []uint64{1, 2}, []uint64{5, 6})
+	assert.NoError(t, err)
+	assert.Equal(t, []userRoleRow{
+		{DocumentID: 1, UserID: 5, Role: "editor"},
+		{DocumentID: 1, UserID: 6, Role: "none"},
+		{DocumentID: 2, UserID: 5, Role: "viewer"},
+		{DocumentID: 2, UserID: 6, Role: "owner"},
+	}, rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectLockedOwner expects document 1 to be locked while user 2 owns it
+func expectLockedOwner(mock sqlmock.Sqlmock, owned bool) {
+	rows := sqlmock.NewRows([]string{"id"})
+	if owned {
+		rows.AddRow(1)
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(sql(`SELECT "id" FROM "documents" WHERE id = $1 AND user_id = $2`, "FOR UPDATE")).
+		WithArgs(1, 2, 1).
+		WillReturnRows(rows)
+}
+
+// TestTransferOwnership tests that the roles of both users are swapped and
+// the document changes owner in one transaction
+func TestTransferOwnership(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+
+	expectLockedOwner(mock, true)
+	mock.ExpectExec(sql(`UPDATE "document_collaborators" SET "role"=$1`, "document_id = $2 AND user_id = $3 AND role = $4")).
+		WithArgs("owner", 1, 3, "editor").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(sql(`UPDATE "document_collaborators" SET "role"=$1`, "document_id = $2 AND user_id = $3 AND role = $4")).
+		WithArgs("editor", 1, 2, "owner").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(sql(`UPDATE "documents" SET "user_id"=$1`, "id = $3")).
+		WithArgs(3, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.TransferOwnership(context.Background(), 1, 2, 3))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTransferOwnership_Rejected tests that nothing changes when the new
+// owner is not a direct editor, the creator lost the owner role or the owner
+// changed meanwhile
+func TestTransferOwnership_Rejected(t *testing.T) {
+	repo, mock := newSQLRepo(t, HistoryRetention{})
+
+	expectLockedOwner(mock, true)
+	mock.ExpectExec(sql(`UPDATE "document_collaborators" SET "role"=$1`)).
+		WithArgs("owner", 1, 3, "editor").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := repo.TransferOwnership(context.Background(), 1, 2, 3)
+	assert.ErrorIs(t, err, ErrNotEditor)
+
+	// a workspace admin demoted the creator
+	expectLockedOwner(mock, true)
+	mock.ExpectExec(sql(`UPDATE "document_collaborators" SET "role"=$1`)).
+		WithArgs("owner", 1, 3, "editor").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(sql(`UPDATE "document_collaborators" SET "role"=$1`)).
+		WithArgs("editor", 1, 2, "owner").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = repo.TransferOwnership(context.Background(), 1, 2, 3)
+	assert.ErrorIs(t, err, ErrNotOwner)
+
+	expectLockedOwner(mock, false)
+	mock.ExpectRollback()
+
+	err = repo.TransferOwnership(context.Background(), 1, 2, 3)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
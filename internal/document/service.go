@@ -3,36 +3,83 @@ package document
 import (
 	"collaborative-markdown-editor/internal/domain"
 	"collaborative-markdown-editor/internal/errors"
+	"collaborative-markdown-editor/internal/markdown"
 	"collaborative-markdown-editor/internal/notification"
 	"collaborative-markdown-editor/internal/sync"
 	"collaborative-markdown-editor/internal/worker"
+	"collaborative-markdown-editor/internal/yjs"
 	"collaborative-markdown-editor/redis"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	defError "errors"
 	"fmt"
+	"math/rand/v2"
+	"path"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 	"gorm.io/gorm"
+	log "github.com/rs/zerolog/log"
 )
 
 type Service interface {
 	CreateUserDocument(ctx context.Context, userID uint64, document *domain.Document) error
+	MoveToWorkspace(ctx context.Context, docID uint64, userID uint64, workspaceID uint64) error
 	RenameDocument(ctx context.Context, docID uint64, userID uint64, title string) (*domain.Document, error)
-	CreateDocumentUpdate(ctx context.Context, id uint64, userID uint64, content []byte) error
-	GetUserDocuments(ctx context.Context, userID uint64, page, pageSize int) (*PaginatedDocuments, error)
-	GetSharedDocuments(ctx context.Context, userId uint64, page, pageSize int) (*PaginatedDocuments, error)
+	CreateDocumentUpdate(ctx context.Context, id uint64, userID uint64, content []byte, updateID string) (uint64, error)
+	CreateDocumentUpdates(ctx context.Context, docID uint64, userID uint64, updates [][]byte, updateIDs []string) ([]uint64, error)
+	GetUserDocuments(ctx context.Context, userID uint64, page, pageSize int, filter DocumentListFilter) (*PaginatedDocuments, error)
+	GetSharedDocuments(ctx context.Context, userId uint64, page, pageSize int, filter DocumentListFilter) (*PaginatedDocuments, error)
+	GetUserDocumentsAfter(ctx context.Context, userID uint64, cursor string, pageSize int, filter DocumentListFilter) (*CursorDocuments, error)
+	GetSharedDocumentsAfter(ctx context.Context, userID uint64, cursor string, pageSize int, filter DocumentListFilter) (*CursorDocuments, error)
+	ListDocumentUpdates(ctx context.Context, docID uint64, cursor string, limit int) (*DocumentUpdatePage, error)
 	GetDocumentByID(ctx context.Context, docID uint64, userID uint64) (*DocumentShowResponse, error)
 	GetDocumentState(ctx context.Context, docID uint64) (*DocumentStateResponse, error)
+	GetDocumentStateSince(ctx context.Context, docID uint64, sinceSeq uint64) (*DocumentStateResponse, error)
+	GetDocumentStatePage(ctx context.Context, docID uint64, afterSeq uint64, limit int) (*DocumentStateResponse, error)
+	StreamDocumentState(ctx context.Context, docID uint64, send func(page *DocumentStateResponse) error) error
 	CreateDocumentSnapshot(ctx context.Context, docID uint64, state []byte) error
-	FetchUserRole(ctx context.Context, docID, userID uint64) (string, error)
+	FetchUserRole(ctx context.Context, docID, userID uint64, share *ShareCredentials) (string, error)
 	ListCollaborators(ctx context.Context, docID uint64, requesterID uint64) ([]DocumentCollaboratorDTO, error)
 	AddCollaborator(ctx context.Context, docID uint64, requesterID uint64, targetUserID uint64, role string) (*DocumentCollaboratorDTO, error)
 	ChangeCollaboratorRole(ctx context.Context, docID uint64, requesterID uint64, targetUserID uint64, newRole string) (*DocumentCollaboratorDTO, error)
 	RemoveCollaborator(ctx context.Context, docID uint64, requesterID uint64, targetUserID uint64) error
+	TransferOwnership(ctx context.Context, docID uint64, requesterID uint64, newOwnerID uint64) error
+	CreateShareLink(ctx context.Context, docID uint64, userID uint64, opts ShareLinkOptions) (*ShareLinkDTO, error)
+	ListShareLinks(ctx context.Context, docID uint64, userID uint64) ([]ShareLinkDTO, error)
+	RevokeShareLink(ctx context.Context, docID uint64, userID uint64, linkID uint64) error
+	GetShareLink(ctx context.Context, token string) (*ShareLinkPreview, error)
+	RedeemShareLink(ctx context.Context, token string, userID uint64, password string) (*ShareLinkRedemption, error)
+	InviteCollaborator(ctx context.Context, docID uint64, requesterID uint64, email string, role string) (*InvitationDTO, error)
+	ListInvitations(ctx context.Context, docID uint64, requesterID uint64) ([]InvitationDTO, error)
+	RevokeInvitation(ctx context.Context, docID uint64, requesterID uint64, invitationID uint64) error
+	AcceptInvitation(ctx context.Context, token string, userID uint64) (*InvitationAcceptance, error)
+	GrantTeam(ctx context.Context, docID uint64, requesterID uint64, teamID uint64, role string) (*TeamGrantDTO, error)
+	ListTeamGrants(ctx context.Context, docID uint64, requesterID uint64) ([]TeamGrantDTO, error)
+	RevokeTeamGrant(ctx context.Context, docID uint64, requesterID uint64, teamID uint64) error
+	NotifyAccessChanged(ctx context.Context, docIDs []uint64, userIDs []uint64)
+	NotifyOwnershipChanged(ctx context.Context, docIDs []uint64, userIDs []uint64)
 	DeleteDocument(ctx context.Context, docID uint64, userID uint64) error
+	CreateDocumentVersion(ctx context.Context, docID uint64, userID uint64, name string) (*DocumentVersionDTO, error)
+	ListDocumentVersions(ctx context.Context, docID uint64, userID uint64) ([]DocumentVersionDTO, error)
+	GetDocumentVersionState(ctx context.Context, docID uint64, versionID uint64, userID uint64) (*DocumentStateResponse, error)
+	GetDocumentStateAt(ctx context.Context, docID uint64, seq uint64, userID uint64) (*DocumentStateResponse, error)
+	RestoreDocumentVersion(ctx context.Context, docID uint64, versionID uint64, userID uint64) (*RestoreResponse, error)
+	GetDocumentContent(ctx context.Context, docID uint64, userID uint64) (*DocumentContentResponse, error)
+	ExportDocument(ctx context.Context, docID uint64, userID uint64, format string) (*DocumentExport, error)
+	ImportDocuments(ctx context.Context, userID uint64, files []ImportFile) ([]domain.Document, error)
+	SearchDocuments(ctx context.Context, userID uint64, query string, page, pageSize int) (*PaginatedSearchResults, error)
+	GetSnapshotPolicy(ctx context.Context, docID uint64, userID uint64) (*SnapshotPolicyResponse, error)
+	UpdateSnapshotPolicy(ctx context.Context, docID uint64, userID uint64, dto SnapshotPolicyDTO) (*SnapshotPolicyResponse, error)
+	ScheduleSnapshots(ctx context.Context) (int, error)
 }
 
 type UserProvider interface {
 	GetUserByID(ctx context.Context, id uint64) (*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
 }
 
 type DefaultService struct {
@@ -40,9 +87,13 @@ type DefaultService struct {
 	syncClient        *sync.SyncClient
 	userProvider      UserProvider
 	cache             *redis.Cache
-	snapshotThreshold uint64
+	snapshotPolicy    SnapshotPolicy
+	textName          string
 	workerPool        *worker.WorkerPool
 	noficationService *notification.Service
+	invitations       Invitations
+	// deduplicate updates sent without id by their content
+	dedupByContent    bool
 }
 
 func NewService(
@@ -50,38 +101,167 @@ func NewService(
 	userProvider UserProvider,
 	syncClient *sync.SyncClient,
 	cache *redis.Cache,
-	snapshotThreshold uint64,
+	snapshotPolicy SnapshotPolicy,
+	textName string,
 	wp *worker.WorkerPool,
 	noficationService *notification.Service,
+	invitations Invitations,
+	dedupByContent bool,
 ) Service {
 	return &DefaultService{
 		repository:        repository,
 		syncClient:        syncClient,
 		userProvider:      userProvider,
 		cache:             cache,
-		snapshotThreshold: snapshotThreshold,
+		snapshotPolicy:    snapshotPolicy,
+		textName:          textName,
 		workerPool:        wp,
 		noficationService: noficationService,
+		invitations:       invitations,
+		dedupByContent:    dedupByContent,
 	}
 }
 
 func (s *DefaultService) CreateUserDocument(ctx context.Context, userID uint64, document *domain.Document) error {
+	// guests can't create documents in a workspace
+	if document.WorkspaceID != nil {
+		if err := s.checkWorkspaceWriter(ctx, *document.WorkspaceID, userID); err != nil {
+			return err
+		}
+	}
+
 	// Create document for user
 	err := s.repository.Create(ctx, userID, document)
 	if err == nil {
 		// increase cache key, so any new fetch will get new version
 		versionKey := fmt.Sprintf("user:%d:docs:version", userID)
 		s.cache.IncrementVersion(ctx, versionKey)
+
+		// workspace admins see it among their shared documents
+		if document.WorkspaceID != nil {
+			admins, err := s.repository.WorkspaceAdminIDs(ctx, *document.WorkspaceID)
+			if err != nil {
+				log.Error().Err(err).Uint64("workspace_id", *document.WorkspaceID).Msg("failed to list workspace admins")
+				return nil
+			}
+			for _, adminID := range admins {
+				if adminID == userID {
+					continue
+				}
+				versionKey := fmt.Sprintf("user:%d:docs:shared:version", adminID)
+				s.cache.IncrementVersion(ctx, versionKey)
+			}
+		}
 	}
 	return err
 }
 
+// checkWorkspaceWriter makes sure userID can put documents in a workspace
+func (s *DefaultService) checkWorkspaceWriter(ctx context.Context, workspaceID uint64, userID uint64) error {
+	role, err := s.repository.GetWorkspaceRole(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "none" {
+		return errors.UnprocessableEntity("Can't find workspace!", nil)
+	}
+	if role == "guest" {
+		return errors.Forbidden("Guest can't add documents to workspace", nil)
+	}
+	return nil
+}
+
+// requireWorkspaceAdmin returns Forbidden with msg unless a workspace owns
+// the document and userID is one of its admins
+func (s *DefaultService) requireWorkspaceAdmin(ctx context.Context, doc *domain.Document, userID uint64, msg string) error {
+	if doc.WorkspaceID == nil {
+		return errors.Forbidden(msg, nil)
+	}
+	role, err := s.repository.GetWorkspaceRole(ctx, *doc.WorkspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if role != "admin" {
+		return errors.Forbidden(msg, nil)
+	}
+	return nil
+}
+
+// MoveToWorkspace makes a workspace the owner of a document. Its admins get
+// owner rights on it. A document already in a workspace is only moved by an
+// admin of that workspace, so its creator can't take it away.
+func (s *DefaultService) MoveToWorkspace(ctx context.Context, docID uint64, userID uint64, workspaceID uint64) error {
+	role, err := s.repository.GetUserRole(ctx, docID, userID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return errors.Forbidden("Only owner can move document!", nil)
+	}
+
+	doc, err := s.repository.FindByID(ctx, docID)
+	if err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("Document not found", err)
+		}
+		return err
+	}
+	if doc.WorkspaceID != nil {
+		if *doc.WorkspaceID == workspaceID {
+			return errors.UnprocessableEntity("Document already in workspace", nil)
+		}
+		if err := s.requireWorkspaceAdmin(ctx, doc, userID, "Only workspace admin can move document out of workspace"); err != nil {
+			return err
+		}
+	}
+	if err := s.checkWorkspaceWriter(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+
+	// admins of the previous workspace lose their rights, those of the new
+	// one get them
+	var admins []uint64
+	if doc.WorkspaceID != nil {
+		admins, err = s.repository.WorkspaceAdminIDs(ctx, *doc.WorkspaceID)
+		if err != nil {
+			return err
+		}
+	}
+	newAdmins, err := s.repository.WorkspaceAdminIDs(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	admins = append(admins, newAdmins...)
+
+	if err := s.repository.SetWorkspace(ctx, docID, workspaceID); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("Document not found", err)
+		}
+		return err
+	}
+
+	versionKey := fmt.Sprintf("user:%d:docs:version", doc.UserID)
+	s.cache.IncrementVersion(ctx, versionKey)
+	s.NotifyAccessChanged(ctx, []uint64{docID}, admins)
+
+	return nil
+}
+
 func (s *DefaultService) RenameDocument(ctx context.Context, docID uint64, userID uint64, title string) (*domain.Document, error) {
 	if title == "" {
 		return nil, errors.BadRequest("Title cannot be empty", nil)
 	}
 
-	doc, err := s.repository.UpdateTitle(ctx, docID, userID, title)
+	// the creator, or an admin of the workspace owning the document
+	role, err := s.repository.GetUserRole(ctx, docID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != "owner" {
+		return nil, errors.NotFound("Document not found", nil)
+	}
+
+	doc, err := s.repository.UpdateTitle(ctx, docID, title)
 	if err != nil {
 		if defError.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.NotFound("Document not found", err)
@@ -89,7 +269,7 @@ func (s *DefaultService) RenameDocument(ctx context.Context, docID uint64, userI
 		return nil, err
 	}
 
-	collaborators, _ := s.repository.ListDocumentCollaborators(ctx, docID)
+	collaborators, _ := s.repository.ListDocumentAccess(ctx, docID)
 
 	// Submit to Worker Pool
 	s.workerPool.Submit(func(bgCtx context.Context) error {
@@ -99,7 +279,7 @@ func (s *DefaultService) RenameDocument(ctx context.Context, docID uint64, userI
 		// Invalidate cache
 		for _, col := range collaborators {
 			var versionKey string
-			if col.Role == "owner" {
+			if col.IsOwner {
 				versionKey = fmt.Sprintf("user:%d:docs:version", col.UserID)
 			} else {
 				// shared document
@@ -119,12 +299,19 @@ type PaginatedDocuments struct {
 	Meta DocumentsMeta          `json:"meta"`
 }
 
-func (s *DefaultService) GetUserDocuments(ctx context.Context, userID uint64, page, pageSize int) (*PaginatedDocuments, error) {
+// cacheKey identifies the filter in listing cache keys. The title query is
+// hashed to keep keys short and free of user supplied characters.
+func (f DocumentListFilter) cacheKey() string {
+	sum := sha256.Sum256([]byte(f.Query))
+	return fmt.Sprintf("q:%x:s:%s:o:%s:r:%s:ow:%d:ws:%d", sum[:8], f.Sort, f.Order, f.Role, f.OwnerID, f.WorkspaceID)
+}
+
+func (s *DefaultService) GetUserDocuments(ctx context.Context, userID uint64, page, pageSize int, filter DocumentListFilter) (*PaginatedDocuments, error) {
 	// Get the current data version for this user's documents
 	versionKey := fmt.Sprintf("user:%d:docs:version", userID)
 	v := s.cache.GetVersion(ctx, versionKey)
 
-	cacheKey := fmt.Sprintf("docs:u:%d:v:%d:p:%d:ps:%d", userID, v, page, pageSize)
+	cacheKey := fmt.Sprintf("docs:u:%d:v:%d:p:%d:ps:%d:%s", userID, v, page, pageSize, filter.cacheKey())
 
 	var result PaginatedDocuments
 	// get data from cache
@@ -133,7 +320,7 @@ func (s *DefaultService) GetUserDocuments(ctx context.Context, userID uint64, pa
 		return &result, nil
 	}
 
-	documents, meta, err := s.repository.ListDocumentByUserID(ctx, userID, page, pageSize)
+	documents, meta, err := s.repository.ListDocumentByUserID(ctx, userID, page, pageSize, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -144,12 +331,12 @@ func (s *DefaultService) GetUserDocuments(ctx context.Context, userID uint64, pa
 	return &result, nil
 }
 
-func (s *DefaultService) GetSharedDocuments(ctx context.Context, userID uint64, page, pageSize int) (*PaginatedDocuments, error) {
+func (s *DefaultService) GetSharedDocuments(ctx context.Context, userID uint64, page, pageSize int, filter DocumentListFilter) (*PaginatedDocuments, error) {
 	// Get the current data version for this user shared documents
 	versionKey := fmt.Sprintf("user:%d:docs:shared:version", userID)
 	v := s.cache.GetVersion(ctx, versionKey)
 
-	cacheKey := fmt.Sprintf("docs:shared:u:%d:v:%d:p:%d:ps:%d", userID, v, page, pageSize)
+	cacheKey := fmt.Sprintf("docs:shared:u:%d:v:%d:p:%d:ps:%d:%s", userID, v, page, pageSize, filter.cacheKey())
 
 	var result PaginatedDocuments
 	// get data from cache
@@ -158,7 +345,7 @@ func (s *DefaultService) GetSharedDocuments(ctx context.Context, userID uint64,
 		return &result, nil
 	}
 
-	documents, meta, err := s.repository.ListSharedDocuments(ctx, userID, page, pageSize)
+	documents, meta, err := s.repository.ListSharedDocuments(ctx, userID, page, pageSize, filter)
 
 	if err != nil {
 		return nil, err
@@ -170,6 +357,131 @@ func (s *DefaultService) GetSharedDocuments(ctx context.Context, userID uint64,
 	return &result, nil
 }
 
+type CursorDocuments struct {
+	Data       []DocumentShowResponse `json:"data"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// listCursor is the opaque next_cursor of a document listing. Sort and Order
+// are kept so a cursor cannot be replayed against a different ordering.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    uint64 `json:"id"`
+}
+
+func encodeCursor(v any) string {
+	raw, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(token string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return errors.BadRequest("Invalid cursor", err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return errors.BadRequest("Invalid cursor", err)
+	}
+	return nil
+}
+
+func encodeListCursor(filter DocumentListFilter, doc DocumentShowResponse) string {
+	sort, order := filter.sorting()
+	cursor := listCursor{Sort: sort, Order: order, ID: doc.ID}
+	switch sort {
+	case "title":
+		cursor.Value = doc.Title
+	case "created_at":
+		cursor.Value = doc.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		cursor.Value = doc.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return encodeCursor(cursor)
+}
+
+// decodeListCursor returns nil for the first page
+func decodeListCursor(token string, filter DocumentListFilter) (*DocumentCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	var cursor listCursor
+	if err := decodeCursor(token, &cursor); err != nil {
+		return nil, err
+	}
+	if sort, order := filter.sorting(); cursor.Sort != sort || cursor.Order != order {
+		return nil, errors.BadRequest("Cursor belongs to a different sort order", nil)
+	}
+	if cursor.Sort != "title" {
+		if _, err := time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+			return nil, errors.BadRequest("Invalid cursor", err)
+		}
+	}
+
+	return &DocumentCursor{Value: cursor.Value, ID: cursor.ID}, nil
+}
+
+// listAfter serves a keyset page, reading one extra row to know whether a
+// next page exists
+func (s *DefaultService) listAfter(
+	ctx context.Context,
+	cacheKey string,
+	token string,
+	pageSize int,
+	filter DocumentListFilter,
+	fetch func(cursor *DocumentCursor, limit int) ([]DocumentShowResponse, error),
+) (*CursorDocuments, error) {
+	cursor, err := decodeListCursor(token, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var result CursorDocuments
+	// get data from cache
+	found, _ := s.cache.Get(ctx, cacheKey, &result)
+	if found {
+		return &result, nil
+	}
+
+	documents, err := fetch(cursor, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+	result = CursorDocuments{Data: documents}
+	if len(documents) > pageSize {
+		result.Data = documents[:pageSize]
+		result.NextCursor = encodeListCursor(filter, result.Data[pageSize-1])
+	}
+	// set value to cache
+	go s.cache.Set(context.Background(), cacheKey, result, 24*time.Hour)
+
+	return &result, nil
+}
+
+func (s *DefaultService) GetUserDocumentsAfter(ctx context.Context, userID uint64, cursor string, pageSize int, filter DocumentListFilter) (*CursorDocuments, error) {
+	versionKey := fmt.Sprintf("user:%d:docs:version", userID)
+	v := s.cache.GetVersion(ctx, versionKey)
+
+	cacheKey := fmt.Sprintf("docs:u:%d:v:%d:c:%x:ps:%d:%s", userID, v, sha256.Sum256([]byte(cursor)), pageSize, filter.cacheKey())
+
+	return s.listAfter(ctx, cacheKey, cursor, pageSize, filter, func(after *DocumentCursor, limit int) ([]DocumentShowResponse, error) {
+		return s.repository.ListDocumentByUserIDAfter(ctx, userID, after, limit, filter)
+	})
+}
+
+func (s *DefaultService) GetSharedDocumentsAfter(ctx context.Context, userID uint64, cursor string, pageSize int, filter DocumentListFilter) (*CursorDocuments, error) {
+	versionKey := fmt.Sprintf("user:%d:docs:shared:version", userID)
+	v := s.cache.GetVersion(ctx, versionKey)
+
+	cacheKey := fmt.Sprintf("docs:shared:u:%d:v:%d:c:%x:ps:%d:%s", userID, v, sha256.Sum256([]byte(cursor)), pageSize, filter.cacheKey())
+
+	return s.listAfter(ctx, cacheKey, cursor, pageSize, filter, func(after *DocumentCursor, limit int) ([]DocumentShowResponse, error) {
+		return s.repository.ListSharedDocumentsAfter(ctx, userID, after, limit, filter)
+	})
+}
+
 type DocumentShowResponse struct {
 	ID        uint64    `json:"id"`
 	Title     string    `json:"title"`
@@ -178,6 +490,8 @@ type DocumentShowResponse struct {
 	Role      string    `json:"role"`
 	OwnerName string    `json:"owner_name"`
 	OwnerId   uint64    `json:"owner_id"`
+	// set when a workspace owns the document
+	WorkspaceID *uint64 `json:"workspace_id"`
 }
 
 func (s *DefaultService) GetDocumentByID(ctx context.Context, docID uint64, userID uint64) (*DocumentShowResponse, error) {
@@ -198,29 +512,108 @@ func (s *DefaultService) GetDocumentByID(ctx context.Context, docID uint64, user
 		Role:      role,
 		CreatedAt: doc.CreatedAt,
 		UpdatedAt: doc.UpdatedAt,
+		WorkspaceID: doc.WorkspaceID,
 	}, nil
 }
 
-func (s *DefaultService) FetchUserRole(ctx context.Context, docID, userID uint64) (string, error) {
-	return s.repository.GetUserRole(ctx, docID, userID)
+// maxUpdateIDLength keeps prefixed keys within the update_key column
+const maxUpdateIDLength = 120
+
+// updateKey is the dedup key of an update: the id chosen by the sender, or a
+// hash of the content when deduplication by content is enabled, "" otherwise.
+// Hashing relies on the sender never producing the same bytes for two
+// different updates, which is why it is opt-in.
+func (s *DefaultService) updateKey(content []byte, updateID string) string {
+	if updateID != "" {
+		return "id:" + updateID
+	}
+	if s.dedupByContent {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	}
+	return ""
+}
+
+func checkUpdateID(updateID string) error {
+	if len(updateID) > maxUpdateIDLength {
+		return errors.UnprocessableEntity(fmt.Sprintf("Update id must be at most %d characters", maxUpdateIDLength), nil)
+	}
+	return nil
 }
 
+// CreateDocumentUpdate stores an update and returns its seq. An update that
+// was already stored, by updateID or by content, is not stored again and its
+// existing seq is returned.
+//
 // context to detect if connection is safe, and cancel downstream if fail
-func (s *DefaultService) CreateDocumentUpdate(ctx context.Context, docID uint64, userID uint64, content []byte) error {
+func (s *DefaultService) CreateDocumentUpdate(ctx context.Context, docID uint64, userID uint64, content []byte, updateID string) (uint64, error) {
+	if err := checkUpdateID(updateID); err != nil {
+		return 0, err
+	}
+
 	// viewer not allowed to
-	role, err := s.FetchUserRole(ctx, docID, userID)
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if role == "viewer" {
-		return errors.Forbidden("Viewer can't create update!", nil)
+		return 0, errors.Forbidden("Viewer can't create update!", nil)
 	}
 
-	err = s.repository.CreateUpdate(ctx, docID, userID, content)
+	seq, err := s.repository.CreateUpdate(ctx, docID, userID, content, s.updateKey(content, updateID))
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	s.afterUpdates(ctx, docID)
+
+	return seq, nil
+}
+
+// CreateDocumentUpdates stores several updates of one user in a single
+// transaction and returns their seqs, in the order given. updateIDs is empty
+// or holds the id of each update, "" for none; updates already stored are
+// deduplicated as in CreateDocumentUpdate.
+func (s *DefaultService) CreateDocumentUpdates(ctx context.Context, docID uint64, userID uint64, updates [][]byte, updateIDs []string) ([]uint64, error) {
+	if len(updateIDs) > 0 && len(updateIDs) != len(updates) {
+		return nil, errors.UnprocessableEntity("Update ids must match the updates", nil)
+	}
+	for _, updateID := range updateIDs {
+		if err := checkUpdateID(updateID); err != nil {
+			return nil, err
+		}
 	}
 
+	// viewer not allowed to
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if role == "viewer" {
+		return nil, errors.Forbidden("Viewer can't create update!", nil)
+	}
+
+	keys := make([]string, len(updates))
+	for i, update := range updates {
+		var updateID string
+		if len(updateIDs) > 0 {
+			updateID = updateIDs[i]
+		}
+		keys[i] = s.updateKey(update, updateID)
+	}
+
+	seqs, err := s.repository.CreateUpdates(ctx, docID, userID, updates, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterUpdates(ctx, docID)
+
+	return seqs, nil
+}
+
+// afterUpdates runs once new updates of docID are stored: list caches are
+// invalidated and a snapshot is scheduled when enough updates piled up
+func (s *DefaultService) afterUpdates(ctx context.Context, docID uint64) {
 	// Throttled Invalidation
 	s.workerPool.Submit(func(bgCtx context.Context) error {
 		timeoutCtx, cancel := context.WithTimeout(bgCtx, 10*time.Second)
@@ -233,14 +626,14 @@ func (s *DefaultService) CreateDocumentUpdate(ctx context.Context, docID uint64,
 		isNew, _ := s.cache.SetNX(timeoutCtx, lockKey, "1", time.Minute)
 
 		if isNew {
-			collaborators, err := s.repository.ListDocumentCollaborators(timeoutCtx, docID)
+			collaborators, err := s.repository.ListDocumentAccess(timeoutCtx, docID)
 			if err != nil {
 				return err
 			}
 
 			for _, col := range collaborators {
 				var versionKey string
-				if col.Role == "owner" {
+				if col.IsOwner {
 					versionKey = fmt.Sprintf("user:%d:docs:version", col.UserID)
 				} else {
 					// shared document
@@ -260,8 +653,6 @@ func (s *DefaultService) CreateDocumentUpdate(ctx context.Context, docID uint64,
 			return s.handleBackgroundSnapshot(bgCtx, docID)
 		})
 	}
-
-	return nil
 }
 
 // run snapshot on the background
@@ -286,105 +677,484 @@ func (s *DefaultService) handleBackgroundSnapshot(ctx context.Context, docID uin
 
 	state, err := s.syncClient.GetDocumentState(timeoutCtx, docID)
 	if err != nil {
-		return err
+		// without the sync server updates would pile up until it is back
+		log.Warn().Err(err).Uint64("doc_id", docID).Msg("sync server unavailable, merging snapshot from history")
+		return s.compactDocument(ctx, docID)
 	}
 	return s.CreateDocumentSnapshot(timeoutCtx, docID, state)
 }
 
+// compactDocument merges the latest snapshot and the updates after it into a
+// new snapshot, without the sync server
+func (s *DefaultService) compactDocument(ctx context.Context, docID uint64) error {
+	state, err := s.GetDocumentState(ctx, docID)
+	if err != nil {
+		return err
+	}
+	if len(state.Updates) == 0 {
+		return nil
+	}
+
+	parts := make([][]byte, 0, len(state.Updates)+1)
+	if len(state.Snapshot) > 0 {
+		parts = append(parts, state.Snapshot)
+	}
+	for _, u := range state.Updates {
+		parts = append(parts, u.Binary)
+	}
+
+	merged, err := yjs.MergeUpdates(parts...)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repository.CreateSnapshotAt(ctx, docID, state.NextSeq, merged); err != nil {
+		return err
+	}
+	s.scheduleContentIndex(docID)
+	return nil
+}
+
 func (s *DefaultService) CreateDocumentSnapshot(ctx context.Context, docID uint64, state []byte) error {
-	return s.repository.CreateSnapshot(ctx, docID, state)
+	if err := s.repository.CreateSnapshot(ctx, docID, state); err != nil {
+		return err
+	}
+
+	// every snapshot path (background, sync server, kafka) ends here, so the
+	// search index follows the content at snapshot granularity
+	s.scheduleContentIndex(docID)
+	return nil
 }
 
+// shouldSnapshot checks the pending updates against the effective policy of
+// the document
 func (s *DefaultService) shouldSnapshot(ctx context.Context, docID uint64) bool {
-	var lastSnapshotSeq uint64
-	var currentSeq uint64
-
-	err := s.repository.LastSnapshotSeq(ctx, docID, &lastSnapshotSeq)
+	override, err := s.repository.GetSnapshotPolicy(ctx, docID)
 	if err != nil {
 		return false
 	}
 
-	err = s.repository.CurrentSeq(ctx, docID, &currentSeq)
+	pending, err := s.repository.PendingUpdates(ctx, docID)
 	if err != nil {
 		return false
 	}
 
-	return currentSeq-lastSnapshotSeq >= s.snapshotThreshold
-}
-
-type DocumentUpdateDTO struct {
-	Seq    uint64 `json:"seq"`
-	Binary []byte `json:"binary"`
-}
-
-type DocumentStateResponse struct {
-	Snapshot    []byte              `json:"snapshot"`
-	SnapshotSeq uint64              `json:"snapshot_seq"`
-	Updates     []DocumentUpdateDTO `json:"updates"`
+	return s.snapshotPolicy.withOverride(override).due(pending, time.Now())
 }
 
-func (s *DefaultService) GetDocumentState(ctx context.Context, docID uint64) (*DocumentStateResponse, error) {
+// scheduleBatchSize is how many documents ScheduleSnapshots queues at once
+const scheduleBatchSize = 100
 
-	var snapshot domain.DocumentSnapshot
-	err := s.repository.LastSnapshot(ctx, docID, &snapshot)
+// snapshotRetryAfter is how long ScheduleSnapshots leaves a queued document
+// alone, in case its snapshot failed
+const snapshotRetryAfter = 10 * time.Minute
 
-	var snapshotSeq uint64
-	var snapshotState []byte
+// ScheduleSnapshots queues a snapshot for documents that became due without a
+// new update, because they are idle or their last snapshot is too old. It
+// returns how many were queued.
+func (s *DefaultService) ScheduleSnapshots(ctx context.Context) (int, error) {
+	ids, err := s.repository.SnapshotCandidates(ctx, s.snapshotPolicy, time.Now().UTC(), snapshotRetryAfter, scheduleBatchSize)
+	if err != nil {
+		return 0, err
+	}
 
-	if err == nil {
-		snapshotSeq = snapshot.Seq
-		snapshotState = snapshot.SnapshotBinary
+	for _, id := range ids {
+		docID := id
+		s.workerPool.Submit(func(bgCtx context.Context) error {
+			return s.handleBackgroundSnapshot(bgCtx, docID)
+		})
 	}
+	return len(ids), nil
+}
 
-	var updates []domain.DocumentUpdate
-	err = s.repository.UpdatesFromSnapshot(ctx, docID, snapshotSeq, &updates)
+func (s *DefaultService) GetSnapshotPolicy(ctx context.Context, docID uint64, userID uint64) (*SnapshotPolicyResponse, error) {
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
 	if err != nil {
 		return nil, err
 	}
+	if role == "none" {
+		return nil, errors.Forbidden("You're not collaborator", nil)
+	}
 
-	return &DocumentStateResponse{
-		Snapshot:    snapshotState,
-		SnapshotSeq: snapshotSeq,
-		Updates:     toDocumentUpdateDTOs(updates),
-	}, nil
+	override, err := s.repository.GetSnapshotPolicy(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+	return toSnapshotPolicyResponse(s.snapshotPolicy, override), nil
 }
 
-func toDocumentUpdateDTOs(updates []domain.DocumentUpdate) []DocumentUpdateDTO {
-	dtos := make([]DocumentUpdateDTO, 0, len(updates))
+// UpdateSnapshotPolicy replaces the policy override of a document, null fields
+// fall back to the global policy. Only the owner can change it.
+func (s *DefaultService) UpdateSnapshotPolicy(ctx context.Context, docID uint64, userID uint64, dto SnapshotPolicyDTO) (*SnapshotPolicyResponse, error) {
+	role, err := s.repository.GetUserRole(ctx, docID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != "owner" {
+		return nil, errors.Forbidden("Only owner can change snapshot policy!", nil)
+	}
 
-	for _, u := range updates {
-		dtos = append(dtos, DocumentUpdateDTO{
-			Seq:    u.Seq,
-			Binary: u.UpdateBinary,
-		})
+	var override *domain.DocumentSnapshotPolicy
+	if dto.MaxPendingUpdates == nil && dto.MaxPendingBytes == nil && dto.MaxAgeSeconds == nil && dto.IdleSeconds == nil {
+		err = s.repository.DeleteSnapshotPolicy(ctx, docID)
+	} else {
+		override = &domain.DocumentSnapshotPolicy{
+			DocumentID:        docID,
+			MaxPendingUpdates: dto.MaxPendingUpdates,
+			MaxPendingBytes:   dto.MaxPendingBytes,
+			MaxAgeSeconds:     dto.MaxAgeSeconds,
+			IdleSeconds:       dto.IdleSeconds,
+		}
+		err = s.repository.SaveSnapshotPolicy(ctx, override)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return dtos
+	// a stricter policy can make the document due right away
+	s.workerPool.Submit(func(bgCtx context.Context) error {
+		return s.handleBackgroundSnapshot(bgCtx, docID)
+	})
+
+	return toSnapshotPolicyResponse(s.snapshotPolicy, override), nil
 }
 
-type UserDTO struct {
-	ID    uint64 `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+type DocumentUpdateDTO struct {
+	Seq    uint64 `json:"seq"`
+	Binary []byte `json:"binary"`
 }
 
-type DocumentCollaboratorDTO struct {
-	User UserDTO `json:"user"`
-	Role string  `json:"role"`
+// maxUpdatesPerPage caps how many updates are read from the database at once
+const maxUpdatesPerPage = 500
+
+type DocumentUpdatePage struct {
+	Updates    []DocumentUpdateDTO `json:"updates"`
+	NextCursor string              `json:"next_cursor,omitempty"`
 }
 
-func (s *DefaultService) ListCollaborators(ctx context.Context, docID uint64, requesterID uint64) ([]DocumentCollaboratorDTO, error) {
-	rows, err := s.repository.ListDocumentCollaborators(ctx, docID)
-	if err != nil {
+type updateCursor struct {
+	Seq uint64 `json:"seq"`
+}
+
+// ListDocumentUpdates pages through the updates after the latest snapshot in
+// seq order. An empty cursor starts at the snapshot.
+func (s *DefaultService) ListDocumentUpdates(ctx context.Context, docID uint64, cursor string, limit int) (*DocumentUpdatePage, error) {
+	var afterSeq uint64
+	if cursor != "" {
+		var c updateCursor
+		if err := decodeCursor(cursor, &c); err != nil {
+			return nil, err
+		}
+		afterSeq = c.Seq
+	} else if err := s.repository.LastSnapshotSeq(ctx, docID, &afterSeq); err != nil {
 		return nil, err
 	}
 
-	// viewer not allowed to
-	role, err := s.FetchUserRole(ctx, docID, requesterID)
+	updates, err := s.updatesAfter(ctx, docID, afterSeq, limit+1)
+	if defError.Is(err, errHistoryGap) {
+		return nil, errors.Conflict("Document history was compacted, restart from the snapshot", err)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if role == "viewer" {
+
+	page := &DocumentUpdatePage{}
+	if len(updates) > limit {
+		updates = updates[:limit]
+		page.NextCursor = encodeCursor(updateCursor{Seq: updates[limit-1].Seq})
+	}
+	page.Updates = toDocumentUpdateDTOs(updates)
+
+	return page, nil
+}
+
+type DocumentStateResponse struct {
+	Snapshot    []byte              `json:"snapshot"`
+	SnapshotSeq uint64              `json:"snapshot_seq"`
+	Updates     []DocumentUpdateDTO `json:"updates"`
+	// HasMore is set on a page of hydration when updates after NextSeq remain
+	HasMore bool   `json:"has_more"`
+	NextSeq uint64 `json:"next_seq"`
+	// SnapshotRequired answers a since_seq request whose updates were
+	// compacted: the response is the whole state and replaces what the caller
+	// has cached
+	SnapshotRequired bool `json:"snapshot_required"`
+}
+
+// errHistoryGap means updates were compacted away between reading the snapshot
+// and reading the updates after it
+var errHistoryGap = defError.New("document history has a gap")
+
+// maxHydrationAttempts bounds how often GetDocumentState starts over when a
+// concurrent snapshot compacts the updates it was reading
+const maxHydrationAttempts = 3
+
+// GetDocumentState returns the latest snapshot and every update after it,
+// read in pages of maxUpdatesPerPage
+func (s *DefaultService) GetDocumentState(ctx context.Context, docID uint64) (*DocumentStateResponse, error) {
+	for attempt := 1; ; attempt++ {
+		state, err := s.loadDocumentState(ctx, docID)
+		if !defError.Is(err, errHistoryGap) {
+			return state, err
+		}
+		if attempt == maxHydrationAttempts {
+			return nil, errors.Conflict("Document history changed during hydration, retry", err)
+		}
+	}
+}
+
+func (s *DefaultService) loadDocumentState(ctx context.Context, docID uint64) (*DocumentStateResponse, error) {
+	// every update up to currentSeq is committed, so the state must reach it
+	var currentSeq uint64
+	if err := s.repository.CurrentSeq(ctx, docID, &currentSeq); err != nil {
+		return nil, err
+	}
+
+	var snapshot domain.DocumentSnapshot
+	err := s.repository.LastSnapshot(ctx, docID, &snapshot)
+	if err != nil && !defError.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	updates, nextSeq, err := s.updatesUpTo(ctx, docID, snapshot.Seq, currentSeq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DocumentStateResponse{
+		Snapshot:    snapshot.SnapshotBinary,
+		SnapshotSeq: snapshot.Seq,
+		Updates:     toDocumentUpdateDTOs(updates),
+		NextSeq:     nextSeq,
+	}, nil
+}
+
+// updatesUpTo reads every update after afterSeq in pages, and fails with
+// errHistoryGap unless they continue afterSeq and reach currentSeq. It
+// returns the last seq read.
+func (s *DefaultService) updatesUpTo(ctx context.Context, docID uint64, afterSeq uint64, currentSeq uint64) ([]domain.DocumentUpdate, uint64, error) {
+	nextSeq := afterSeq
+	var updates []domain.DocumentUpdate
+	for {
+		page, err := s.updatesAfter(ctx, docID, nextSeq, maxUpdatesPerPage)
+		if err != nil {
+			return nil, 0, err
+		}
+		updates = append(updates, page...)
+		if len(page) > 0 {
+			nextSeq = page[len(page)-1].Seq
+		}
+		if len(page) < maxUpdatesPerPage {
+			break
+		}
+	}
+	if nextSeq < currentSeq {
+		return nil, 0, errHistoryGap
+	}
+
+	return updates, nextSeq, nil
+}
+
+// GetDocumentStateSince returns only the updates after sinceSeq, for a caller
+// that already has the state up to it. When they are no longer all stored,
+// the whole state is returned with SnapshotRequired set.
+func (s *DefaultService) GetDocumentStateSince(ctx context.Context, docID uint64, sinceSeq uint64) (*DocumentStateResponse, error) {
+	var currentSeq uint64
+	if err := s.repository.CurrentSeq(ctx, docID, &currentSeq); err != nil {
+		return nil, err
+	}
+	if sinceSeq > currentSeq {
+		return nil, errors.UnprocessableEntity("Seq is ahead of the document", nil)
+	}
+
+	updates, nextSeq, err := s.updatesUpTo(ctx, docID, sinceSeq, currentSeq)
+	if defError.Is(err, errHistoryGap) {
+		state, err := s.GetDocumentState(ctx, docID)
+		if err != nil {
+			return nil, err
+		}
+		state.SnapshotRequired = true
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &DocumentStateResponse{
+		Updates: toDocumentUpdateDTOs(updates),
+		NextSeq: nextSeq,
+	}, nil
+}
+
+// GetDocumentStatePage returns one page of hydration. The first page, with
+// afterSeq 0, carries the latest snapshot; the following ones pass the
+// previous NextSeq as afterSeq and only carry updates. A 409 means history was
+// compacted in between and hydration has to start over.
+func (s *DefaultService) GetDocumentStatePage(ctx context.Context, docID uint64, afterSeq uint64, limit int) (*DocumentStateResponse, error) {
+	var currentSeq uint64
+	if err := s.repository.CurrentSeq(ctx, docID, &currentSeq); err != nil {
+		return nil, err
+	}
+	if afterSeq > currentSeq {
+		return nil, errors.UnprocessableEntity("Seq is ahead of the document", nil)
+	}
+
+	state := &DocumentStateResponse{NextSeq: afterSeq}
+	if afterSeq == 0 {
+		var snapshot domain.DocumentSnapshot
+		err := s.repository.LastSnapshot(ctx, docID, &snapshot)
+		if err != nil && !defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		state.Snapshot = snapshot.SnapshotBinary
+		state.SnapshotSeq = snapshot.Seq
+		state.NextSeq = snapshot.Seq
+	}
+
+	updates, err := s.updatesAfter(ctx, docID, state.NextSeq, limit+1)
+	if err == nil && len(updates) == 0 && state.NextSeq < currentSeq {
+		err = errHistoryGap
+	}
+	if err != nil {
+		if defError.Is(err, errHistoryGap) {
+			return nil, errors.Conflict("Document history was compacted, restart hydration", err)
+		}
+		return nil, err
+	}
+
+	if len(updates) > limit {
+		updates = updates[:limit]
+		state.HasMore = true
+	}
+	if len(updates) > 0 {
+		state.NextSeq = updates[len(updates)-1].Seq
+	}
+	state.Updates = toDocumentUpdateDTOs(updates)
+
+	return state, nil
+}
+
+// StreamDocumentState hands the state to send page by page, the first page
+// carrying the snapshot, so the updates never have to be held at once. Pages
+// are not retried: a compaction mid-way fails the stream with a 409.
+func (s *DefaultService) StreamDocumentState(ctx context.Context, docID uint64, send func(page *DocumentStateResponse) error) error {
+	var afterSeq uint64
+	for {
+		page, err := s.GetDocumentStatePage(ctx, docID, afterSeq, maxUpdatesPerPage)
+		if err != nil {
+			return err
+		}
+		if err := send(page); err != nil {
+			return err
+		}
+		if !page.HasMore {
+			return nil
+		}
+		afterSeq = page.NextSeq
+	}
+}
+
+// updatesAfter reads up to limit updates after afterSeq and makes sure they
+// continue it without gaps, seqs being contiguous per document
+func (s *DefaultService) updatesAfter(ctx context.Context, docID uint64, afterSeq uint64, limit int) ([]domain.DocumentUpdate, error) {
+	var updates []domain.DocumentUpdate
+	if err := s.repository.UpdatesFromSnapshot(ctx, docID, afterSeq, limit, &updates); err != nil {
+		return nil, err
+	}
+
+	for i, u := range updates {
+		if u.Seq != afterSeq+uint64(i)+1 {
+			return nil, errHistoryGap
+		}
+	}
+	return updates, nil
+}
+
+// GetDocumentStateAt rebuilds the document state at any historical seq that is
+// still covered by the retained snapshots and updates
+func (s *DefaultService) GetDocumentStateAt(ctx context.Context, docID uint64, seq uint64, userID uint64) (*DocumentStateResponse, error) {
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if role == "none" {
+		return nil, errors.Forbidden("You're not collaborator", nil)
+	}
+
+	var currentSeq uint64
+	if err := s.repository.CurrentSeq(ctx, docID, &currentSeq); err != nil {
+		return nil, err
+	}
+	if seq > currentSeq {
+		return nil, errors.UnprocessableEntity("Seq is ahead of the document", nil)
+	}
+
+	return s.stateAtSeq(ctx, docID, seq)
+}
+
+// stateAtSeq rebuilds the state as of seq from the nearest earlier snapshot
+// plus the updates after it
+func (s *DefaultService) stateAtSeq(ctx context.Context, docID uint64, seq uint64) (*DocumentStateResponse, error) {
+	var snapshot domain.DocumentSnapshot
+	err := s.repository.SnapshotAtSeq(ctx, docID, seq, &snapshot)
+	if err != nil && !defError.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var updates []domain.DocumentUpdate
+	err = s.repository.UpdatesInRange(ctx, docID, snapshot.Seq, seq, &updates)
+	if err != nil {
+		return nil, err
+	}
+
+	// seqs are contiguous, so any gap means the history was compacted away
+	if uint64(len(updates)) != seq-snapshot.Seq {
+		return nil, errors.UnprocessableEntity("Document history is no longer available", nil)
+	}
+
+	return &DocumentStateResponse{
+		Snapshot:    snapshot.SnapshotBinary,
+		SnapshotSeq: snapshot.Seq,
+		Updates:     toDocumentUpdateDTOs(updates),
+	}, nil
+}
+
+func toDocumentUpdateDTOs(updates []domain.DocumentUpdate) []DocumentUpdateDTO {
+	dtos := make([]DocumentUpdateDTO, 0, len(updates))
+
+	for _, u := range updates {
+		dtos = append(dtos, DocumentUpdateDTO{
+			Seq:    u.Seq,
+			Binary: u.UpdateBinary,
+		})
+	}
+
+	return dtos
+}
+
+type UserDTO struct {
+	ID    uint64 `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type DocumentCollaboratorDTO struct {
+	User UserDTO `json:"user"`
+	Role string  `json:"role"`
+}
+
+func (s *DefaultService) ListCollaborators(ctx context.Context, docID uint64, requesterID uint64) ([]DocumentCollaboratorDTO, error) {
+	rows, err := s.repository.ListDocumentCollaborators(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	// viewer not allowed to
+	role, err := s.FetchUserRole(ctx, docID, requesterID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if role == "viewer" {
 		return nil, errors.Forbidden("Viewer can't show collaborators", nil)
 	}
 
@@ -475,14 +1245,20 @@ func (s *DefaultService) ChangeCollaboratorRole(
 		return nil, errors.UnprocessableEntity("Can't add yourself!", nil)
 	}
 
-	// Ensure target collaborator exists
-	currentRole, err := s.repository.GetUserRole(ctx, docID, targetUserID)
-	if err != nil {
+	// Ensure target collaborator exists, their team grants are left alone
+	var collab domain.DocumentCollaborator
+	if err := s.repository.GetCollaborator(ctx, docID, targetUserID, &collab); err != nil {
 		return nil, errors.UnprocessableEntity("Can't find user!", err)
 	}
+	// only the admins of the workspace owning the document demote its creator
+	if collab.Role == "owner" {
+		if err := s.checkCreatorTakeover(ctx, docID, requesterID); err != nil {
+			return nil, err
+		}
+	}
 
 	//  No-op check
-	if currentRole == newRole {
+	if collab.Role == newRole {
 		return nil, errors.UnprocessableEntity("User role already match", nil)
 	}
 
@@ -495,12 +1271,13 @@ func (s *DefaultService) ChangeCollaboratorRole(
 		return nil, err
 	}
 
-	// invalidate cache
-	versionKey := fmt.Sprintf("user:%d:docs:shared:version", targetUserID)
-	s.cache.IncrementVersion(ctx, versionKey)
-
-	// send notifications
-	s.noficationService.NotifyUserRoleChanged(docID, targetUserID, newRole)
+	// invalidate cache and send notifications, with the role a team may
+	// still give
+	if collab.Role == "owner" {
+		s.NotifyOwnershipChanged(ctx, []uint64{docID}, []uint64{targetUserID})
+	} else {
+		s.NotifyAccessChanged(ctx, []uint64{docID}, []uint64{targetUserID})
+	}
 
 	user, err := s.userProvider.GetUserByID(ctx, targetUserID)
 	if err != nil {
@@ -538,37 +1315,109 @@ func (s *DefaultService) RemoveCollaborator(
 	}
 
 	// Ensure target exists
-	if _, err := s.repository.GetUserRole(ctx, docID, targetUserID); err != nil {
+	var collab domain.DocumentCollaborator
+	if err := s.repository.GetCollaborator(ctx, docID, targetUserID, &collab); err != nil {
 		return errors.UnprocessableEntity("Can't find user", err)
 	}
+	// only the admins of the workspace owning the document remove its creator
+	if collab.Role == "owner" {
+		if err := s.checkCreatorTakeover(ctx, docID, requesterID); err != nil {
+			return err
+		}
+	}
 
 	if err := s.repository.RemoveCollaborator(ctx, docID, targetUserID); err != nil {
 		return err
 	}
 
-	// invalidate cache
-	versionKey := fmt.Sprintf("user:%d:docs:shared:version", targetUserID)
-	s.cache.IncrementVersion(ctx, versionKey)
+	// invalidate cache and send notifications, a team may still give access
+	if collab.Role == "owner" {
+		s.NotifyOwnershipChanged(ctx, []uint64{docID}, []uint64{targetUserID})
+	} else {
+		s.NotifyAccessChanged(ctx, []uint64{docID}, []uint64{targetUserID})
+	}
 
-	// send notifications
-	s.noficationService.NotifyUserRoleChanged(docID, targetUserID, "none")
+	return nil
+}
+
+// checkCreatorTakeover makes sure requesterID can demote or remove the
+// creator of a document, who holds its owner role: only an admin of the
+// workspace owning it can
+func (s *DefaultService) checkCreatorTakeover(ctx context.Context, docID uint64, requesterID uint64) error {
+	doc, err := s.repository.FindByID(ctx, docID)
+	if err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("Document not found", err)
+		}
+		return err
+	}
+	if doc.WorkspaceID == nil {
+		return errors.UnprocessableEntity("Can't change owner role!", nil)
+	}
+	return s.requireWorkspaceAdmin(ctx, doc, requesterID, "Only workspace admin can change owner role!")
+}
+
+// TransferOwnership hands a document over to one of its editors, the previous
+// owner becomes an editor. The admins of the workspace owning the document
+// can hand it over too, from its creator while they still own it.
+func (s *DefaultService) TransferOwnership(ctx context.Context, docID uint64, requesterID uint64, newOwnerID uint64) error {
+	// the current role, a creator demoted by a workspace admin is no owner
+	role, err := s.repository.GetUserRole(ctx, docID, requesterID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return errors.Forbidden("Only owner can transfer document!", nil)
+	}
+
+	doc, err := s.repository.FindByID(ctx, docID)
+	if err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("Document not found", err)
+		}
+		return err
+	}
+
+	ownerID := doc.UserID
+	if ownerID == newOwnerID {
+		return errors.UnprocessableEntity("User already owns document", nil)
+	}
+
+	if err := s.repository.TransferOwnership(ctx, docID, ownerID, newOwnerID); err != nil {
+		if defError.Is(err, ErrNotEditor) {
+			return errors.UnprocessableEntity("New owner must be an editor", err)
+		}
+		if defError.Is(err, ErrNotOwner) {
+			return errors.Conflict("Document creator no longer owns it", err)
+		}
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("Document not found", err)
+		}
+		return err
+	}
+
+	// the document moves between their own and shared listings
+	s.NotifyOwnershipChanged(ctx, []uint64{docID}, []uint64{ownerID, newOwnerID})
 
 	return nil
 }
 
 func (s *DefaultService) DeleteDocument(ctx context.Context, docID uint64, userID uint64) error {
-	var collab domain.DocumentCollaborator
-	err := s.repository.GetCollaborator(ctx, docID, userID, &collab)
-
+	// the creator, or an admin of the workspace owning the document
+	role, err := s.repository.GetUserRole(ctx, docID, userID)
 	if err != nil {
-		return errors.UnprocessableEntity("You're not collaborator", err)
+		return err
+	}
+
+	if role == "none" {
+		return errors.UnprocessableEntity("You're not collaborator", nil)
 	}
 
-	if collab.Role != "owner" {
+	if role != "owner" {
 		return errors.Forbidden("Only owner can delete document", nil)
 	}
 
-	collaborators, _ := s.repository.ListDocumentCollaborators(ctx, docID)
+	collaborators, _ := s.repository.ListDocumentAccess(ctx, docID)
 	err = s.repository.DeleteDocument(ctx, docID)
 	if err != nil {
 		return err
@@ -583,7 +1432,7 @@ func (s *DefaultService) DeleteDocument(ctx context.Context, docID uint64, userI
 		// Invalidate cache
 		for _, col := range collaborators {
 			var versionKey string
-			if col.Role == "owner" {
+			if col.IsOwner {
 				versionKey = fmt.Sprintf("user:%d:docs:version", col.UserID)
 			} else {
 				// shared document
@@ -601,3 +1450,435 @@ func (s *DefaultService) DeleteDocument(ctx context.Context, docID uint64, userI
 
 	return nil
 }
+
+type DocumentVersionDTO struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	Seq       uint64    `json:"seq"`
+	CreatedBy UserDTO   `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *DefaultService) CreateDocumentVersion(ctx context.Context, docID uint64, userID uint64, name string) (*DocumentVersionDTO, error) {
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if role != "owner" && role != "editor" {
+		return nil, errors.Forbidden("Only owner or editor can create version!", nil)
+	}
+
+	version := domain.DocumentVersion{
+		DocumentID: docID,
+		Name:       name,
+		CreatedBy:  userID,
+	}
+	if err := s.repository.CreateVersion(ctx, &version); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Document not found", err)
+		}
+		return nil, err
+	}
+
+	user, err := s.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DocumentVersionDTO{
+		ID:   version.ID,
+		Name: version.Name,
+		Seq:  version.Seq,
+		CreatedBy: UserDTO{
+			ID:    user.ID,
+			Name:  user.Name,
+			Email: user.Email,
+		},
+		CreatedAt: version.CreatedAt,
+	}, nil
+}
+
+func (s *DefaultService) ListDocumentVersions(ctx context.Context, docID uint64, userID uint64) ([]DocumentVersionDTO, error) {
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if role == "none" {
+		return nil, errors.Forbidden("You're not collaborator", nil)
+	}
+
+	rows, err := s.repository.ListVersions(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]DocumentVersionDTO, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, DocumentVersionDTO{
+			ID:   r.ID,
+			Name: r.Name,
+			Seq:  r.Seq,
+			CreatedBy: UserDTO{
+				ID:    r.CreatedBy,
+				Name:  r.CreatorName,
+				Email: r.CreatorEmail,
+			},
+			CreatedAt: r.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func (s *DefaultService) GetDocumentVersionState(ctx context.Context, docID uint64, versionID uint64, userID uint64) (*DocumentStateResponse, error) {
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if role == "none" {
+		return nil, errors.Forbidden("You're not collaborator", nil)
+	}
+
+	var version domain.DocumentVersion
+	if err := s.repository.FindVersion(ctx, docID, versionID, &version); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Version not found", err)
+		}
+		return nil, err
+	}
+
+	return s.stateAtSeq(ctx, docID, version.Seq)
+}
+
+type RestoreResponse struct {
+	VersionID uint64 `json:"version_id"`
+	Seq       uint64 `json:"seq"`
+}
+
+func (s *DefaultService) RestoreDocumentVersion(ctx context.Context, docID uint64, versionID uint64, userID uint64) (*RestoreResponse, error) {
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if role != "owner" && role != "editor" {
+		return nil, errors.Forbidden("Only owner or editor can restore version!", nil)
+	}
+
+	var version domain.DocumentVersion
+	if err := s.repository.FindVersion(ctx, docID, versionID, &version); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Version not found", err)
+		}
+		return nil, err
+	}
+
+	// a background snapshot taken from the sync server while restoring would
+	// store the pre-restore state under the new seq, share its lock
+	lockKey := fmt.Sprintf("lock:snapshot:%d", docID)
+	locked, err := s.cache.SetNX(ctx, lockKey, "restoring", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, errors.Conflict("Document is being snapshotted, try again", nil)
+	}
+	defer s.cache.Invalidate(ctx, lockKey)
+
+	state, err := s.stateAtSeq(ctx, docID, version.Seq)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]domain.DocumentUpdate, 0, len(state.Updates))
+	for _, u := range state.Updates {
+		updates = append(updates, domain.DocumentUpdate{
+			Seq:          u.Seq,
+			UpdateBinary: u.Binary,
+			UserID:       userID,
+		})
+	}
+
+	seq, err := s.repository.RestoreState(ctx, docID, state.Snapshot, updates)
+	if err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Document not found", err)
+		}
+		return nil, err
+	}
+
+	collaborators, _ := s.repository.ListDocumentAccess(ctx, docID)
+
+	// Submit to Worker Pool
+	s.workerPool.Submit(func(bgCtx context.Context) error {
+		// 5s timeout
+		timeoutCtx, cancel := context.WithTimeout(bgCtx, 5*time.Second)
+		defer cancel()
+		// Invalidate cache
+		for _, col := range collaborators {
+			var versionKey string
+			if col.IsOwner {
+				versionKey = fmt.Sprintf("user:%d:docs:version", col.UserID)
+			} else {
+				// shared document
+				versionKey = fmt.Sprintf("user:%d:docs:shared:version", col.UserID)
+			}
+			// invalidate
+			s.cache.IncrementVersion(timeoutCtx, versionKey)
+		}
+		return nil
+	})
+
+	// reload sync server and notify the other collaborators
+	s.noficationService.NotifyDocumentRestored(docID, userID, seq)
+	s.scheduleContentIndex(docID)
+
+	return &RestoreResponse{
+		VersionID: version.ID,
+		Seq:       seq,
+	}, nil
+}
+
+type DocumentContentResponse struct {
+	Content string `json:"content"`
+	Seq     uint64 `json:"seq"`
+}
+
+// GetDocumentContent decodes the stored Yjs state and returns the markdown text
+func (s *DefaultService) GetDocumentContent(ctx context.Context, docID uint64, userID uint64) (*DocumentContentResponse, error) {
+	role, err := s.FetchUserRole(ctx, docID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if role == "none" {
+		return nil, errors.Forbidden("You're not collaborator", nil)
+	}
+
+	state, err := s.GetDocumentState(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := s.decodeText(state)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := state.SnapshotSeq
+	if len(state.Updates) > 0 {
+		seq = state.Updates[len(state.Updates)-1].Seq
+	}
+
+	return &DocumentContentResponse{
+		Content: content,
+		Seq:     seq,
+	}, nil
+}
+
+// decodeText replays the snapshot and updates of state into a Y.Doc and reads
+// its markdown text. States with missing updates are rejected rather than
+// returning partial text
+func (s *DefaultService) decodeText(state *DocumentStateResponse) (string, error) {
+	doc := yjs.NewDoc()
+
+	if len(state.Snapshot) > 0 {
+		if err := doc.ApplyUpdate(state.Snapshot); err != nil {
+			return "", errors.UnprocessableEntity("Document snapshot could not be decoded", err)
+		}
+	}
+	for _, u := range state.Updates {
+		if err := doc.ApplyUpdate(u.Binary); err != nil {
+			return "", errors.UnprocessableEntity(fmt.Sprintf("Document update %d could not be decoded", u.Seq), err)
+		}
+	}
+	// the text would miss whatever depends on the missing updates
+	if doc.HasPending() {
+		return "", errors.UnprocessableEntity("Document state is missing updates", nil)
+	}
+
+	return doc.Text(s.textName), nil
+}
+
+// DocumentExport is a rendered document ready to be sent as a file
+type DocumentExport struct {
+	Filename    string
+	ContentType string
+	Body        []byte
+}
+
+type documentExportJSON struct {
+	ID         uint64    `json:"id"`
+	Title      string    `json:"title"`
+	OwnerID    uint64    `json:"owner_id"`
+	OwnerName  string    `json:"owner_name"`
+	Seq        uint64    `json:"seq"`
+	Markdown   string    `json:"markdown"`
+	HTML       string    `json:"html"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// ExportDocument renders the current document as markdown, a standalone
+// sanitized HTML page, or JSON with both and the document metadata
+func (s *DefaultService) ExportDocument(ctx context.Context, docID uint64, userID uint64, format string) (*DocumentExport, error) {
+	if format != "md" && format != "html" && format != "json" {
+		return nil, errors.BadRequest("Format must be one of md, html or json", nil)
+	}
+
+	doc, err := s.repository.FindByID(ctx, docID)
+	if err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Document not found", err)
+		}
+		return nil, err
+	}
+
+	// checks the role of userID
+	content, err := s.GetDocumentContent(ctx, docID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := s.userProvider.GetUserByID(ctx, doc.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	exportedAt := time.Now().UTC()
+	filename := exportFilename(doc.Title, docID) + "." + format
+
+	switch format {
+	case "html":
+		page, err := markdown.Standalone(content.Content, markdown.Meta{
+			Title:      doc.Title,
+			Author:     owner.Name,
+			ExportedAt: exportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &DocumentExport{Filename: filename, ContentType: "text/html; charset=utf-8", Body: page}, nil
+	case "json":
+		html, err := markdown.ToHTML(content.Content)
+		if err != nil {
+			return nil, err
+		}
+		body, err := json.Marshal(documentExportJSON{
+			ID:         doc.ID,
+			Title:      doc.Title,
+			OwnerID:    doc.UserID,
+			OwnerName:  owner.Name,
+			Seq:        content.Seq,
+			Markdown:   content.Content,
+			HTML:       html,
+			CreatedAt:  doc.CreatedAt,
+			UpdatedAt:  doc.UpdatedAt,
+			ExportedAt: exportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &DocumentExport{Filename: filename, ContentType: "application/json", Body: body}, nil
+	}
+
+	return &DocumentExport{Filename: filename, ContentType: "text/markdown; charset=utf-8", Body: []byte(content.Content)}, nil
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// exportFilename turns a title into a filename safe for Content-Disposition
+func exportFilename(title string, docID uint64) string {
+	name := strings.Trim(unsafeFilenameChars.ReplaceAllString(title, "-"), "-.")
+	if name == "" {
+		return fmt.Sprintf("document-%d", docID)
+	}
+	return name
+}
+
+// ImportFile is an uploaded markdown file
+type ImportFile struct {
+	Name    string
+	Content []byte
+}
+
+// ImportDocuments creates one document per markdown file, seeded with a Yjs
+// snapshot of its text so the sync server loads it on first open. Either all
+// files are imported or none are.
+func (s *DefaultService) ImportDocuments(ctx context.Context, userID uint64, files []ImportFile) ([]domain.Document, error) {
+	if len(files) == 0 {
+		return nil, errors.BadRequest("No markdown files to import", nil)
+	}
+
+	docs := make([]domain.Document, 0, len(files))
+	texts := make([]string, 0, len(files))
+	for _, f := range files {
+		if !utf8.Valid(f.Content) {
+			return nil, errors.UnprocessableEntity(fmt.Sprintf("%s is not valid UTF-8 text", f.Name), nil)
+		}
+		docs = append(docs, domain.Document{Title: importTitle(f.Name)})
+		texts = append(texts, strings.TrimPrefix(string(f.Content), "\ufeff"))
+	}
+
+	// a random client id, as a new Y.Doc would pick, so the seeded insert is
+	// unlikely to share a client with later editors
+	states := make([][]byte, len(texts))
+	for i, text := range texts {
+		states[i] = yjs.NewTextUpdate(uint64(rand.Uint32()), s.textName, text)
+	}
+
+	if err := s.repository.CreateImported(ctx, userID, docs, states, texts); err != nil {
+		return nil, err
+	}
+
+	// increase cache key, so any new fetch will get new version
+	versionKey := fmt.Sprintf("user:%d:docs:version", userID)
+	s.cache.IncrementVersion(ctx, versionKey)
+
+	return docs, nil
+}
+
+// importTitle uses the file name without its extension as document title
+func importTitle(name string) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	title := strings.TrimSpace(strings.TrimSuffix(base, path.Ext(base)))
+	if title == "" || title == "." || title == "/" {
+		return "Untitled"
+	}
+	if runes := []rune(title); len(runes) > 255 {
+		title = string(runes[:255])
+	}
+	return title
+}
+
+type PaginatedSearchResults struct {
+	Data []DocumentSearchResult `json:"data"`
+	Meta DocumentsMeta          `json:"meta"`
+}
+
+func (s *DefaultService) SearchDocuments(ctx context.Context, userID uint64, query string, page, pageSize int) (*PaginatedSearchResults, error) {
+	results, meta, err := s.repository.SearchDocuments(ctx, userID, query, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedSearchResults{Data: results, Meta: meta}, nil
+}
+
+// scheduleContentIndex decodes the document text in the background and
+// refreshes its full-text index
+func (s *DefaultService) scheduleContentIndex(docID uint64) {
+	s.workerPool.Submit(func(bgCtx context.Context) error {
+		timeoutCtx, cancel := context.WithTimeout(bgCtx, 30*time.Second)
+		defer cancel()
+
+		state, err := s.GetDocumentState(timeoutCtx, docID)
+		if err != nil {
+			return err
+		}
+		content, err := s.decodeText(state)
+		if err != nil {
+			return err
+		}
+		return s.repository.UpdateSearchContent(timeoutCtx, docID, content)
+	})
+}
@@ -0,0 +1,669 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"collaborative-markdown-editor/internal/config"
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
+	"collaborative-markdown-editor/internal/notification"
+	"collaborative-markdown-editor/internal/sync"
+	"collaborative-markdown-editor/internal/worker"
+	"collaborative-markdown-editor/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// MockRepository mocks the repository methods a test sets up, the others
+// panic on the nil embedded interface
+type MockRepository struct {
+	mock.Mock
+	DocumentRepository
+}
+
+func (m *MockRepository) GetUserRole(ctx context.Context, docID uint64, userID uint64) (string, error) {
+	args := m.Called(ctx, docID, userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) FindShareLink(ctx context.Context, tokenHash string, link *domain.DocumentShareLink) error {
+	args := m.Called(ctx, tokenHash, link)
+	if found, ok := args.Get(0).(*domain.DocumentShareLink); ok {
+		*link = *found
+		return nil
+	}
+	return args.Error(1)
+}
+
+func (m *MockRepository) RedeemShareLink(ctx context.Context, linkID uint64, userID uint64) (string, bool, error) {
+	args := m.Called(ctx, linkID, userID)
+	return args.String(0), args.Bool(1), args.Error(2)
+}
+
+func (m *MockRepository) EffectiveRoles(ctx context.Context, docIDs []uint64, userIDs []uint64) ([]userRoleRow, error) {
+	args := m.Called(ctx, docIDs, userIDs)
+	return args.Get(0).([]userRoleRow), args.Error(1)
+}
+
+func (m *MockRepository) IsTeamMember(ctx context.Context, teamID uint64, userID uint64) (bool, error) {
+	args := m.Called(ctx, teamID, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) TeamMemberIDs(ctx context.Context, teamID uint64) ([]uint64, error) {
+	args := m.Called(ctx, teamID)
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+func (m *MockRepository) SaveTeamGrant(ctx context.Context, grant *domain.DocumentTeamGrant) error {
+	return m.Called(ctx, grant).Error(0)
+}
+
+func (m *MockRepository) ListTeamGrants(ctx context.Context, docID uint64) ([]teamGrantRow, error) {
+	args := m.Called(ctx, docID)
+	return args.Get(0).([]teamGrantRow), args.Error(1)
+}
+
+func (m *MockRepository) DeleteTeamGrant(ctx context.Context, docID uint64, teamID uint64) error {
+	return m.Called(ctx, docID, teamID).Error(0)
+}
+
+func (m *MockRepository) FindByID(ctx context.Context, id uint64) (*domain.Document, error) {
+	args := m.Called(ctx, id)
+	doc, _ := args.Get(0).(*domain.Document)
+	return doc, args.Error(1)
+}
+
+func (m *MockRepository) GetWorkspaceRole(ctx context.Context, workspaceID uint64, userID uint64) (string, error) {
+	args := m.Called(ctx, workspaceID, userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) WorkspaceAdminIDs(ctx context.Context, workspaceID uint64) ([]uint64, error) {
+	args := m.Called(ctx, workspaceID)
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+func (m *MockRepository) SetWorkspace(ctx context.Context, docID uint64, workspaceID uint64) error {
+	return m.Called(ctx, docID, workspaceID).Error(0)
+}
+
+func (m *MockRepository) GetCollaborator(ctx context.Context, docID uint64, userID uint64, collab *domain.DocumentCollaborator) error {
+	args := m.Called(ctx, docID, userID, collab)
+	if found, ok := args.Get(0).(*domain.DocumentCollaborator); ok {
+		*collab = *found
+		return nil
+	}
+	return args.Error(1)
+}
+
+func (m *MockRepository) UpdateCollaboratorRole(ctx context.Context, docID uint64, userID uint64, role string) error {
+	return m.Called(ctx, docID, userID, role).Error(0)
+}
+
+func (m *MockRepository) RemoveCollaborator(ctx context.Context, docID uint64, userID uint64) error {
+	return m.Called(ctx, docID, userID).Error(0)
+}
+
+func (m *MockRepository) TransferOwnership(ctx context.Context, docID uint64, ownerID uint64, newOwnerID uint64) error {
+	return m.Called(ctx, docID, ownerID, newOwnerID).Error(0)
+}
+
+// roleChange is a permission change sent to the sync server
+type roleChange struct {
+	DocumentID uint64
+	UserID     uint64
+	Role       string
+}
+
+// serviceEvents records what a service under test sends to the cache and the
+// sync server
+type serviceEvents struct {
+	versionKeys chan string
+	roleChanges chan roleChange
+	pool        *worker.WorkerPool
+	stopped     bool
+}
+
+// incremented returns the cache versions incremented so far
+func (e *serviceEvents) incremented() []string {
+	var keys []string
+	for len(e.versionKeys) > 0 {
+		keys = append(keys, <-e.versionKeys)
+	}
+	return keys
+}
+
+// notified waits for the notifications in flight and returns the role changes
+// the sync server received. The service can't notify afterwards.
+func (e *serviceEvents) notified() []roleChange {
+	e.stop()
+	var changes []roleChange
+	for len(e.roleChanges) > 0 {
+		changes = append(changes, <-e.roleChanges)
+	}
+	return changes
+}
+
+// stop waits for the notifications in flight, they would reach the sync
+// server of the next test otherwise
+func (e *serviceEvents) stop() {
+	if !e.stopped {
+		e.stopped = true
+		e.pool.Shutdown()
+	}
+}
+
+// versionHook answers the cache commands without a server and records the
+// incremented versions
+type versionHook struct{ keys chan string }
+
+func (h versionHook) DialHook(next goredis.DialHook) goredis.DialHook { return next }
+
+func (h versionHook) ProcessHook(next goredis.ProcessHook) goredis.ProcessHook {
+	return func(ctx context.Context, cmd goredis.Cmder) error {
+		switch cmd.Name() {
+		case "incr":
+			h.keys <- cmd.Args()[1].(string)
+		case "get":
+			cmd.SetErr(goredis.Nil)
+			return goredis.Nil
+		}
+		return nil
+	}
+}
+
+func (h versionHook) ProcessPipelineHook(next goredis.ProcessPipelineHook) goredis.ProcessPipelineHook {
+	return next
+}
+
+// newTestService returns a service on a mocked repository, with a cache and a
+// sync server that record what they receive
+func newTestService(t *testing.T) (*DefaultService, *MockRepository, *serviceEvents) {
+	events := &serviceEvents{
+		versionKeys: make(chan string, 100),
+		roleChanges: make(chan roleChange, 100),
+		pool:        worker.NewWorkerPool(1),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var docID uint64
+		var req sync.UpdateRequest
+		_, err := fmt.Sscanf(r.URL.Path, "/internal/documents/%d/permission", &docID)
+		if err != nil || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.NotFound(w, r)
+			return
+		}
+		events.roleChanges <- roleChange{DocumentID: docID, UserID: req.UserID, Role: req.Role}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(events.stop)
+	config.AppConfig.SyncServerAddress = server.URL
+	config.AppConfig.SyncServerGRPCAddress = ""
+
+	client := goredis.NewClient(&goredis.Options{Addr: "cache.invalid:6379"})
+	client.AddHook(versionHook{keys: events.versionKeys})
+	t.Cleanup(func() { client.Close() })
+
+	repo := &MockRepository{}
+	syncClient := sync.NewSyncClient()
+	s := &DefaultService{
+		repository:        repo,
+		syncClient:        syncClient,
+		cache:             redis.NewCache(client),
+		textName:          "t",
+		workerPool:        events.pool,
+		noficationService: notification.NewService(nil, events.pool, syncClient),
+	}
+	return s, repo, events
+}
+
+// assertAPIError asserts that err is an API error with status
+func assertAPIError(t *testing.T, err error, status int) {
+	t.Helper()
+	var apiErr *errors.APIError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, status, apiErr.Status)
+	}
+}
+
+// TestDecodeText_MissingUpdates tests that a state whose updates depend on
+// updates that are not stored is rejected instead of read as partial text
+func TestDecodeText_MissingUpdates(t *testing.T) {
+	s := &DefaultService{textName: "t"}
+	// client 1 clocks 0-2 insert "abc"
+	insertABC := []byte{0x01, 0x01, 0x01, 0x00, 0x04, 0x01, 0x01, 0x74, 0x03, 0x61, 0x62, 0x63, 0x00}
+	// client 1 clock 5 appends "f" after clock 4, clocks 3-4 are missing
+	appendF := []byte{0x01, 0x01, 0x01, 0x05, 0x84, 0x01, 0x04, 0x01, 0x66, 0x00}
+
+	text, err := s.decodeText(&DocumentStateResponse{Snapshot: insertABC})
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", text)
+
+	_, err = s.decodeText(&DocumentStateResponse{
+		Snapshot: insertABC,
+		Updates:  []DocumentUpdateDTO{{Seq: 2, Binary: appendF}},
+	})
+	assertAPIError(t, err, http.StatusUnprocessableEntity)
+}
+
+// newTestShareLink returns a link of document 1 and its token, protected by
+// password unless it is empty
+func newTestShareLink(t *testing.T, password string) (*domain.DocumentShareLink, string) {
+	token, err := newToken()
+	assert.NoError(t, err)
+	link := &domain.DocumentShareLink{
+		ID:             5,
+		DocumentID:     1,
+		TokenHash:      hashToken(token),
+		Role:           "viewer",
+		AllowAnonymous: true,
+	}
+	if password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		assert.NoError(t, err)
+		passwordHash := string(hashed)
+		link.PasswordHash = &passwordHash
+	}
+	return link, token
+}
+
+// TestFetchUserRole_ShareToken tests when a share token makes a user who is
+// not a collaborator, or an anonymous one, a viewer
+func TestFetchUserRole_ShareToken(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		userID   uint64
+		password string
+		change   func(link *domain.DocumentShareLink)
+		want     string
+	}{
+		{name: "anonymous", want: "viewer"},
+		{name: "signed in user", userID: 3, want: "viewer"},
+		{name: "not expired", change: func(l *domain.DocumentShareLink) { l.ExpiresAt = &future }, want: "viewer"},
+		{name: "expired", change: func(l *domain.DocumentShareLink) { l.ExpiresAt = &past }, want: "none"},
+		{name: "anonymous access not allowed", change: func(l *domain.DocumentShareLink) { l.AllowAnonymous = false }, want: "none"},
+		{name: "link of another document", change: func(l *domain.DocumentShareLink) { l.DocumentID = 2 }, want: "none"},
+		{name: "right password", password: "s3cret", change: protectWith(t, "s3cret"), want: "viewer"},
+		{name: "wrong password", password: "guess", change: protectWith(t, "s3cret"), want: "none"},
+		{name: "missing password", change: protectWith(t, "s3cret"), want: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, _ := newTestService(t)
+			link, token := newTestShareLink(t, "")
+			if tt.change != nil {
+				tt.change(link)
+			}
+			repo.On("GetUserRole", mock.Anything, uint64(1), tt.userID).Return("none", nil)
+			repo.On("FindShareLink", mock.Anything, hashToken(token), mock.Anything).Return(link, nil)
+
+			role, err := s.FetchUserRole(context.Background(), 1, tt.userID, &ShareCredentials{Token: token, Password: tt.password})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, role)
+		})
+	}
+}
+
+// protectWith returns a change of a link that protects it by password
+func protectWith(t *testing.T, password string) func(link *domain.DocumentShareLink) {
+	protected, _ := newTestShareLink(t, password)
+	return func(link *domain.DocumentShareLink) { link.PasswordHash = protected.PasswordHash }
+}
+
+// TestFetchUserRole_Collaborator tests that the role of a collaborator is
+// kept without looking at the token, and that an unknown token grants nothing
+func TestFetchUserRole_Collaborator(t *testing.T) {
+	s, repo, _ := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(3)).Return("editor", nil)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(4)).Return("none", nil)
+	repo.On("FindShareLink", mock.Anything, hashToken("unknown"), mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+
+	role, err := s.FetchUserRole(context.Background(), 1, 3, &ShareCredentials{Token: "any"})
+	assert.NoError(t, err)
+	assert.Equal(t, "editor", role)
+
+	role, err = s.FetchUserRole(context.Background(), 1, 4, &ShareCredentials{Token: "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, "none", role)
+	repo.AssertNumberOfCalls(t, "FindShareLink", 1)
+}
+
+// TestRedeemShareLink_Rejected tests that expired links, wrong passwords and
+// used up links give no access
+func TestRedeemShareLink_Rejected(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
+	t.Run("expired", func(t *testing.T) {
+		s, repo, _ := newTestService(t)
+		link, token := newTestShareLink(t, "")
+		link.ExpiresAt = &past
+		repo.On("FindShareLink", mock.Anything, hashToken(token), mock.Anything).Return(link, nil)
+
+		_, err := s.RedeemShareLink(context.Background(), token, 3, "")
+		assertAPIError(t, err, http.StatusNotFound)
+		repo.AssertNotCalled(t, "RedeemShareLink", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		s, repo, _ := newTestService(t)
+		link, token := newTestShareLink(t, "s3cret")
+		repo.On("FindShareLink", mock.Anything, hashToken(token), mock.Anything).Return(link, nil)
+
+		_, err := s.RedeemShareLink(context.Background(), token, 3, "guess")
+		assertAPIError(t, err, http.StatusForbidden)
+		repo.AssertNotCalled(t, "RedeemShareLink", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("used up", func(t *testing.T) {
+		s, repo, events := newTestService(t)
+		link, token := newTestShareLink(t, "")
+		repo.On("FindShareLink", mock.Anything, hashToken(token), mock.Anything).Return(link, nil)
+		repo.On("RedeemShareLink", mock.Anything, uint64(5), uint64(3)).Return("", false, ErrShareLinkUsedUp)
+
+		_, err := s.RedeemShareLink(context.Background(), token, 3, "")
+		assertAPIError(t, err, http.StatusForbidden)
+		assert.Empty(t, events.notified())
+	})
+}
+
+// TestRedeemShareLink_Notifies tests that a redemption that changed the role
+// refreshes the shared documents of the user and notifies the sync server,
+// and that one that did not sends nothing
+func TestRedeemShareLink_Notifies(t *testing.T) {
+	s, repo, events := newTestService(t)
+	link, token := newTestShareLink(t, "s3cret")
+	repo.On("FindShareLink", mock.Anything, hashToken(token), mock.Anything).Return(link, nil)
+	repo.On("RedeemShareLink", mock.Anything, uint64(5), uint64(3)).Return("viewer", true, nil)
+	repo.On("RedeemShareLink", mock.Anything, uint64(5), uint64(4)).Return("editor", false, nil)
+	repo.On("EffectiveRoles", mock.Anything, []uint64{1}, []uint64{3}).
+		Return([]userRoleRow{{DocumentID: 1, UserID: 3, Role: "viewer"}}, nil)
+
+	redemption, err := s.RedeemShareLink(context.Background(), token, 3, "s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, &ShareLinkRedemption{DocumentID: 1, Role: "viewer"}, redemption)
+
+	// an editor keeps their role
+	redemption, err = s.RedeemShareLink(context.Background(), token, 4, "s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, "editor", redemption.Role)
+
+	assert.Equal(t, []string{"user:3:docs:shared:version"}, events.incremented())
+	assert.Equal(t, []roleChange{{DocumentID: 1, UserID: 3, Role: "viewer"}}, events.notified())
+	repo.AssertExpectations(t)
+}
+
+// TestGrantTeam_NotifiesMembers tests that every member of a team gets their
+// resolved role on the document once the team is granted access
+func TestGrantTeam_NotifiesMembers(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(2)).Return("owner", nil)
+	repo.On("IsTeamMember", mock.Anything, uint64(7), uint64(2)).Return(true, nil)
+	repo.On("SaveTeamGrant", mock.Anything, mock.MatchedBy(func(g *domain.DocumentTeamGrant) bool {
+		return g.DocumentID == 1 && g.TeamID == 7 && g.Role == "viewer"
+	})).Return(nil)
+	repo.On("TeamMemberIDs", mock.Anything, uint64(7)).Return([]uint64{2, 3, 4}, nil)
+	// the owner and a direct editor keep their higher role
+	repo.On("EffectiveRoles", mock.Anything, []uint64{1}, []uint64{2, 3, 4}).Return([]userRoleRow{
+		{DocumentID: 1, UserID: 2, Role: "owner"},
+		{DocumentID: 1, UserID: 3, Role: "editor"},
+		{DocumentID: 1, UserID: 4, Role: "viewer"},
+	}, nil)
+	repo.On("ListTeamGrants", mock.Anything, uint64(1)).
+		Return([]teamGrantRow{{TeamID: 7, Name: "Design", Role: "viewer", MemberCount: 3}}, nil)
+
+	grant, err := s.GrantTeam(context.Background(), 1, 2, 7, "viewer")
+	assert.NoError(t, err)
+	assert.Equal(t, "Design", grant.Name)
+
+	assert.Equal(t, []string{
+		"user:2:docs:shared:version",
+		"user:3:docs:shared:version",
+		"user:4:docs:shared:version",
+	}, events.incremented())
+	assert.Equal(t, []roleChange{
+		{DocumentID: 1, UserID: 2, Role: "owner"},
+		{DocumentID: 1, UserID: 3, Role: "editor"},
+		{DocumentID: 1, UserID: 4, Role: "viewer"},
+	}, events.notified())
+}
+
+// TestGrantTeam_NotMember tests that the owner can only share with their teams
+func TestGrantTeam_NotMember(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(2)).Return("owner", nil)
+	repo.On("IsTeamMember", mock.Anything, uint64(7), uint64(2)).Return(false, nil)
+
+	_, err := s.GrantTeam(context.Background(), 1, 2, 7, "viewer")
+	assertAPIError(t, err, http.StatusUnprocessableEntity)
+	repo.AssertNotCalled(t, "SaveTeamGrant", mock.Anything, mock.Anything)
+	assert.Empty(t, events.notified())
+}
+
+// TestRevokeTeamGrant_NotifiesMembers tests that the members of a team are
+// told the role they keep once its access is revoked
+func TestRevokeTeamGrant_NotifiesMembers(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(2)).Return("owner", nil)
+	repo.On("DeleteTeamGrant", mock.Anything, uint64(1), uint64(7)).Return(nil)
+	repo.On("TeamMemberIDs", mock.Anything, uint64(7)).Return([]uint64{3, 4}, nil)
+	repo.On("EffectiveRoles", mock.Anything, []uint64{1}, []uint64{3, 4}).Return([]userRoleRow{
+		{DocumentID: 1, UserID: 3, Role: "viewer"},
+		{DocumentID: 1, UserID: 4, Role: "none"},
+	}, nil)
+
+	assert.NoError(t, s.RevokeTeamGrant(context.Background(), 1, 2, 7))
+
+	assert.Equal(t, []string{"user:3:docs:shared:version", "user:4:docs:shared:version"}, events.incremented())
+	assert.Equal(t, []roleChange{
+		{DocumentID: 1, UserID: 3, Role: "viewer"},
+		{DocumentID: 1, UserID: 4, Role: "none"},
+	}, events.notified())
+}
+
+// workspaceDocument returns document 1 created by user 2 in workspace 9
+func workspaceDocument() *domain.Document {
+	workspaceID := uint64(9)
+	return &domain.Document{ID: 1, UserID: 2, WorkspaceID: &workspaceID}
+}
+
+// TestMoveToWorkspace_CreatorCantMoveOut tests that the creator of a
+// workspace document, who still owns it, can't move it out of the workspace
+func TestMoveToWorkspace_CreatorCantMoveOut(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(2)).Return("owner", nil)
+	repo.On("FindByID", mock.Anything, uint64(1)).Return(workspaceDocument(), nil)
+	repo.On("GetWorkspaceRole", mock.Anything, uint64(9), uint64(2)).Return("member", nil)
+
+	err := s.MoveToWorkspace(context.Background(), 1, 2, 10)
+	assertAPIError(t, err, http.StatusForbidden)
+	repo.AssertNotCalled(t, "SetWorkspace", mock.Anything, mock.Anything, mock.Anything)
+	assert.Empty(t, events.incremented())
+	assert.Empty(t, events.notified())
+}
+
+// TestMoveToWorkspace_AdminMovesOut tests that an admin of the current
+// workspace moves a document to another one, the admins of both are told
+// their new role
+func TestMoveToWorkspace_AdminMovesOut(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(3)).Return("owner", nil)
+	repo.On("FindByID", mock.Anything, uint64(1)).Return(workspaceDocument(), nil)
+	repo.On("GetWorkspaceRole", mock.Anything, uint64(9), uint64(3)).Return("admin", nil)
+	repo.On("GetWorkspaceRole", mock.Anything, uint64(10), uint64(3)).Return("member", nil)
+	repo.On("WorkspaceAdminIDs", mock.Anything, uint64(9)).Return([]uint64{3}, nil)
+	repo.On("WorkspaceAdminIDs", mock.Anything, uint64(10)).Return([]uint64{4}, nil)
+	repo.On("SetWorkspace", mock.Anything, uint64(1), uint64(10)).Return(nil)
+	repo.On("EffectiveRoles", mock.Anything, []uint64{1}, []uint64{3, 4}).Return([]userRoleRow{
+		{DocumentID: 1, UserID: 3, Role: "none"},
+		{DocumentID: 1, UserID: 4, Role: "owner"},
+	}, nil)
+
+	assert.NoError(t, s.MoveToWorkspace(context.Background(), 1, 3, 10))
+	repo.AssertExpectations(t)
+
+	assert.Equal(t, []string{
+		"user:2:docs:version",
+		"user:3:docs:shared:version",
+		"user:4:docs:shared:version",
+	}, events.incremented())
+	assert.Equal(t, []roleChange{
+		{DocumentID: 1, UserID: 3, Role: "none"},
+		{DocumentID: 1, UserID: 4, Role: "owner"},
+	}, events.notified())
+}
+
+// TestChangeCollaboratorRole_Creator tests that only the admins of the
+// workspace owning a document demote its creator
+func TestChangeCollaboratorRole_Creator(t *testing.T) {
+	personal := &domain.Document{ID: 1, UserID: 2}
+	for name, tc := range map[string]struct {
+		doc       *domain.Document
+		wsRole    string
+		wantError int
+	}{
+		"personal document": {doc: personal, wantError: http.StatusUnprocessableEntity},
+		"not admin":         {doc: workspaceDocument(), wsRole: "member", wantError: http.StatusForbidden},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, repo, events := newTestService(t)
+			repo.On("GetUserRole", mock.Anything, uint64(1), uint64(3)).Return("owner", nil)
+			repo.On("GetCollaborator", mock.Anything, uint64(1), uint64(2), mock.Anything).
+				Return(&domain.DocumentCollaborator{DocumentID: 1, UserID: 2, Role: "owner"}, nil)
+			repo.On("FindByID", mock.Anything, uint64(1)).Return(tc.doc, nil)
+			repo.On("GetWorkspaceRole", mock.Anything, uint64(9), uint64(3)).Return(tc.wsRole, nil)
+
+			_, err := s.ChangeCollaboratorRole(context.Background(), 1, 3, 2, "viewer")
+			assertAPIError(t, err, tc.wantError)
+			repo.AssertNotCalled(t, "UpdateCollaboratorRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			assert.Empty(t, events.notified())
+		})
+	}
+}
+
+// TestRemoveCollaborator_CreatorByAdmin tests that a workspace admin removes
+// the creator of a document, who loses it from their own documents
+func TestRemoveCollaborator_CreatorByAdmin(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(3)).Return("owner", nil)
+	repo.On("GetCollaborator", mock.Anything, uint64(1), uint64(2), mock.Anything).
+		Return(&domain.DocumentCollaborator{DocumentID: 1, UserID: 2, Role: "owner"}, nil)
+	repo.On("FindByID", mock.Anything, uint64(1)).Return(workspaceDocument(), nil)
+	repo.On("GetWorkspaceRole", mock.Anything, uint64(9), uint64(3)).Return("admin", nil)
+	repo.On("RemoveCollaborator", mock.Anything, uint64(1), uint64(2)).Return(nil)
+	repo.On("EffectiveRoles", mock.Anything, []uint64{1}, []uint64{2}).
+		Return([]userRoleRow{{DocumentID: 1, UserID: 2, Role: "none"}}, nil)
+
+	assert.NoError(t, s.RemoveCollaborator(context.Background(), 1, 3, 2))
+	repo.AssertExpectations(t)
+
+	assert.Equal(t, []string{"user:2:docs:version", "user:2:docs:shared:version"}, events.incremented())
+	assert.Equal(t, []roleChange{{DocumentID: 1, UserID: 2, Role: "none"}}, events.notified())
+}
+
+// TestTransferOwnership_WorkspaceAdmin tests that a workspace admin hands a
+// document over from its creator, but a plain member can't
+func TestTransferOwnership_WorkspaceAdmin(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("FindByID", mock.Anything, uint64(1)).Return(workspaceDocument(), nil)
+	// admins own the documents of the workspace, plain members don't
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(3)).Return("owner", nil)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(5)).Return("editor", nil)
+	repo.On("TransferOwnership", mock.Anything, uint64(1), uint64(2), uint64(4)).Return(nil)
+	repo.On("EffectiveRoles", mock.Anything, []uint64{1}, []uint64{2, 4}).Return([]userRoleRow{
+		{DocumentID: 1, UserID: 2, Role: "editor"},
+		{DocumentID: 1, UserID: 4, Role: "owner"},
+	}, nil)
+
+	assertAPIError(t, s.TransferOwnership(context.Background(), 1, 5, 4), http.StatusForbidden)
+	assert.NoError(t, s.TransferOwnership(context.Background(), 1, 3, 4))
+	repo.AssertNumberOfCalls(t, "TransferOwnership", 1)
+	assert.Equal(t, []roleChange{
+		{DocumentID: 1, UserID: 2, Role: "editor"},
+		{DocumentID: 1, UserID: 4, Role: "owner"},
+	}, events.notified())
+}
+
+// TestTransferOwnership_Notifies tests that both users see the document move
+// between their own and shared documents and are told their new role
+func TestTransferOwnership_Notifies(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(2)).Return("owner", nil)
+	repo.On("FindByID", mock.Anything, uint64(1)).Return(&domain.Document{ID: 1, UserID: 2}, nil)
+	repo.On("TransferOwnership", mock.Anything, uint64(1), uint64(2), uint64(3)).Return(nil)
+	repo.On("EffectiveRoles", mock.Anything, []uint64{1}, []uint64{2, 3}).Return([]userRoleRow{
+		{DocumentID: 1, UserID: 2, Role: "editor"},
+		{DocumentID: 1, UserID: 3, Role: "owner"},
+	}, nil)
+
+	assert.NoError(t, s.TransferOwnership(context.Background(), 1, 2, 3))
+
+	assert.Equal(t, []string{
+		"user:2:docs:version",
+		"user:3:docs:version",
+		"user:2:docs:shared:version",
+		"user:3:docs:shared:version",
+	}, events.incremented())
+	assert.Equal(t, []roleChange{
+		{DocumentID: 1, UserID: 2, Role: "editor"},
+		{DocumentID: 1, UserID: 3, Role: "owner"},
+	}, events.notified())
+}
+
+// TestTransferOwnership_Refused tests that only the owner hands a personal
+// document over, to a direct editor, and nobody is notified otherwise
+func TestTransferOwnership_Refused(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(2)).Return("owner", nil)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(4)).Return("none", nil)
+	repo.On("FindByID", mock.Anything, uint64(1)).Return(&domain.Document{ID: 1, UserID: 2}, nil)
+	repo.On("TransferOwnership", mock.Anything, uint64(1), uint64(2), uint64(3)).Return(ErrNotEditor)
+
+	assertAPIError(t, s.TransferOwnership(context.Background(), 1, 2, 3), http.StatusUnprocessableEntity)
+	assertAPIError(t, s.TransferOwnership(context.Background(), 1, 4, 3), http.StatusForbidden)
+	repo.AssertNumberOfCalls(t, "TransferOwnership", 1)
+	assert.Empty(t, events.incremented())
+	assert.Empty(t, events.notified())
+}
+
+// TestTransferOwnership_DemotedCreator tests that a creator a workspace admin
+// demoted can't hand the document over, and that an admin can't either while
+// the creator lacks the owner role
+func TestTransferOwnership_DemotedCreator(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(2)).Return("viewer", nil)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(3)).Return("owner", nil)
+	repo.On("FindByID", mock.Anything, uint64(1)).Return(workspaceDocument(), nil)
+	repo.On("TransferOwnership", mock.Anything, uint64(1), uint64(2), uint64(4)).Return(ErrNotOwner)
+
+	assertAPIError(t, s.TransferOwnership(context.Background(), 1, 2, 4), http.StatusForbidden)
+	assertAPIError(t, s.TransferOwnership(context.Background(), 1, 3, 4), http.StatusConflict)
+	repo.AssertNumberOfCalls(t, "TransferOwnership", 1)
+	assert.Empty(t, events.incremented())
+	assert.Empty(t, events.notified())
+}
+
+// TestDeleteDocument_RemovedCreator tests that a creator removed from the
+// workspace owning the document, left an editor, can't delete it
+func TestDeleteDocument_RemovedCreator(t *testing.T) {
+	s, repo, events := newTestService(t)
+	repo.On("GetUserRole", mock.Anything, uint64(1), uint64(2)).Return("editor", nil)
+
+	assertAPIError(t, s.DeleteDocument(context.Background(), 1, 2), http.StatusForbidden)
+	repo.AssertNotCalled(t, "DeleteDocument", mock.Anything, mock.Anything)
+	assert.Empty(t, events.notified())
+}
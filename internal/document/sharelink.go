@@ -0,0 +1,277 @@
+package document
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	defError "errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ShareLinkOptions configures a new share link
+type ShareLinkOptions struct {
+	Role           string     `json:"role" binding:"required,oneof=editor viewer"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	MaxUses        *int       `json:"max_uses" binding:"omitempty,min=1"`
+	Password       string     `json:"password" binding:"omitempty,min=4,max=72"`
+	AllowAnonymous bool       `json:"allow_anonymous"`
+}
+
+type ShareLinkDTO struct {
+	ID uint64 `json:"id"`
+	// only returned when the link is created
+	Token             string     `json:"token,omitempty"`
+	Role              string     `json:"role"`
+	AllowAnonymous    bool       `json:"allow_anonymous"`
+	PasswordProtected bool       `json:"password_protected"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	MaxUses           *int       `json:"max_uses"`
+	Uses              int        `json:"uses"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// ShareLinkPreview is what anyone holding a token can see about the link. The
+// title is left out until the password is given.
+type ShareLinkPreview struct {
+	DocumentID        uint64     `json:"document_id"`
+	Title             string     `json:"title,omitempty"`
+	Role              string     `json:"role"`
+	AllowAnonymous    bool       `json:"allow_anonymous"`
+	PasswordProtected bool       `json:"password_protected"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+}
+
+type ShareLinkRedemption struct {
+	DocumentID uint64 `json:"document_id"`
+	Role       string `json:"role"`
+}
+
+// ShareCredentials are the share link token and password presented with a
+// permission check, for users who are not collaborators
+type ShareCredentials struct {
+	Token    string
+	Password string
+}
+
+func toShareLinkDTO(link *domain.DocumentShareLink) ShareLinkDTO {
+	return ShareLinkDTO{
+		ID:                link.ID,
+		Role:              link.Role,
+		AllowAnonymous:    link.AllowAnonymous,
+		PasswordProtected: link.PasswordHash != nil,
+		ExpiresAt:         link.ExpiresAt,
+		MaxUses:           link.MaxUses,
+		Uses:              link.Uses,
+		CreatedAt:         link.CreatedAt,
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (s *DefaultService) CreateShareLink(ctx context.Context, docID uint64, userID uint64, opts ShareLinkOptions) (*ShareLinkDTO, error) {
+	role, err := s.repository.GetUserRole(ctx, docID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != "owner" {
+		return nil, errors.Forbidden("Only owner can create share link!", nil)
+	}
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return nil, errors.UnprocessableEntity("Expiry must be in the future", nil)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	link := domain.DocumentShareLink{
+		DocumentID:     docID,
+		TokenHash:      hashToken(token),
+		Role:           opts.Role,
+		AllowAnonymous: opts.AllowAnonymous,
+		MaxUses:        opts.MaxUses,
+		CreatedBy:      userID,
+	}
+	if opts.ExpiresAt != nil {
+		expiresAt := opts.ExpiresAt.UTC()
+		link.ExpiresAt = &expiresAt
+	}
+	if opts.Password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash := string(hashed)
+		link.PasswordHash = &passwordHash
+	}
+
+	if err := s.repository.CreateShareLink(ctx, &link); err != nil {
+		return nil, err
+	}
+
+	dto := toShareLinkDTO(&link)
+	dto.Token = token
+	return &dto, nil
+}
+
+func (s *DefaultService) ListShareLinks(ctx context.Context, docID uint64, userID uint64) ([]ShareLinkDTO, error) {
+	role, err := s.repository.GetUserRole(ctx, docID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != "owner" {
+		return nil, errors.Forbidden("Only owner can show share links", nil)
+	}
+
+	links, err := s.repository.ListShareLinks(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ShareLinkDTO, 0, len(links))
+	for i := range links {
+		result = append(result, toShareLinkDTO(&links[i]))
+	}
+	return result, nil
+}
+
+// RevokeShareLink deletes a link. Collaborators who redeemed it keep their
+// access.
+func (s *DefaultService) RevokeShareLink(ctx context.Context, docID uint64, userID uint64, linkID uint64) error {
+	role, err := s.repository.GetUserRole(ctx, docID, userID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return errors.Forbidden("Only owner can revoke share link", nil)
+	}
+
+	if err := s.repository.DeleteShareLink(ctx, docID, linkID); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("Share link not found", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// findShareLink returns the link of token if it has not expired
+func (s *DefaultService) findShareLink(ctx context.Context, token string) (*domain.DocumentShareLink, error) {
+	var link domain.DocumentShareLink
+	if err := s.repository.FindShareLink(ctx, hashToken(token), &link); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Share link not found", err)
+		}
+		return nil, err
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return nil, errors.NotFound("Share link has expired", nil)
+	}
+	return &link, nil
+}
+
+func checkSharePassword(link *domain.DocumentShareLink, password string) error {
+	if link.PasswordHash == nil {
+		return nil
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(*link.PasswordHash), []byte(password)); err != nil {
+		return errors.Forbidden("Invalid share link password", err)
+	}
+	return nil
+}
+
+func (s *DefaultService) GetShareLink(ctx context.Context, token string) (*ShareLinkPreview, error) {
+	link, err := s.findShareLink(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &ShareLinkPreview{
+		DocumentID:        link.DocumentID,
+		Role:              link.Role,
+		AllowAnonymous:    link.AllowAnonymous,
+		PasswordProtected: link.PasswordHash != nil,
+		ExpiresAt:         link.ExpiresAt,
+	}
+	if link.PasswordHash == nil {
+		doc, err := s.repository.FindByID(ctx, link.DocumentID)
+		if err != nil {
+			return nil, err
+		}
+		preview.Title = doc.Title
+	}
+	return preview, nil
+}
+
+// RedeemShareLink gives userID the access of a link, see
+// DocumentRepository.RedeemShareLink
+func (s *DefaultService) RedeemShareLink(ctx context.Context, token string, userID uint64, password string) (*ShareLinkRedemption, error) {
+	link, err := s.findShareLink(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSharePassword(link, password); err != nil {
+		return nil, err
+	}
+
+	role, changed, err := s.repository.RedeemShareLink(ctx, link.ID, userID)
+	if err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("Share link not found", err)
+		}
+		if defError.Is(err, ErrShareLinkUsedUp) {
+			return nil, errors.Forbidden("Share link has no uses left", err)
+		}
+		return nil, err
+	}
+
+	if changed {
+		// the document shows up in the shared documents of the user, and an
+		// open session of an upgraded viewer learns it can edit
+		s.NotifyAccessChanged(ctx, []uint64{link.DocumentID}, []uint64{userID})
+	}
+
+	return &ShareLinkRedemption{DocumentID: link.DocumentID, Role: role}, nil
+}
+
+// FetchUserRole returns the role of userID on a document, "none" without
+// access. A user who is not a collaborator, or anonymous with userID 0, is a
+// viewer when share holds a valid link of the document that allows anonymous
+// access.
+func (s *DefaultService) FetchUserRole(ctx context.Context, docID, userID uint64, share *ShareCredentials) (string, error) {
+	role, err := s.repository.GetUserRole(ctx, docID, userID)
+	if err != nil || role != "none" || share == nil || share.Token == "" {
+		return role, err
+	}
+
+	link, err := s.findShareLink(ctx, share.Token)
+	if err != nil {
+		var apiErr *errors.APIError
+		if defError.As(err, &apiErr) {
+			return "none", nil // unknown or expired link
+		}
+		return "none", err
+	}
+	if link.DocumentID != docID || !link.AllowAnonymous || checkSharePassword(link, share.Password) != nil {
+		return "none", nil
+	}
+	return "viewer", nil
+}
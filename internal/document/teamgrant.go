@@ -0,0 +1,160 @@
+package document
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
+	"context"
+	defError "errors"
+	"fmt"
+	"time"
+
+	log "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+type TeamGrantDTO struct {
+	TeamID      uint64    `json:"team_id"`
+	Name        string    `json:"name"`
+	Role        string    `json:"role"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GrantTeam gives every member of a team role on a document, or changes the
+// role of the team. The owner must be a member of the team.
+func (s *DefaultService) GrantTeam(ctx context.Context, docID uint64, requesterID uint64, teamID uint64, role string) (*TeamGrantDTO, error) {
+	requesterRole, err := s.repository.GetUserRole(ctx, docID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if requesterRole != "owner" {
+		return nil, errors.Forbidden("Only owner can share with team!", nil)
+	}
+
+	member, err := s.repository.IsTeamMember(ctx, teamID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, errors.UnprocessableEntity("Can't find team!", nil)
+	}
+
+	grant := domain.DocumentTeamGrant{
+		DocumentID: docID,
+		TeamID:     teamID,
+		Role:       role,
+		GrantedBy:  requesterID,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := s.repository.SaveTeamGrant(ctx, &grant); err != nil {
+		return nil, err
+	}
+
+	s.notifyTeamAccessChanged(ctx, docID, teamID)
+
+	rows, err := s.repository.ListTeamGrants(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if r.TeamID == teamID {
+			dto := toTeamGrantDTO(r)
+			return &dto, nil
+		}
+	}
+	return nil, errors.NotFound("Team grant not found", nil)
+}
+
+func toTeamGrantDTO(r teamGrantRow) TeamGrantDTO {
+	return TeamGrantDTO{
+		TeamID:      r.TeamID,
+		Name:        r.Name,
+		Role:        r.Role,
+		MemberCount: r.MemberCount,
+		CreatedAt:   r.CreatedAt,
+	}
+}
+
+func (s *DefaultService) ListTeamGrants(ctx context.Context, docID uint64, requesterID uint64) ([]TeamGrantDTO, error) {
+	role, err := s.repository.GetUserRole(ctx, docID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "none" {
+		return nil, errors.Forbidden("You're not collaborator", nil)
+	}
+	if role == "viewer" {
+		return nil, errors.Forbidden("Viewer can't show teams", nil)
+	}
+
+	rows, err := s.repository.ListTeamGrants(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]TeamGrantDTO, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, toTeamGrantDTO(r))
+	}
+	return result, nil
+}
+
+func (s *DefaultService) RevokeTeamGrant(ctx context.Context, docID uint64, requesterID uint64, teamID uint64) error {
+	role, err := s.repository.GetUserRole(ctx, docID, requesterID)
+	if err != nil {
+		return err
+	}
+	if role != "owner" {
+		return errors.Forbidden("Only owner can revoke team access", nil)
+	}
+
+	if err := s.repository.DeleteTeamGrant(ctx, docID, teamID); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("Team grant not found", err)
+		}
+		return err
+	}
+
+	s.notifyTeamAccessChanged(ctx, docID, teamID)
+	return nil
+}
+
+// notifyTeamAccessChanged tells every member of a team their role on a
+// document after its grant changed
+func (s *DefaultService) notifyTeamAccessChanged(ctx context.Context, docID uint64, teamID uint64) {
+	members, err := s.repository.TeamMemberIDs(ctx, teamID)
+	if err != nil {
+		log.Error().Err(err).Uint64("team_id", teamID).Msg("failed to list team members")
+		return
+	}
+	s.NotifyAccessChanged(ctx, []uint64{docID}, members)
+}
+
+// NotifyOwnershipChanged is NotifyAccessChanged for users whose role changed
+// on documents they created, which their own documents list with it
+func (s *DefaultService) NotifyOwnershipChanged(ctx context.Context, docIDs []uint64, userIDs []uint64) {
+	for _, userID := range userIDs {
+		versionKey := fmt.Sprintf("user:%d:docs:version", userID)
+		s.cache.IncrementVersion(ctx, versionKey)
+	}
+	s.NotifyAccessChanged(ctx, docIDs, userIDs)
+}
+
+// NotifyAccessChanged refreshes the shared documents of userIDs and sends
+// each of them their current role on every document of docIDs, after their
+// direct or team grants changed. Users whose role did not change get it again.
+func (s *DefaultService) NotifyAccessChanged(ctx context.Context, docIDs []uint64, userIDs []uint64) {
+	for _, userID := range userIDs {
+		versionKey := fmt.Sprintf("user:%d:docs:shared:version", userID)
+		s.cache.IncrementVersion(ctx, versionKey)
+	}
+
+	roles, err := s.repository.EffectiveRoles(ctx, docIDs, userIDs)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to resolve roles to notify")
+		return
+	}
+	for _, r := range roles {
+		s.noficationService.NotifyUserRoleChanged(r.DocumentID, r.UserID, r.Role)
+	}
+}
@@ -0,0 +1,10 @@
+package domain
+
+import "time"
+
+// Blob is an object of the Postgres blob store
+type Blob struct {
+	Key       string `gorm:"primaryKey;size:255"`
+	Data      []byte `gorm:"type:bytea;not null"`
+	CreatedAt time.Time
+}
@@ -10,7 +10,15 @@ type Document struct {
 	ID            uint64    `gorm:"primaryKey;auto" json:"id"`
 	Title         string    `gorm:"type:text;not null" json:"title"`
 	UserID   	  uint64    `gorm:"not null;index" json:"user_id"`
+	// WorkspaceID is set when a workspace owns the document
+	WorkspaceID   *uint64   `gorm:"index" json:"workspace_id"`
 	UpdateSeq 	  uint64 	`gorm:"not null;default:0"`
+	// PendingSince is set while updates are not covered by a snapshot, so the
+	// snapshot scheduler only looks at those documents
+	PendingSince  *time.Time `gorm:"index:idx_documents_pending_since,where:pending_since IS NOT NULL" json:"-"`
+	// SnapshotAttemptAt is set when the scheduler queues a snapshot, so a
+	// document whose snapshot keeps failing waits before it is picked again
+	SnapshotAttemptAt *time.Time `json:"-"`
 	
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"` 
@@ -19,6 +27,11 @@ type Document struct {
 	Snapshots     []DocumentSnapshot `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 	Versions      []DocumentVersion  `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 	Collaborators []DocumentCollaborator `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	SnapshotPolicy *DocumentSnapshotPolicy `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	ShareLinks    []DocumentShareLink `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Invitations   []DocumentInvitation `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	TeamGrants    []DocumentTeamGrant `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UpdateKeys    []DocumentUpdateKey `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 }
 
 type DocumentUpdate struct {
@@ -26,15 +39,38 @@ type DocumentUpdate struct {
 	DocumentID    uint64    `gorm:"not null;index;index:idx_doc_seq,priority:1"`
 	Seq           uint64    `gorm:"not null;index:idx_doc_seq,priority:2"`
 	UpdateBinary  []byte    `gorm:"type:bytea;not null"`
+	// BlobKey is set when the update was offloaded to the blob store, the
+	// binary column is then empty and Checksum holds the SHA-256 of the blob
+	BlobKey       *string   `gorm:"size:255"`
+	Checksum      string    `gorm:"size:64"`
+	// Codec UpdateBinary is compressed with, empty for rows written before
+	// compression (see internal/codec)
+	Codec         string    `gorm:"size:16;not null;default:''"`
 	UserID        uint64    `gorm:"not null;index"`
+	// Size of the raw update, 0 for rows written before it was tracked
+	Size          int       `gorm:"not null;default:0"`
 	CreatedAt     time.Time
 }
 
+// DocumentUpdateKey is the seq a deduplicated update was stored under. It is
+// kept apart from document_updates so it outlives their compaction, and is
+// pruned by age instead.
+type DocumentUpdateKey struct {
+	DocumentID    uint64    `gorm:"primaryKey"`
+	UpdateKey     string    `gorm:"primaryKey;size:128"`
+	Seq           uint64    `gorm:"not null"`
+	CreatedAt     time.Time `gorm:"index"`
+}
+
 type DocumentSnapshot struct {
 	ID             uint64    `gorm:"primaryKey;autoIncrement"`
 	DocumentID     uint64    `gorm:"not null;index"`
 	Seq            uint64    `gorm:"not null;index"`
 	SnapshotBinary []byte    `gorm:"type:bytea;not null"`
+	// BlobKey, Checksum and Codec, as in DocumentUpdate
+	BlobKey        *string   `gorm:"size:255"`
+	Checksum       string    `gorm:"size:64"`
+	Codec          string    `gorm:"size:16;not null;default:''"`
 	CreatedAt      time.Time
 }
 
@@ -53,3 +89,58 @@ type DocumentCollaborator struct {
 	Role       string   `gorm:"type:text;not null"`
 	AddedAt    time.Time
 }
+
+// DocumentTeamGrant gives every member of a team a role on a document. A user
+// with several grants has the highest role.
+type DocumentTeamGrant struct {
+	DocumentID uint64 	`gorm:"primaryKey"`
+	TeamID     uint64	`gorm:"primaryKey;index"`
+	Role       string   `gorm:"type:text;not null"`
+	GrantedBy  uint64   `gorm:"not null"`
+	CreatedAt  time.Time
+}
+
+// DocumentSnapshotPolicy overrides the global snapshot policy for a document.
+// A nil field uses the global value, zero disables the rule.
+type DocumentSnapshotPolicy struct {
+	DocumentID        uint64 `gorm:"primaryKey"`
+	MaxPendingUpdates *uint64
+	MaxPendingBytes   *int64
+	MaxAgeSeconds     *int64
+	IdleSeconds       *int64
+	UpdatedAt         time.Time
+}
+
+// DocumentShareLink grants access to a document to whoever holds its token.
+// Only the SHA-256 of the token is stored.
+type DocumentShareLink struct {
+	ID             uint64     `gorm:"primaryKey"`
+	DocumentID     uint64     `gorm:"not null;index"`
+	TokenHash      string     `gorm:"size:64;not null;uniqueIndex"`
+	// role given to users redeeming the link, editor or viewer
+	Role           string     `gorm:"type:text;not null"`
+	// anonymous holders of the token can read the document
+	AllowAnonymous bool       `gorm:"not null;default:false"`
+	PasswordHash   *string
+	ExpiresAt      *time.Time
+	// redemptions allowed, nil for no limit
+	MaxUses        *int
+	Uses           int        `gorm:"not null;default:0"`
+	CreatedBy      uint64     `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// DocumentInvitation invites an email without an account yet. It is claimed
+// when a user registers with that email, or accepted with its token. Only the
+// SHA-256 of the token is stored.
+type DocumentInvitation struct {
+	ID         uint64    `gorm:"primaryKey"`
+	DocumentID uint64    `gorm:"not null;uniqueIndex:idx_invitation_doc_email"`
+	// lower case, one invitation per document and email
+	Email      string    `gorm:"size:255;not null;uniqueIndex:idx_invitation_doc_email;index"`
+	Role       string    `gorm:"type:text;not null"`
+	TokenHash  string    `gorm:"size:64;not null;uniqueIndex"`
+	InvitedBy  uint64    `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	CreatedAt  time.Time
+}
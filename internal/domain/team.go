@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+)
+
+// Team is a group of users that can be granted access to documents as a whole
+type Team struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Name      string `gorm:"type:text;not null"`
+	CreatedBy uint64 `gorm:"not null;index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Members []TeamMember        `gorm:"constraint:OnDelete:CASCADE"`
+	Grants  []DocumentTeamGrant `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// TeamMember is a user in a team. The role is about managing the team: admins
+// add and remove members, members only see the team.
+type TeamMember struct {
+	TeamID  uint64 `gorm:"primaryKey"`
+	UserID  uint64 `gorm:"primaryKey;index"`
+	Role    string `gorm:"type:text;not null"`
+	AddedAt time.Time
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"time"
+)
+
+// Workspace is an organization that can own documents, so they stay when the
+// user who created them leaves
+type Workspace struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Name      string `gorm:"type:text;not null"`
+	CreatedBy uint64 `gorm:"not null;index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Members   []WorkspaceMember `gorm:"constraint:OnDelete:CASCADE"`
+	Documents []Document        `gorm:"constraint:OnDelete:RESTRICT"`
+}
+
+// WorkspaceMember is a user in a workspace. Admins manage the workspace and
+// have owner rights on its documents, members create documents in it, guests
+// only open the documents shared with them.
+type WorkspaceMember struct {
+	WorkspaceID uint64 `gorm:"primaryKey"`
+	UserID      uint64 `gorm:"primaryKey;index"`
+	Role        string `gorm:"type:text;not null"`
+	AddedAt     time.Time
+}
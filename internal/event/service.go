@@ -12,7 +12,7 @@ import (
 )
 
 type DocProvider interface {
-	CreateDocumentUpdate(ctx context.Context, id uint64, userID uint64, content []byte) error
+	CreateDocumentUpdate(ctx context.Context, id uint64, userID uint64, content []byte, updateID string) (uint64, error)
 	CreateDocumentSnapshot(ctx context.Context, docID uint64, state []byte) error
 }
 type Service struct {
@@ -44,6 +44,8 @@ type DocumentMessage struct {
 	UserID     uint64 `json:"user_id"`
 	Timestamp  int64  `json:"timestamp"`
 	Data       string `json:"data"`
+	// UpdateID is the optional idempotency key of a document.updated event
+	UpdateID string `json:"update_id,omitempty"`
 }
 
 func (s *Service) ProcessDocumentEvent(ctx context.Context, message *kafka.Message) error {
@@ -65,7 +67,7 @@ func (s *Service) ProcessDocumentEvent(ctx context.Context, message *kafka.Messa
 			log.Error().Err(err).Msg("Failed to decode document update")
 			return err
 		}
-		err = s.docService.CreateDocumentUpdate(ctx, docMessage.DocumentID, docMessage.UserID, docUpdate)
+		_, err = s.docService.CreateDocumentUpdate(ctx, docMessage.DocumentID, docMessage.UserID, docUpdate, docMessage.UpdateID)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to create document update")
 			return err
@@ -20,10 +20,14 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	InternalService_GetUserRole_FullMethodName      = "/internalpb.InternalService/GetUserRole"
-	InternalService_GetDocumentState_FullMethodName = "/internalpb.InternalService/GetDocumentState"
-	InternalService_CreateUpdate_FullMethodName     = "/internalpb.InternalService/CreateUpdate"
-	InternalService_CreateSnapshot_FullMethodName   = "/internalpb.InternalService/CreateSnapshot"
+	InternalService_GetUserRole_FullMethodName          = "/internalpb.InternalService/GetUserRole"
+	InternalService_GetDocumentState_FullMethodName     = "/internalpb.InternalService/GetDocumentState"
+	InternalService_GetDocumentStatePage_FullMethodName = "/internalpb.InternalService/GetDocumentStatePage"
+	InternalService_StreamDocumentState_FullMethodName  = "/internalpb.InternalService/StreamDocumentState"
+	InternalService_CreateUpdate_FullMethodName         = "/internalpb.InternalService/CreateUpdate"
+	InternalService_CreateUpdates_FullMethodName        = "/internalpb.InternalService/CreateUpdates"
+	InternalService_IngestUpdates_FullMethodName        = "/internalpb.InternalService/IngestUpdates"
+	InternalService_CreateSnapshot_FullMethodName       = "/internalpb.InternalService/CreateSnapshot"
 )
 
 // InternalServiceClient is the client API for InternalService service.
@@ -32,7 +36,11 @@ const (
 type InternalServiceClient interface {
 	GetUserRole(ctx context.Context, in *PermissionRequest, opts ...grpc.CallOption) (*PermissionResponse, error)
 	GetDocumentState(ctx context.Context, in *DocumentIDRequest, opts ...grpc.CallOption) (*DocumentStateResponse, error)
-	CreateUpdate(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetDocumentStatePage(ctx context.Context, in *DocumentStatePageRequest, opts ...grpc.CallOption) (*DocumentStateResponse, error)
+	StreamDocumentState(ctx context.Context, in *DocumentIDRequest, opts ...grpc.CallOption) (InternalService_StreamDocumentStateClient, error)
+	CreateUpdate(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error)
+	CreateUpdates(ctx context.Context, in *CreateUpdatesRequest, opts ...grpc.CallOption) (*CreateUpdatesResponse, error)
+	IngestUpdates(ctx context.Context, opts ...grpc.CallOption) (InternalService_IngestUpdatesClient, error)
 	CreateSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
@@ -62,8 +70,49 @@ func (c *internalServiceClient) GetDocumentState(ctx context.Context, in *Docume
 	return out, nil
 }
 
-func (c *internalServiceClient) CreateUpdate(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
-	out := new(emptypb.Empty)
+func (c *internalServiceClient) GetDocumentStatePage(ctx context.Context, in *DocumentStatePageRequest, opts ...grpc.CallOption) (*DocumentStateResponse, error) {
+	out := new(DocumentStateResponse)
+	err := c.cc.Invoke(ctx, InternalService_GetDocumentStatePage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) StreamDocumentState(ctx context.Context, in *DocumentIDRequest, opts ...grpc.CallOption) (InternalService_StreamDocumentStateClient, error) {
+	stream, err := c.cc.NewStream(ctx, &InternalService_ServiceDesc.Streams[0], InternalService_StreamDocumentState_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &internalServiceStreamDocumentStateClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type InternalService_StreamDocumentStateClient interface {
+	Recv() (*DocumentStateChunk, error)
+	grpc.ClientStream
+}
+
+type internalServiceStreamDocumentStateClient struct {
+	grpc.ClientStream
+}
+
+func (x *internalServiceStreamDocumentStateClient) Recv() (*DocumentStateChunk, error) {
+	m := new(DocumentStateChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *internalServiceClient) CreateUpdate(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error) {
+	out := new(UpdateResponse)
 	err := c.cc.Invoke(ctx, InternalService_CreateUpdate_FullMethodName, in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -71,6 +120,46 @@ func (c *internalServiceClient) CreateUpdate(ctx context.Context, in *UpdateRequ
 	return out, nil
 }
 
+func (c *internalServiceClient) CreateUpdates(ctx context.Context, in *CreateUpdatesRequest, opts ...grpc.CallOption) (*CreateUpdatesResponse, error) {
+	out := new(CreateUpdatesResponse)
+	err := c.cc.Invoke(ctx, InternalService_CreateUpdates_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) IngestUpdates(ctx context.Context, opts ...grpc.CallOption) (InternalService_IngestUpdatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &InternalService_ServiceDesc.Streams[1], InternalService_IngestUpdates_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &internalServiceIngestUpdatesClient{stream}
+	return x, nil
+}
+
+type InternalService_IngestUpdatesClient interface {
+	Send(*IngestUpdate) error
+	Recv() (*IngestAck, error)
+	grpc.ClientStream
+}
+
+type internalServiceIngestUpdatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *internalServiceIngestUpdatesClient) Send(m *IngestUpdate) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *internalServiceIngestUpdatesClient) Recv() (*IngestAck, error) {
+	m := new(IngestAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *internalServiceClient) CreateSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, InternalService_CreateSnapshot_FullMethodName, in, out, opts...)
@@ -86,7 +175,11 @@ func (c *internalServiceClient) CreateSnapshot(ctx context.Context, in *Snapshot
 type InternalServiceServer interface {
 	GetUserRole(context.Context, *PermissionRequest) (*PermissionResponse, error)
 	GetDocumentState(context.Context, *DocumentIDRequest) (*DocumentStateResponse, error)
-	CreateUpdate(context.Context, *UpdateRequest) (*emptypb.Empty, error)
+	GetDocumentStatePage(context.Context, *DocumentStatePageRequest) (*DocumentStateResponse, error)
+	StreamDocumentState(*DocumentIDRequest, InternalService_StreamDocumentStateServer) error
+	CreateUpdate(context.Context, *UpdateRequest) (*UpdateResponse, error)
+	CreateUpdates(context.Context, *CreateUpdatesRequest) (*CreateUpdatesResponse, error)
+	IngestUpdates(InternalService_IngestUpdatesServer) error
 	CreateSnapshot(context.Context, *SnapshotRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedInternalServiceServer()
 }
@@ -101,9 +194,21 @@ func (UnimplementedInternalServiceServer) GetUserRole(context.Context, *Permissi
 func (UnimplementedInternalServiceServer) GetDocumentState(context.Context, *DocumentIDRequest) (*DocumentStateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetDocumentState not implemented")
 }
-func (UnimplementedInternalServiceServer) CreateUpdate(context.Context, *UpdateRequest) (*emptypb.Empty, error) {
+func (UnimplementedInternalServiceServer) GetDocumentStatePage(context.Context, *DocumentStatePageRequest) (*DocumentStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDocumentStatePage not implemented")
+}
+func (UnimplementedInternalServiceServer) StreamDocumentState(*DocumentIDRequest, InternalService_StreamDocumentStateServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamDocumentState not implemented")
+}
+func (UnimplementedInternalServiceServer) CreateUpdate(context.Context, *UpdateRequest) (*UpdateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateUpdate not implemented")
 }
+func (UnimplementedInternalServiceServer) CreateUpdates(context.Context, *CreateUpdatesRequest) (*CreateUpdatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUpdates not implemented")
+}
+func (UnimplementedInternalServiceServer) IngestUpdates(InternalService_IngestUpdatesServer) error {
+	return status.Errorf(codes.Unimplemented, "method IngestUpdates not implemented")
+}
 func (UnimplementedInternalServiceServer) CreateSnapshot(context.Context, *SnapshotRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateSnapshot not implemented")
 }
@@ -156,6 +261,45 @@ func _InternalService_GetDocumentState_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _InternalService_GetDocumentStatePage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DocumentStatePageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).GetDocumentStatePage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_GetDocumentStatePage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).GetDocumentStatePage(ctx, req.(*DocumentStatePageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_StreamDocumentState_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DocumentIDRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InternalServiceServer).StreamDocumentState(m, &internalServiceStreamDocumentStateServer{stream})
+}
+
+type InternalService_StreamDocumentStateServer interface {
+	Send(*DocumentStateChunk) error
+	grpc.ServerStream
+}
+
+type internalServiceStreamDocumentStateServer struct {
+	grpc.ServerStream
+}
+
+func (x *internalServiceStreamDocumentStateServer) Send(m *DocumentStateChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _InternalService_CreateUpdate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(UpdateRequest)
 	if err := dec(in); err != nil {
@@ -174,6 +318,50 @@ func _InternalService_CreateUpdate_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _InternalService_CreateUpdates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateUpdatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).CreateUpdates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_CreateUpdates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).CreateUpdates(ctx, req.(*CreateUpdatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_IngestUpdates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(InternalServiceServer).IngestUpdates(&internalServiceIngestUpdatesServer{stream})
+}
+
+type InternalService_IngestUpdatesServer interface {
+	Send(*IngestAck) error
+	Recv() (*IngestUpdate, error)
+	grpc.ServerStream
+}
+
+type internalServiceIngestUpdatesServer struct {
+	grpc.ServerStream
+}
+
+func (x *internalServiceIngestUpdatesServer) Send(m *IngestAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *internalServiceIngestUpdatesServer) Recv() (*IngestUpdate, error) {
+	m := new(IngestUpdate)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _InternalService_CreateSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(SnapshotRequest)
 	if err := dec(in); err != nil {
@@ -207,15 +395,35 @@ var InternalService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetDocumentState",
 			Handler:    _InternalService_GetDocumentState_Handler,
 		},
+		{
+			MethodName: "GetDocumentStatePage",
+			Handler:    _InternalService_GetDocumentStatePage_Handler,
+		},
 		{
 			MethodName: "CreateUpdate",
 			Handler:    _InternalService_CreateUpdate_Handler,
 		},
+		{
+			MethodName: "CreateUpdates",
+			Handler:    _InternalService_CreateUpdates_Handler,
+		},
 		{
 			MethodName: "CreateSnapshot",
 			Handler:    _InternalService_CreateSnapshot_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamDocumentState",
+			Handler:       _InternalService_StreamDocumentState_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "IngestUpdates",
+			Handler:       _InternalService_IngestUpdates_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "internal/grpc/internalpb/internal.proto",
 }
@@ -2,9 +2,12 @@ package grpc
 
 import (
 	"context"
+	defError "errors"
 	"fmt"
+	"io"
 
 	"collaborative-markdown-editor/internal/document"
+	"collaborative-markdown-editor/internal/errors"
 	"collaborative-markdown-editor/internal/grpc/internalpb"
 
 	"net"
@@ -42,6 +45,17 @@ func (s *Server) loggingInterceptor(
 	return handler(ctx, req)
 }
 
+// streamLoggingInterceptor is loggingInterceptor for streaming RPCs
+func (s *Server) streamLoggingInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	log.Info().Str("method", info.FullMethod).Msg("gRPC stream opened")
+	return handler(srv, ss)
+}
+
 // Unary interceptor verifies that every request contains correct internal
 // secret metadata.  This is equivalent to the HTTP InternalAuthMiddleware used
 // by the gin router.
@@ -51,17 +65,39 @@ func (s *Server) authInterceptor(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (interface{}, error) {
+	if err := s.checkSecret(ctx); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// streamAuthInterceptor checks the internal secret once when a stream opens
+func (s *Server) streamAuthInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := s.checkSecret(ss.Context()); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+func (s *Server) checkSecret(ctx context.Context) error {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("missing metadata")
+		return fmt.Errorf("missing metadata")
 	}
 
 	vals := md.Get("x-internal-secret")
 	if len(vals) == 0 || vals[0] != s.internalSecret {
-		return nil, fmt.Errorf("unauthorized")
+		return fmt.Errorf("unauthorized")
 	}
 
-	return handler(ctx, req)
+	return nil
 }
 
 // Start creates and begins serving a gRPC server listening on the given
@@ -69,6 +105,7 @@ func (s *Server) authInterceptor(
 func (s *Server) Start(address string) (*grpc.Server, net.Listener, error) {
 	opts := []grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(s.loggingInterceptor, s.authInterceptor),
+		grpc.ChainStreamInterceptor(s.streamLoggingInterceptor, s.streamAuthInterceptor),
 	}
 
 	grpcServer := grpc.NewServer(opts...)
@@ -87,7 +124,12 @@ func (s *Server) Start(address string) (*grpc.Server, net.Listener, error) {
 // --- internalpb.InternalServiceServer methods ---
 
 func (s *Server) GetUserRole(ctx context.Context, req *internalpb.PermissionRequest) (*internalpb.PermissionResponse, error) {
-	role, err := s.documentService.FetchUserRole(ctx, req.DocId, req.UserId)
+	var share *document.ShareCredentials
+	if req.ShareToken != "" {
+		share = &document.ShareCredentials{Token: req.ShareToken, Password: req.SharePassword}
+	}
+
+	role, err := s.documentService.FetchUserRole(ctx, req.DocId, req.UserId, share)
 	if err != nil {
 		return nil, err
 	}
@@ -95,12 +137,87 @@ func (s *Server) GetUserRole(ctx context.Context, req *internalpb.PermissionRequ
 }
 
 func (s *Server) GetDocumentState(ctx context.Context, req *internalpb.DocumentIDRequest) (*internalpb.DocumentStateResponse, error) {
+	if req.SinceSeq > 0 {
+		state, err := s.documentService.GetDocumentStateSince(ctx, req.Id, req.SinceSeq)
+		if err != nil {
+			return nil, err
+		}
+		return toStateResponse(state), nil
+	}
+
 	state, err := s.documentService.GetDocumentState(ctx, req.Id)
 	if err != nil {
 		return nil, err
 	}
+	return toStateResponse(state), nil
+}
 
-	// translate service response into protobuf message
+// GetDocumentStatePage serves hydration in pages, see
+// document.Service.GetDocumentStatePage
+func (s *Server) GetDocumentStatePage(ctx context.Context, req *internalpb.DocumentStatePageRequest) (*internalpb.DocumentStateResponse, error) {
+	limit := int(req.Limit)
+	if limit == 0 || limit > maxStatePageSize {
+		limit = maxStatePageSize
+	}
+
+	state, err := s.documentService.GetDocumentStatePage(ctx, req.DocId, req.AfterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	return toStateResponse(state), nil
+}
+
+const maxStatePageSize = 1000
+
+// snapshotChunkSize keeps every message of StreamDocumentState well below
+// gRPC's default 4MB message limit
+const snapshotChunkSize = 1 << 20
+
+// StreamDocumentState sends the snapshot in chunks, then every update in seq
+// order, then a trailer with the final seq. A stream that ends without the
+// trailer is incomplete.
+func (s *Server) StreamDocumentState(req *internalpb.DocumentIDRequest, stream internalpb.InternalService_StreamDocumentStateServer) error {
+	trailer := &internalpb.StateTrailer{}
+
+	err := s.documentService.StreamDocumentState(stream.Context(), req.Id, func(page *document.DocumentStateResponse) error {
+		for start := 0; start < len(page.Snapshot); start += snapshotChunkSize {
+			end := min(start+snapshotChunkSize, len(page.Snapshot))
+			err := stream.Send(&internalpb.DocumentStateChunk{
+				Chunk: &internalpb.DocumentStateChunk_Snapshot{Snapshot: page.Snapshot[start:end]},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if page.SnapshotSeq > 0 {
+			trailer.SnapshotSeq = page.SnapshotSeq
+		}
+
+		for _, u := range page.Updates {
+			err := stream.Send(&internalpb.DocumentStateChunk{
+				Chunk: &internalpb.DocumentStateChunk_Update{Update: &internalpb.DocumentUpdate{
+					Seq:    u.Seq,
+					Binary: u.Binary,
+				}},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		trailer.FinalSeq = page.NextSeq
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return stream.Send(&internalpb.DocumentStateChunk{
+		Chunk: &internalpb.DocumentStateChunk_Trailer{Trailer: trailer},
+	})
+}
+
+// toStateResponse translates service response into protobuf message
+func toStateResponse(state *document.DocumentStateResponse) *internalpb.DocumentStateResponse {
 	pbUpdates := make([]*internalpb.DocumentUpdate, 0, len(state.Updates))
 	for _, u := range state.Updates {
 		pbUpdates = append(pbUpdates, &internalpb.DocumentUpdate{
@@ -110,17 +227,170 @@ func (s *Server) GetDocumentState(ctx context.Context, req *internalpb.DocumentI
 	}
 
 	return &internalpb.DocumentStateResponse{
-		Snapshot:    state.Snapshot,
-		SnapshotSeq: state.SnapshotSeq,
-		Updates:     pbUpdates,
-	}, nil
+		Snapshot:         state.Snapshot,
+		SnapshotSeq:      state.SnapshotSeq,
+		Updates:          pbUpdates,
+		HasMore:          state.HasMore,
+		NextSeq:          state.NextSeq,
+		SnapshotRequired: state.SnapshotRequired,
+	}
 }
 
-func (s *Server) CreateUpdate(ctx context.Context, req *internalpb.UpdateRequest) (*emptypb.Empty, error) {
-	if err := s.documentService.CreateDocumentUpdate(ctx, req.DocId, req.UserId, req.Update); err != nil {
+func (s *Server) CreateUpdate(ctx context.Context, req *internalpb.UpdateRequest) (*internalpb.UpdateResponse, error) {
+	seq, err := s.documentService.CreateDocumentUpdate(ctx, req.DocId, req.UserId, req.Update, req.UpdateId)
+	if err != nil {
 		return nil, err
 	}
-	return &emptypb.Empty{}, nil
+	return &internalpb.UpdateResponse{Seq: seq}, nil
+}
+
+func (s *Server) CreateUpdates(ctx context.Context, req *internalpb.CreateUpdatesRequest) (*internalpb.CreateUpdatesResponse, error) {
+	if len(req.Updates) == 0 || len(req.Updates) > maxCreateUpdates {
+		return nil, fmt.Errorf("between 1 and %d updates are required", maxCreateUpdates)
+	}
+
+	seqs, err := s.documentService.CreateDocumentUpdates(ctx, req.DocId, req.UserId, req.Updates, req.UpdateIds)
+	if err != nil {
+		return nil, err
+	}
+	return &internalpb.CreateUpdatesResponse{Seqs: seqs}, nil
+}
+
+// maxCreateUpdates matches the limit of the HTTP endpoint
+const maxCreateUpdates = 1000
+
+// maxIngestBatch caps how many queued updates IngestUpdates stores at once
+const maxIngestBatch = 100
+
+// IngestUpdates takes the updates of one document over a long lived stream.
+// Updates that queue up while a batch is being stored are stored together in
+// the next one, and each is acked with its seq in the order it was sent.
+// A rejected update is acked with an error and the stream goes on; the other
+// updates sent with it are still stored. Any other failure ends the stream.
+func (s *Server) IngestUpdates(stream internalpb.InternalService_IngestUpdatesServer) error {
+	ctx := stream.Context()
+	incoming := make(chan *internalpb.IngestUpdate, maxIngestBatch)
+	recvErr := make(chan error, 1)
+
+	go func() {
+		defer close(incoming)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case incoming <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var docID uint64
+	for msg := range incoming {
+		batch := []*internalpb.IngestUpdate{msg}
+	drain:
+		for len(batch) < maxIngestBatch {
+			select {
+			case next, ok := <-incoming:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+
+		for _, u := range batch {
+			if docID == 0 {
+				docID = u.DocId
+			}
+			if u.DocId == 0 || u.DocId != docID {
+				return fmt.Errorf("stream is bound to document %d, got %d", docID, u.DocId)
+			}
+		}
+
+		if err := s.ingestBatch(stream, docID, batch); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case err := <-recvErr:
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// ingestBatch stores each run of consecutive updates from the same user in one
+// call and acks them
+func (s *Server) ingestBatch(stream internalpb.InternalService_IngestUpdatesServer, docID uint64, batch []*internalpb.IngestUpdate) error {
+	for start := 0; start < len(batch); {
+		end := start + 1
+		for end < len(batch) && batch[end].UserId == batch[start].UserId {
+			end++
+		}
+		acks, err := s.ingestRun(stream.Context(), docID, batch[start:end])
+		if err != nil {
+			return err
+		}
+		start = end
+
+		for _, ack := range acks {
+			if err := stream.Send(ack); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ingestRun stores a run of updates from one user. When the run is rejected
+// its updates are stored one at a time, so only the offending ones are acked
+// with the error
+func (s *Server) ingestRun(ctx context.Context, docID uint64, run []*internalpb.IngestUpdate) ([]*internalpb.IngestAck, error) {
+	contents := make([][]byte, len(run))
+	updateIDs := make([]string, len(run))
+	for i, u := range run {
+		contents[i] = u.Update
+		updateIDs[i] = u.UpdateId
+	}
+
+	seqs, err := s.documentService.CreateDocumentUpdates(ctx, docID, run[0].UserId, contents, updateIDs)
+	var apiErr *errors.APIError
+	if err != nil && !defError.As(err, &apiErr) {
+		return nil, err
+	}
+
+	if apiErr != nil && len(run) > 1 {
+		acks := make([]*internalpb.IngestAck, 0, len(run))
+		for i := range run {
+			ack, err := s.ingestRun(ctx, docID, run[i:i+1])
+			if err != nil {
+				return nil, err
+			}
+			acks = append(acks, ack...)
+		}
+		return acks, nil
+	}
+
+	acks := make([]*internalpb.IngestAck, len(run))
+	for i, u := range run {
+		acks[i] = &internalpb.IngestAck{Ref: u.Ref}
+		if apiErr != nil {
+			acks[i].Error = apiErr.Message
+		} else {
+			acks[i].Seq = seqs[i]
+		}
+	}
+	return acks, nil
 }
 
 func (s *Server) CreateSnapshot(ctx context.Context, req *internalpb.SnapshotRequest) (*emptypb.Empty, error) {
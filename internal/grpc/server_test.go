@@ -1,15 +1,19 @@
 package grpc
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"testing"
 
 	"collaborative-markdown-editor/internal/document"
 	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
 	"collaborative-markdown-editor/internal/grpc/internalpb"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -31,21 +35,21 @@ func (m *mockDocService) RenameDocument(ctx context.Context, docID uint64, userI
 	return args.Get(0).(*domain.Document), args.Error(1)
 }
 
-func (m *mockDocService) CreateDocumentUpdate(ctx context.Context, id, userID uint64, content []byte) error {
-	args := m.Called(ctx, id, userID, content)
-	return args.Error(0)
+func (m *mockDocService) CreateDocumentUpdate(ctx context.Context, id, userID uint64, content []byte, updateID string) (uint64, error) {
+	args := m.Called(ctx, id, userID, content, updateID)
+	return args.Get(0).(uint64), args.Error(1)
 }
 
-func (m *mockDocService) GetUserDocuments(ctx context.Context, userID uint64, page, pageSize int) (*document.PaginatedDocuments, error) {
-	args := m.Called(ctx, userID, page, pageSize)
+func (m *mockDocService) GetUserDocuments(ctx context.Context, userID uint64, page, pageSize int, filter document.DocumentListFilter) (*document.PaginatedDocuments, error) {
+	args := m.Called(ctx, userID, page, pageSize, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*document.PaginatedDocuments), args.Error(1)
 }
 
-func (m *mockDocService) GetSharedDocuments(ctx context.Context, userID uint64, page, pageSize int) (*document.PaginatedDocuments, error) {
-	args := m.Called(ctx, userID, page, pageSize)
+func (m *mockDocService) GetSharedDocuments(ctx context.Context, userID uint64, page, pageSize int, filter document.DocumentListFilter) (*document.PaginatedDocuments, error) {
+	args := m.Called(ctx, userID, page, pageSize, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -73,8 +77,8 @@ func (m *mockDocService) CreateDocumentSnapshot(ctx context.Context, docID uint6
 	return args.Error(0)
 }
 
-func (m *mockDocService) FetchUserRole(ctx context.Context, docID, userID uint64) (string, error) {
-	args := m.Called(ctx, docID, userID)
+func (m *mockDocService) FetchUserRole(ctx context.Context, docID, userID uint64, share *document.ShareCredentials) (string, error) {
+	args := m.Called(ctx, docID, userID, share)
 	return args.String(0), args.Error(1)
 }
 
@@ -112,6 +116,303 @@ func (m *mockDocService) DeleteDocument(ctx context.Context, docID uint64, userI
 	return args.Error(0)
 }
 
+func (m *mockDocService) CreateDocumentVersion(ctx context.Context, docID uint64, userID uint64, name string) (*document.DocumentVersionDTO, error) {
+	args := m.Called(ctx, docID, userID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.DocumentVersionDTO), args.Error(1)
+}
+
+func (m *mockDocService) ListDocumentVersions(ctx context.Context, docID uint64, userID uint64) ([]document.DocumentVersionDTO, error) {
+	args := m.Called(ctx, docID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]document.DocumentVersionDTO), args.Error(1)
+}
+
+func (m *mockDocService) GetDocumentVersionState(ctx context.Context, docID uint64, versionID uint64, userID uint64) (*document.DocumentStateResponse, error) {
+	args := m.Called(ctx, docID, versionID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.DocumentStateResponse), args.Error(1)
+}
+
+func (m *mockDocService) GetDocumentStateAt(ctx context.Context, docID uint64, seq uint64, userID uint64) (*document.DocumentStateResponse, error) {
+	args := m.Called(ctx, docID, seq, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.DocumentStateResponse), args.Error(1)
+}
+
+func (m *mockDocService) RestoreDocumentVersion(ctx context.Context, docID uint64, versionID uint64, userID uint64) (*document.RestoreResponse, error) {
+	args := m.Called(ctx, docID, versionID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.RestoreResponse), args.Error(1)
+}
+
+func (m *mockDocService) GetDocumentContent(ctx context.Context, docID uint64, userID uint64) (*document.DocumentContentResponse, error) {
+	args := m.Called(ctx, docID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.DocumentContentResponse), args.Error(1)
+}
+
+func (m *mockDocService) ExportDocument(ctx context.Context, docID uint64, userID uint64, format string) (*document.DocumentExport, error) {
+	args := m.Called(ctx, docID, userID, format)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.DocumentExport), args.Error(1)
+}
+
+func (m *mockDocService) ImportDocuments(ctx context.Context, userID uint64, files []document.ImportFile) ([]domain.Document, error) {
+	args := m.Called(ctx, userID, files)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Document), args.Error(1)
+}
+
+func (m *mockDocService) SearchDocuments(ctx context.Context, userID uint64, query string, page, pageSize int) (*document.PaginatedSearchResults, error) {
+	args := m.Called(ctx, userID, query, page, pageSize)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.PaginatedSearchResults), args.Error(1)
+}
+
+func (m *mockDocService) GetSnapshotPolicy(ctx context.Context, docID uint64, userID uint64) (*document.SnapshotPolicyResponse, error) {
+	args := m.Called(ctx, docID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.SnapshotPolicyResponse), args.Error(1)
+}
+
+func (m *mockDocService) UpdateSnapshotPolicy(ctx context.Context, docID uint64, userID uint64, dto document.SnapshotPolicyDTO) (*document.SnapshotPolicyResponse, error) {
+	args := m.Called(ctx, docID, userID, dto)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.SnapshotPolicyResponse), args.Error(1)
+}
+
+func (m *mockDocService) ScheduleSnapshots(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockDocService) CreateShareLink(ctx context.Context, docID uint64, userID uint64, opts document.ShareLinkOptions) (*document.ShareLinkDTO, error) {
+	args := m.Called(ctx, docID, userID, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.ShareLinkDTO), args.Error(1)
+}
+
+func (m *mockDocService) ListShareLinks(ctx context.Context, docID uint64, userID uint64) ([]document.ShareLinkDTO, error) {
+	args := m.Called(ctx, docID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]document.ShareLinkDTO), args.Error(1)
+}
+
+func (m *mockDocService) RevokeShareLink(ctx context.Context, docID uint64, userID uint64, linkID uint64) error {
+	args := m.Called(ctx, docID, userID, linkID)
+	return args.Error(0)
+}
+
+func (m *mockDocService) GetShareLink(ctx context.Context, token string) (*document.ShareLinkPreview, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.ShareLinkPreview), args.Error(1)
+}
+
+func (m *mockDocService) RedeemShareLink(ctx context.Context, token string, userID uint64, password string) (*document.ShareLinkRedemption, error) {
+	args := m.Called(ctx, token, userID, password)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.ShareLinkRedemption), args.Error(1)
+}
+
+func (m *mockDocService) InviteCollaborator(ctx context.Context, docID uint64, requesterID uint64, email string, role string) (*document.InvitationDTO, error) {
+	args := m.Called(ctx, docID, requesterID, email, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.InvitationDTO), args.Error(1)
+}
+
+func (m *mockDocService) ListInvitations(ctx context.Context, docID uint64, requesterID uint64) ([]document.InvitationDTO, error) {
+	args := m.Called(ctx, docID, requesterID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]document.InvitationDTO), args.Error(1)
+}
+
+func (m *mockDocService) RevokeInvitation(ctx context.Context, docID uint64, requesterID uint64, invitationID uint64) error {
+	args := m.Called(ctx, docID, requesterID, invitationID)
+	return args.Error(0)
+}
+
+func (m *mockDocService) AcceptInvitation(ctx context.Context, token string, userID uint64) (*document.InvitationAcceptance, error) {
+	args := m.Called(ctx, token, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.InvitationAcceptance), args.Error(1)
+}
+
+func (m *mockDocService) GrantTeam(ctx context.Context, docID uint64, requesterID uint64, teamID uint64, role string) (*document.TeamGrantDTO, error) {
+	args := m.Called(ctx, docID, requesterID, teamID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.TeamGrantDTO), args.Error(1)
+}
+
+func (m *mockDocService) ListTeamGrants(ctx context.Context, docID uint64, requesterID uint64) ([]document.TeamGrantDTO, error) {
+	args := m.Called(ctx, docID, requesterID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]document.TeamGrantDTO), args.Error(1)
+}
+
+func (m *mockDocService) RevokeTeamGrant(ctx context.Context, docID uint64, requesterID uint64, teamID uint64) error {
+	args := m.Called(ctx, docID, requesterID, teamID)
+	return args.Error(0)
+}
+
+func (m *mockDocService) NotifyAccessChanged(ctx context.Context, docIDs []uint64, userIDs []uint64) {
+	m.Called(ctx, docIDs, userIDs)
+}
+
+func (m *mockDocService) NotifyOwnershipChanged(ctx context.Context, docIDs []uint64, userIDs []uint64) {
+	m.Called(ctx, docIDs, userIDs)
+}
+
+func (m *mockDocService) MoveToWorkspace(ctx context.Context, docID uint64, userID uint64, workspaceID uint64) error {
+	args := m.Called(ctx, docID, userID, workspaceID)
+	return args.Error(0)
+}
+
+func (m *mockDocService) TransferOwnership(ctx context.Context, docID uint64, requesterID uint64, newOwnerID uint64) error {
+	args := m.Called(ctx, docID, requesterID, newOwnerID)
+	return args.Error(0)
+}
+
+func (m *mockDocService) GetUserDocumentsAfter(ctx context.Context, userID uint64, cursor string, pageSize int, filter document.DocumentListFilter) (*document.CursorDocuments, error) {
+	args := m.Called(ctx, userID, cursor, pageSize, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.CursorDocuments), args.Error(1)
+}
+
+func (m *mockDocService) GetSharedDocumentsAfter(ctx context.Context, userID uint64, cursor string, pageSize int, filter document.DocumentListFilter) (*document.CursorDocuments, error) {
+	args := m.Called(ctx, userID, cursor, pageSize, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.CursorDocuments), args.Error(1)
+}
+
+func (m *mockDocService) ListDocumentUpdates(ctx context.Context, docID uint64, cursor string, limit int) (*document.DocumentUpdatePage, error) {
+	args := m.Called(ctx, docID, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.DocumentUpdatePage), args.Error(1)
+}
+
+func (m *mockDocService) GetDocumentStatePage(ctx context.Context, docID uint64, afterSeq uint64, limit int) (*document.DocumentStateResponse, error) {
+	args := m.Called(ctx, docID, afterSeq, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.DocumentStateResponse), args.Error(1)
+}
+
+func (m *mockDocService) StreamDocumentState(ctx context.Context, docID uint64, send func(page *document.DocumentStateResponse) error) error {
+	args := m.Called(ctx, docID, send)
+	return args.Error(0)
+}
+
+func (m *mockDocService) GetDocumentStateSince(ctx context.Context, docID uint64, sinceSeq uint64) (*document.DocumentStateResponse, error) {
+	args := m.Called(ctx, docID, sinceSeq)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*document.DocumentStateResponse), args.Error(1)
+}
+
+// CreateDocumentUpdates may return a func computing the seqs, for calls whose
+// batch size depends on timing
+func (m *mockDocService) CreateDocumentUpdates(ctx context.Context, docID uint64, userID uint64, updates [][]byte, updateIDs []string) ([]uint64, error) {
+	args := m.Called(ctx, docID, userID, updates, updateIDs)
+	if fn, ok := args.Get(0).(func([][]byte) []uint64); ok {
+		return fn(updates), args.Error(1)
+	}
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+// fakeIngestStream replays msgs and collects the acks
+type fakeIngestStream struct {
+	grpc.ServerStream
+	msgs []*internalpb.IngestUpdate
+	acks []*internalpb.IngestAck
+}
+
+func (f *fakeIngestStream) Context() context.Context {
+	return context.Background()
+}
+
+func (f *fakeIngestStream) Recv() (*internalpb.IngestUpdate, error) {
+	if len(f.msgs) == 0 {
+		return nil, io.EOF
+	}
+	msg := f.msgs[0]
+	f.msgs = f.msgs[1:]
+	return msg, nil
+}
+
+func (f *fakeIngestStream) Send(ack *internalpb.IngestAck) error {
+	f.acks = append(f.acks, ack)
+	return nil
+}
+
+// fakeStateStream collects what StreamDocumentState sends
+type fakeStateStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	chunks []*internalpb.DocumentStateChunk
+}
+
+func (f *fakeStateStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeStateStream) Send(chunk *internalpb.DocumentStateChunk) error {
+	f.chunks = append(f.chunks, chunk)
+	return nil
+}
+
 // tests start here
 func TestAuthInterceptor(t *testing.T) {
 	svc := &mockDocService{}
@@ -138,7 +439,7 @@ func TestGetUserRole(t *testing.T) {
 	svc := &mockDocService{}
 	s := NewServer(svc, "unused")
 
-	svc.On("FetchUserRole", mock.Anything, uint64(1), uint64(2)).Return("editor", nil)
+	svc.On("FetchUserRole", mock.Anything, uint64(1), uint64(2), (*document.ShareCredentials)(nil)).Return("editor", nil)
 
 	resp, err := s.GetUserRole(context.Background(), &internalpb.PermissionRequest{DocId: 1, UserId: 2})
 	assert.NoError(t, err)
@@ -147,6 +448,20 @@ func TestGetUserRole(t *testing.T) {
 	svc.AssertExpectations(t)
 }
 
+func TestGetUserRole_ShareToken(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	share := &document.ShareCredentials{Token: "abc", Password: "pw"}
+	svc.On("FetchUserRole", mock.Anything, uint64(1), uint64(0), share).Return("viewer", nil)
+
+	resp, err := s.GetUserRole(context.Background(), &internalpb.PermissionRequest{DocId: 1, ShareToken: "abc", SharePassword: "pw"})
+	assert.NoError(t, err)
+	assert.Equal(t, "viewer", resp.Role)
+
+	svc.AssertExpectations(t)
+}
+
 func TestGetDocumentState(t *testing.T) {
 	svc := &mockDocService{}
 	s := NewServer(svc, "unused")
@@ -169,15 +484,294 @@ func TestGetDocumentState(t *testing.T) {
 	svc.AssertExpectations(t)
 }
 
+func TestGetDocumentState_SinceSeq(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	// the updates after 3 were compacted, the whole state comes back
+	state := &document.DocumentStateResponse{
+		Snapshot:         []byte{0x01},
+		SnapshotSeq:      5,
+		Updates:          []document.DocumentUpdateDTO{{Seq: 6, Binary: []byte{0x02}}},
+		NextSeq:          6,
+		SnapshotRequired: true,
+	}
+	svc.On("GetDocumentStateSince", mock.Anything, uint64(99), uint64(3)).Return(state, nil)
+
+	resp, err := s.GetDocumentState(context.Background(), &internalpb.DocumentIDRequest{Id: 99, SinceSeq: 3})
+	assert.NoError(t, err)
+	assert.True(t, resp.SnapshotRequired)
+	assert.Equal(t, []byte{0x01}, resp.Snapshot)
+	assert.Equal(t, uint64(6), resp.NextSeq)
+
+	svc.AssertNotCalled(t, "GetDocumentState", mock.Anything, mock.Anything)
+	svc.AssertExpectations(t)
+}
+
+func TestGetDocumentStatePage(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	state := &document.DocumentStateResponse{
+		SnapshotSeq: 5,
+		Updates:     []document.DocumentUpdateDTO{{Seq: 6, Binary: []byte{0x02}}},
+		HasMore:     true,
+		NextSeq:     6,
+	}
+	// a zero limit falls back to the maximum page size
+	svc.On("GetDocumentStatePage", mock.Anything, uint64(99), uint64(5), 1000).Return(state, nil)
+
+	resp, err := s.GetDocumentStatePage(context.Background(), &internalpb.DocumentStatePageRequest{DocId: 99, AfterSeq: 5})
+	assert.NoError(t, err)
+	assert.True(t, resp.HasMore)
+	assert.Equal(t, uint64(6), resp.NextSeq)
+	assert.Len(t, resp.Updates, 1)
+
+	svc.AssertExpectations(t)
+}
+
+func TestStreamAuthInterceptor(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "secret123")
+
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		return nil
+	}
+
+	err := s.streamAuthInterceptor(nil, &fakeStateStream{ctx: context.Background()}, nil, handler)
+	assert.Error(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-internal-secret", "secret123"))
+	err = s.streamAuthInterceptor(nil, &fakeStateStream{ctx: ctx}, nil, handler)
+	assert.NoError(t, err)
+}
+
+func TestStreamDocumentState(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	snapshot := bytes.Repeat([]byte{0x01}, snapshotChunkSize+10)
+	pages := []*document.DocumentStateResponse{
+		{
+			Snapshot:    snapshot,
+			SnapshotSeq: 5,
+			Updates:     []document.DocumentUpdateDTO{{Seq: 6, Binary: []byte{0x02}}},
+			HasMore:     true,
+			NextSeq:     6,
+		},
+		{
+			Updates: []document.DocumentUpdateDTO{{Seq: 7, Binary: []byte{0x03}}},
+			NextSeq: 7,
+		},
+	}
+	svc.On("StreamDocumentState", mock.Anything, uint64(99), mock.Anything).
+		Run(func(args mock.Arguments) {
+			send := args.Get(2).(func(*document.DocumentStateResponse) error)
+			for _, page := range pages {
+				assert.NoError(t, send(page))
+			}
+		}).
+		Return(nil)
+
+	stream := &fakeStateStream{ctx: context.Background()}
+	err := s.StreamDocumentState(&internalpb.DocumentIDRequest{Id: 99}, stream)
+	assert.NoError(t, err)
+
+	// two snapshot chunks, two updates, the trailer
+	assert.Len(t, stream.chunks, 5)
+	assert.Len(t, stream.chunks[0].GetSnapshot(), snapshotChunkSize)
+	assert.Equal(t, snapshot, append(stream.chunks[0].GetSnapshot(), stream.chunks[1].GetSnapshot()...))
+	assert.Equal(t, uint64(6), stream.chunks[2].GetUpdate().Seq)
+	assert.Equal(t, uint64(7), stream.chunks[3].GetUpdate().Seq)
+	assert.Equal(t, uint64(5), stream.chunks[4].GetTrailer().SnapshotSeq)
+	assert.Equal(t, uint64(7), stream.chunks[4].GetTrailer().FinalSeq)
+
+	svc.AssertExpectations(t)
+}
+
+func TestStreamDocumentState_Error(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	svc.On("StreamDocumentState", mock.Anything, uint64(99), mock.Anything).Return(assert.AnError)
+
+	stream := &fakeStateStream{ctx: context.Background()}
+	err := s.StreamDocumentState(&internalpb.DocumentIDRequest{Id: 99}, stream)
+
+	// no trailer, the client must treat the state as incomplete
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Empty(t, stream.chunks)
+}
+
+func TestCreateUpdates(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(7), uint64(8), [][]byte{{0xAA}, {0xBB}}, []string(nil)).Return([]uint64{3, 4}, nil)
+
+	resp, err := s.CreateUpdates(context.Background(), &internalpb.CreateUpdatesRequest{
+		DocId:   7,
+		UserId:  8,
+		Updates: [][]byte{{0xAA}, {0xBB}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{3, 4}, resp.Seqs)
+
+	_, err = s.CreateUpdates(context.Background(), &internalpb.CreateUpdatesRequest{DocId: 7, UserId: 8})
+	assert.Error(t, err)
+
+	svc.AssertExpectations(t)
+}
+
+func TestIngestUpdates(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	// seqs continue across batches however the updates were grouped
+	var next uint64
+	seqs := func(updates [][]byte) []uint64 {
+		out := make([]uint64, len(updates))
+		for i := range updates {
+			next++
+			out[i] = next
+		}
+		return out
+	}
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(9), uint64(1), mock.Anything, mock.Anything).Return(seqs, nil)
+
+	stream := &fakeIngestStream{msgs: []*internalpb.IngestUpdate{
+		{DocId: 9, UserId: 1, Update: []byte{0x01}, Ref: 10},
+		{DocId: 9, UserId: 1, Update: []byte{0x02}, Ref: 11},
+		{DocId: 9, UserId: 1, Update: []byte{0x03}, Ref: 12},
+	}}
+	err := s.IngestUpdates(stream)
+	assert.NoError(t, err)
+
+	assert.Len(t, stream.acks, 3)
+	for i, ack := range stream.acks {
+		assert.Equal(t, uint64(10+i), ack.Ref)
+		assert.Equal(t, uint64(1+i), ack.Seq)
+		assert.Empty(t, ack.Error)
+	}
+}
+
+// TestIngestUpdates_UpdateIDs tests that the ids of a run are passed on
+func TestIngestUpdates_UpdateIDs(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(9), uint64(1), [][]byte{{0x01}}, []string{"a"}).Return([]uint64{4}, nil)
+
+	stream := &fakeIngestStream{msgs: []*internalpb.IngestUpdate{
+		{DocId: 9, UserId: 1, Update: []byte{0x01}, Ref: 1, UpdateId: "a"},
+	}}
+	err := s.IngestUpdates(stream)
+	assert.NoError(t, err)
+
+	assert.Len(t, stream.acks, 1)
+	assert.Equal(t, uint64(4), stream.acks[0].Seq)
+	svc.AssertExpectations(t)
+}
+
+func TestIngestUpdates_Rejected(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	// alternating users never share a call, whatever the batching
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(9), uint64(1), [][]byte{{0x01}}, []string{""}).Return([]uint64{4}, nil)
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(9), uint64(2), [][]byte{{0x02}}, []string{""}).
+		Return(nil, errors.Forbidden("Viewer can't create update!", nil))
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(9), uint64(1), [][]byte{{0x03}}, []string{""}).Return([]uint64{5}, nil)
+
+	stream := &fakeIngestStream{msgs: []*internalpb.IngestUpdate{
+		{DocId: 9, UserId: 1, Update: []byte{0x01}, Ref: 1},
+		{DocId: 9, UserId: 2, Update: []byte{0x02}, Ref: 2},
+		{DocId: 9, UserId: 1, Update: []byte{0x03}, Ref: 3},
+	}}
+	err := s.IngestUpdates(stream)
+	assert.NoError(t, err)
+
+	assert.Len(t, stream.acks, 3)
+	assert.Equal(t, uint64(4), stream.acks[0].Seq)
+	assert.Equal(t, "Viewer can't create update!", stream.acks[1].Error)
+	assert.Zero(t, stream.acks[1].Seq)
+	assert.Equal(t, uint64(5), stream.acks[2].Seq)
+	svc.AssertExpectations(t)
+}
+
+// TestIngestUpdates_RejectedInRun tests that a rejected update doesn't fail
+// the other updates of its run
+func TestIngestUpdates_RejectedInRun(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	bad := func(updates [][]byte) bool {
+		for _, u := range updates {
+			if u[0] == 0x02 {
+				return true
+			}
+		}
+		return false
+	}
+	var next uint64
+	seqs := func(updates [][]byte) []uint64 {
+		out := make([]uint64, len(updates))
+		for i := range updates {
+			next++
+			out[i] = next
+		}
+		return out
+	}
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(9), uint64(1), mock.MatchedBy(bad), mock.Anything).
+		Return(nil, errors.UnprocessableEntity("Update is too large!", nil))
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(9), uint64(1), mock.Anything, mock.Anything).Return(seqs, nil)
+
+	stream := &fakeIngestStream{msgs: []*internalpb.IngestUpdate{
+		{DocId: 9, UserId: 1, Update: []byte{0x01}, Ref: 1},
+		{DocId: 9, UserId: 1, Update: []byte{0x02}, Ref: 2},
+		{DocId: 9, UserId: 1, Update: []byte{0x03}, Ref: 3},
+	}}
+	err := s.IngestUpdates(stream)
+	assert.NoError(t, err)
+
+	assert.Len(t, stream.acks, 3)
+	assert.Equal(t, uint64(1), stream.acks[0].Ref)
+	assert.Equal(t, uint64(1), stream.acks[0].Seq)
+	assert.Empty(t, stream.acks[0].Error)
+	assert.Equal(t, uint64(2), stream.acks[1].Ref)
+	assert.Equal(t, "Update is too large!", stream.acks[1].Error)
+	assert.Zero(t, stream.acks[1].Seq)
+	assert.Equal(t, uint64(3), stream.acks[2].Ref)
+	assert.Equal(t, uint64(2), stream.acks[2].Seq)
+	assert.Empty(t, stream.acks[2].Error)
+}
+
+func TestIngestUpdates_OtherDocument(t *testing.T) {
+	svc := &mockDocService{}
+	s := NewServer(svc, "unused")
+
+	stream := &fakeIngestStream{msgs: []*internalpb.IngestUpdate{
+		{DocId: 9, UserId: 1, Update: []byte{0x01}},
+		{DocId: 10, UserId: 1, Update: []byte{0x02}},
+	}}
+	svc.On("CreateDocumentUpdates", mock.Anything, uint64(9), uint64(1), [][]byte{{0x01}}, []string{""}).Return([]uint64{1}, nil).Maybe()
+
+	err := s.IngestUpdates(stream)
+
+	assert.Error(t, err)
+	svc.AssertNotCalled(t, "CreateDocumentUpdates", mock.Anything, uint64(10), mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestCreateUpdateAndSnapshot(t *testing.T) {
 	svc := &mockDocService{}
 	s := NewServer(svc, "unused")
 
-	svc.On("CreateDocumentUpdate", mock.Anything, uint64(7), uint64(8), []byte{0xAA}).Return(nil)
+	svc.On("CreateDocumentUpdate", mock.Anything, uint64(7), uint64(8), []byte{0xAA}, "retry-1").Return(uint64(12), nil)
 	svc.On("CreateDocumentSnapshot", mock.Anything, uint64(7), []byte{0xBB}).Return(nil)
 
-	_, err := s.CreateUpdate(context.Background(), &internalpb.UpdateRequest{DocId: 7, UserId: 8, Update: []byte{0xAA}})
+	resp, err := s.CreateUpdate(context.Background(), &internalpb.UpdateRequest{DocId: 7, UserId: 8, Update: []byte{0xAA}, UpdateId: "retry-1"})
 	assert.NoError(t, err)
+	assert.Equal(t, uint64(12), resp.Seq)
 
 	_, err = s.CreateSnapshot(context.Background(), &internalpb.SnapshotRequest{DocId: 7, Snapshot: []byte{0xBB}})
 	assert.NoError(t, err)
@@ -0,0 +1,45 @@
+// Package mail sends the emails of the application, like invitations
+package mail
+
+import (
+	"collaborative-markdown-editor/internal/config"
+	"context"
+
+	log "github.com/rs/zerolog/log"
+)
+
+// Message is a plain text email to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailer creates the SMTP mailer, or a LogMailer when SMTP_HOST is not set
+func NewMailer() Mailer {
+	cfg := config.AppConfig
+	if cfg.SMTPHost == "" {
+		return LogMailer{}
+	}
+	return NewSMTPMailer(SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	})
+}
+
+// LogMailer writes messages to the log instead of sending them, for
+// development without a mail server
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Info().Str("to", msg.To).Str("subject", msg.Subject).Str("body", msg.Body).Msg("mail not sent, SMTP_HOST is not set")
+	return nil
+}
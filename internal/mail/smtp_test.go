@@ -0,0 +1,196 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// received is a message as the fake server got it
+type received struct {
+	from string
+	to   []string
+	auth string // decoded AUTH PLAIN credentials
+	data string
+}
+
+// fakeSMTP is a minimal SMTP server on localhost that records what it receives
+type fakeSMTP struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []received
+	// reply to RCPT TO, "250 OK" when empty
+	rcptReply string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	f := &fakeSMTP{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeSMTP) port() int {
+	return f.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (f *fakeSMTP) received() []received {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]received(nil), f.messages...)
+}
+
+func (f *fakeSMTP) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	var msg received
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN"):
+			raw, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(line[len("AUTH PLAIN"):]))
+			msg.auth = string(raw)
+			reply("235 OK")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if f.rcptReply != "" {
+				reply(f.rcptReply)
+				continue
+			}
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = data.String()
+			f.mu.Lock()
+			f.messages = append(f.messages, msg)
+			f.mu.Unlock()
+			msg = received{}
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// TestSMTPMailer_Send tests delivering a message with authentication
+func TestSMTPMailer_Send(t *testing.T) {
+	server := newFakeSMTP(t)
+	mailer := NewSMTPMailer(SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     server.port(),
+		Username: "app",
+		Password: "secret",
+		From:     "no-reply@example.com",
+	})
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "ana@example.com",
+		Subject: "Invitation à «Roadmap»",
+		Body:    "Hello,\nopen https://example.com/invitations/abc to join.\n",
+	})
+	assert.NoError(t, err)
+
+	messages := server.received()
+	if assert.Len(t, messages, 1) {
+		got := messages[0]
+		assert.Equal(t, "no-reply@example.com", got.from)
+		assert.Equal(t, []string{"ana@example.com"}, got.to)
+		assert.Equal(t, "\x00app\x00secret", got.auth)
+
+		parsed, err := mail.ReadMessage(strings.NewReader(got.data))
+		assert.NoError(t, err)
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		assert.NoError(t, err)
+		assert.Equal(t, "Invitation à «Roadmap»", subject)
+		assert.Equal(t, "ana@example.com", parsed.Header.Get("To"))
+
+		body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello,\r\nopen https://example.com/invitations/abc to join.\r\n", string(body))
+	}
+}
+
+// TestSMTPMailer_Rejected tests that a refused recipient is reported
+func TestSMTPMailer_Rejected(t *testing.T) {
+	server := newFakeSMTP(t)
+	server.rcptReply = "550 no such user"
+	mailer := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: server.port(), From: "no-reply@example.com"})
+
+	err := mailer.Send(context.Background(), Message{To: "nobody@example.com", Subject: "x", Body: "x"})
+
+	assert.ErrorContains(t, err, "550")
+	assert.Empty(t, server.received())
+}
+
+// TestSMTPMailer_HeaderInjection tests that line breaks in addresses are refused
+func TestSMTPMailer_HeaderInjection(t *testing.T) {
+	mailer := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: 1, From: "no-reply@example.com"})
+
+	err := mailer.Send(context.Background(), Message{To: "ana@example.com\r\nBcc: eve@example.com", Subject: "x", Body: "x"})
+
+	assert.Error(t, err)
+}
+
+// TestSMTPMailer_Unreachable tests a server that is down
+func TestSMTPMailer_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	mailer := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: port, From: "no-reply@example.com"})
+	err = mailer.Send(context.Background(), Message{To: "ana@example.com", Subject: "x", Body: "x"})
+
+	assert.ErrorContains(t, err, "smtp dial")
+}
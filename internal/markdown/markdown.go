@@ -0,0 +1,103 @@
+// Package markdown renders document markdown to sanitized HTML
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// raw HTML is passed through by goldmark and left to the sanitizer, so inline
+// markup users rely on survives while scripts and handlers do not
+var renderer = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// fenced code language and GFM task lists
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// ToHTML renders markdown to a sanitized HTML fragment
+func ToHTML(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := renderer.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// Meta is the document information written into a standalone page
+type Meta struct {
+	Title      string
+	Author     string
+	ExportedAt time.Time
+}
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- if .Author}}
+<meta name="author" content="{{.Author}}">
+{{- end}}
+<meta name="generator" content="collaborative-markdown-editor">
+<meta name="date" content="{{.ExportedAt.Format "2006-01-02T15:04:05Z07:00"}}">
+<style>
+body{margin:0 auto;max-width:46rem;padding:2rem 1rem;font:16px/1.6 -apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif;color:#1f2328}
+header{border-bottom:1px solid #d1d9e0;margin-bottom:2rem}
+header p{color:#59636e;font-size:.875rem}
+pre,code{font-family:ui-monospace,SFMono-Regular,Menlo,Consolas,monospace;font-size:.875em}
+pre{background:#f6f8fa;border-radius:6px;overflow:auto;padding:1rem}
+:not(pre)>code{background:#eff1f3;border-radius:4px;padding:.2em .4em}
+blockquote{border-left:.25em solid #d1d9e0;color:#59636e;margin:0;padding:0 1em}
+table{border-collapse:collapse}
+th,td{border:1px solid #d1d9e0;padding:.4rem .8rem}
+img{max-width:100%}
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>{{if .Author}}{{.Author}} &middot; {{end}}Exported {{.ExportedAt.Format "January 2, 2006 15:04 MST"}}</p>
+</header>
+<article>
+{{.Body}}
+</article>
+</body>
+</html>
+`))
+
+// Standalone renders markdown into a self-contained HTML page with inline
+// styles, so it can be opened or printed without the editor
+func Standalone(source string, meta Meta) ([]byte, error) {
+	body, err := ToHTML(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = page.Execute(&buf, struct {
+		Meta
+		Body template.HTML
+	}{meta, template.HTML(body)})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
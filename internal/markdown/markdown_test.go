@@ -0,0 +1,43 @@
+package markdown
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestToHTML_Sanitizes tests that scripts and event handlers are stripped
+func TestToHTML_Sanitizes(t *testing.T) {
+	html, err := ToHTML("# Title\n\n<script>alert(1)</script>\n\n<a href=\"javascript:alert(1)\" onclick=\"x()\">link</a>\n")
+
+	assert.NoError(t, err)
+	assert.Contains(t, html, "<h1>Title</h1>")
+	assert.NotContains(t, html, "<script")
+	assert.NotContains(t, html, "javascript:")
+	assert.NotContains(t, html, "onclick")
+}
+
+// TestToHTML_GFM tests tables, task lists and fenced code languages
+func TestToHTML_GFM(t *testing.T) {
+	html, err := ToHTML("| a | b |\n|---|---|\n| 1 | 2 |\n\n- [x] done\n\n```go\nfmt.Println()\n```\n")
+
+	assert.NoError(t, err)
+	assert.Contains(t, html, "<table>")
+	assert.Contains(t, html, `type="checkbox"`)
+	assert.Contains(t, html, `class="language-go"`)
+}
+
+// TestStandalone tests the page wraps the body and escapes metadata
+func TestStandalone(t *testing.T) {
+	page, err := Standalone("hello *world*", Meta{
+		Title:      "Notes <draft>",
+		Author:     "Atras Najwan",
+		ExportedAt: time.Date(2026, 2, 21, 10, 0, 0, 0, time.UTC),
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), "<title>Notes &lt;draft&gt;</title>")
+	assert.Contains(t, string(page), `<meta name="author" content="Atras Najwan">`)
+	assert.Contains(t, string(page), "<p>hello <em>world</em></p>")
+}
@@ -0,0 +1,221 @@
+package membership
+
+import (
+	"collaborative-markdown-editor/internal/errors"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MemberService is the member management a group service exposes, see Service
+type MemberService interface {
+	AddMember(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64, role string) (*MemberDTO, error)
+	ChangeMemberRole(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64, role string) (*MemberDTO, error)
+	RemoveMember(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64) error
+}
+
+// GroupService is the group management a group service exposes, see Service
+type GroupService interface {
+	MemberService
+	CreateGroup(ctx context.Context, userID uint64, name string) (*GroupDTO, error)
+	ListGroups(ctx context.Context, userID uint64) ([]GroupDTO, error)
+	GetGroup(ctx context.Context, groupID uint64, userID uint64) (*GroupDetailDTO, error)
+	DeleteGroup(ctx context.Context, groupID uint64, userID uint64) error
+}
+
+// Handler handles HTTP requests for a kind of group and its members, on
+// routes with the group in :id and the member in :userId
+type Handler struct {
+	service GroupService
+	group   Group
+}
+
+// NewHandler creates a new group handler
+func NewHandler(service GroupService, group Group) *Handler {
+	return &Handler{service: service, group: group}
+}
+
+type CreateGroupRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type AddMemberRequest struct {
+	UserID uint64 `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"required"`
+}
+
+type ChangeMemberRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (h *Handler) groupID(c *gin.Context) (uint64, bool) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound(h.group.Name+" not found", err))
+		return 0, false
+	}
+	return groupID, true
+}
+
+func (h *Handler) checkRole(c *gin.Context, role string) bool {
+	if !slices.Contains(h.group.Roles, role) {
+		// same response as a failed binding tag
+		c.Error(&errors.APIError{
+			Status:  http.StatusUnprocessableEntity,
+			Message: "Validation failed",
+			Details: map[string]string{
+				"Role": fmt.Sprintf("Role must be one of: %s", strings.Join(h.group.Roles, " ")),
+			},
+		})
+		return false
+	}
+	return true
+}
+
+func (h *Handler) Create(c *gin.Context) {
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.CreateGroup(c.Request.Context(), userID.(uint64), req.Name)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+func (h *Handler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.ListGroups(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) Show(c *gin.Context) {
+	groupID, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	result, err := h.service.GetGroup(c.Request.Context(), groupID, userID.(uint64))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) Delete(c *gin.Context) {
+	groupID, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if err := h.service.DeleteGroup(c.Request.Context(), groupID, userID.(uint64)); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) AddMember(c *gin.Context) {
+	groupID, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+	if !h.checkRole(c, req.Role) {
+		return
+	}
+
+	requesterID, _ := c.Get("user_id")
+
+	result, err := h.service.AddMember(c.Request.Context(), groupID, requesterID.(uint64), req.UserID, req.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+func (h *Handler) ChangeMemberRole(c *gin.Context) {
+	groupID, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+
+	targetUserID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Member not found", err))
+		return
+	}
+
+	var req ChangeMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.NewValidationError(err))
+		return
+	}
+	if !h.checkRole(c, req.Role) {
+		return
+	}
+
+	requesterID, _ := c.Get("user_id")
+
+	result, err := h.service.ChangeMemberRole(c.Request.Context(), groupID, requesterID.(uint64), targetUserID, req.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) RemoveMember(c *gin.Context) {
+	groupID, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+
+	targetUserID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.Error(errors.NotFound("Member not found", err))
+		return
+	}
+
+	requesterID, _ := c.Get("user_id")
+
+	if err := h.service.RemoveMember(c.Request.Context(), groupID, requesterID.(uint64), targetUserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,151 @@
+package membership
+
+import (
+	"bytes"
+	"collaborative-markdown-editor/internal/errors"
+	"collaborative-markdown-editor/internal/middleware"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mock implementation of the GroupService interface
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) CreateGroup(ctx context.Context, userID uint64, name string) (*GroupDTO, error) {
+	args := m.Called(ctx, userID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*GroupDTO), args.Error(1)
+}
+
+func (m *MockService) ListGroups(ctx context.Context, userID uint64) ([]GroupDTO, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]GroupDTO), args.Error(1)
+}
+
+func (m *MockService) GetGroup(ctx context.Context, groupID uint64, userID uint64) (*GroupDetailDTO, error) {
+	args := m.Called(ctx, groupID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*GroupDetailDTO), args.Error(1)
+}
+
+func (m *MockService) DeleteGroup(ctx context.Context, groupID uint64, userID uint64) error {
+	args := m.Called(ctx, groupID, userID)
+	return args.Error(0)
+}
+
+func (m *MockService) AddMember(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64, role string) (*MemberDTO, error) {
+	args := m.Called(ctx, groupID, requesterID, targetUserID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*MemberDTO), args.Error(1)
+}
+
+func (m *MockService) ChangeMemberRole(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64, role string) (*MemberDTO, error) {
+	args := m.Called(ctx, groupID, requesterID, targetUserID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*MemberDTO), args.Error(1)
+}
+
+func (m *MockService) RemoveMember(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64) error {
+	args := m.Called(ctx, groupID, requesterID, targetUserID)
+	return args.Error(0)
+}
+
+var handlerGroup = Group{Name: "Team", Roles: []string{"admin", "member"}}
+
+func setupRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.ErrorHandler())
+	return router
+}
+
+// TestCreate_Success tests creating a group
+func TestCreate_Success(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService, handlerGroup)
+	router := setupRouter()
+
+	result := &GroupDTO{ID: 1, Name: "Design", Role: "admin", MemberCount: 1}
+	mockService.On("CreateGroup", mock.Anything, uint64(1), "Design").Return(result, nil)
+
+	router.POST("/teams", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Create(c)
+	})
+
+	req := httptest.NewRequest("POST", "/teams", bytes.NewBufferString(`{"name":"Design"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response GroupDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "admin", response.Role)
+	mockService.AssertExpectations(t)
+}
+
+// TestCreate_InvalidInput tests that a group needs a name
+func TestCreate_InvalidInput(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService, handlerGroup)
+	router := setupRouter()
+
+	router.POST("/teams", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.Create(c)
+	})
+
+	req := httptest.NewRequest("POST", "/teams", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	mockService.AssertNotCalled(t, "CreateGroup")
+}
+
+// TestShow_NotMember tests that only members see a group
+func TestShow_NotMember(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewHandler(mockService, handlerGroup)
+	router := setupRouter()
+
+	mockService.On("GetGroup", mock.Anything, uint64(1), uint64(2)).
+		Return(nil, errors.Forbidden("You're not team member", nil))
+
+	router.GET("/teams/:id", func(c *gin.Context) {
+		c.Set("user_id", uint64(2))
+		handler.Show(c)
+	})
+
+	req := httptest.NewRequest("GET", "/teams/1", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockService.AssertExpectations(t)
+}
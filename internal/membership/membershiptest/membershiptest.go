@@ -0,0 +1,100 @@
+// Package membershiptest provides the mocks shared by the tests of the
+// membership package and of the groups built on it, like teams and
+// workspaces.
+package membershiptest
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/membership"
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockRepository mocks membership.Repository. A group embeds it in its own
+// mock and adds the methods of its repository.
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) Create(ctx context.Context, name string, adminID uint64) (*membership.GroupRow, error) {
+	args := m.Called(ctx, name, adminID)
+	row, _ := args.Get(0).(*membership.GroupRow)
+	return row, args.Error(1)
+}
+
+func (m *MockRepository) Find(ctx context.Context, groupID uint64) (*membership.GroupRow, error) {
+	args := m.Called(ctx, groupID)
+	row, _ := args.Get(0).(*membership.GroupRow)
+	return row, args.Error(1)
+}
+
+func (m *MockRepository) Delete(ctx context.Context, groupID uint64) error {
+	return m.Called(ctx, groupID).Error(0)
+}
+
+func (m *MockRepository) ListByUser(ctx context.Context, userID uint64) ([]membership.GroupRow, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]membership.GroupRow), args.Error(1)
+}
+
+func (m *MockRepository) GetMemberRole(ctx context.Context, groupID uint64, userID uint64) (string, error) {
+	args := m.Called(ctx, groupID, userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) ListMembers(ctx context.Context, groupID uint64) ([]membership.MemberRow, error) {
+	args := m.Called(ctx, groupID)
+	return args.Get(0).([]membership.MemberRow), args.Error(1)
+}
+
+func (m *MockRepository) MemberIDs(ctx context.Context, groupID uint64) ([]uint64, error) {
+	args := m.Called(ctx, groupID)
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+func (m *MockRepository) AddMember(ctx context.Context, groupID uint64, userID uint64, role string) error {
+	return m.Called(ctx, groupID, userID, role).Error(0)
+}
+
+func (m *MockRepository) UpdateMemberRole(ctx context.Context, groupID uint64, userID uint64, role string) error {
+	return m.Called(ctx, groupID, userID, role).Error(0)
+}
+
+func (m *MockRepository) RemoveMember(ctx context.Context, groupID uint64, userID uint64) error {
+	return m.Called(ctx, groupID, userID).Error(0)
+}
+
+// MockUserProvider mocks membership.UserProvider
+type MockUserProvider struct {
+	mock.Mock
+}
+
+func (m *MockUserProvider) GetUserByID(ctx context.Context, id uint64) (*domain.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+// AccessChange is a notification of a group service about the documents its
+// members can open
+type AccessChange struct {
+	DocIDs    []uint64
+	UserIDs   []uint64
+	Ownership bool // NotifyOwnershipChanged rather than NotifyAccessChanged
+}
+
+// RecordingNotifier records the access changes a group service reports
+type RecordingNotifier struct {
+	Changes []AccessChange
+}
+
+func (n *RecordingNotifier) NotifyAccessChanged(ctx context.Context, docIDs []uint64, userIDs []uint64) {
+	n.Changes = append(n.Changes, AccessChange{DocIDs: docIDs, UserIDs: userIDs})
+}
+
+func (n *RecordingNotifier) NotifyOwnershipChanged(ctx context.Context, docIDs []uint64, userIDs []uint64) {
+	n.Changes = append(n.Changes, AccessChange{DocIDs: docIDs, UserIDs: userIDs, Ownership: true})
+}
@@ -0,0 +1,273 @@
+// Package membership manages the members of a group of users, like a team or
+// a workspace: who is in it and with which role, with at least one admin
+// always left to manage it.
+package membership
+
+import (
+	"context"
+	defError "errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLastAdmin is returned when a change would leave a group without admin
+var ErrLastAdmin = defError.New("group needs an admin")
+
+// ErrAlreadyMember is returned when adding a user who is in the group already
+var ErrAlreadyMember = defError.New("user is already a member")
+
+// Group describes a kind of group and where its members are stored
+type Group struct {
+	Name        string   // shown in messages, like "Team"
+	Table       string   // table of the groups, with id, name, created_by and timestamps
+	MemberTable string   // table of the members, with user_id, role and added_at
+	ForeignKey  string   // column of MemberTable holding the group id
+	Roles       []string // roles a member can be given, "admin" manages the group
+}
+
+// Repository defines the data access to the members of one kind of group
+type Repository interface {
+	Create(ctx context.Context, name string, adminID uint64) (*GroupRow, error)
+	Find(ctx context.Context, groupID uint64) (*GroupRow, error)
+	Delete(ctx context.Context, groupID uint64) error
+	ListByUser(ctx context.Context, userID uint64) ([]GroupRow, error)
+	GetMemberRole(ctx context.Context, groupID uint64, userID uint64) (string, error)
+	ListMembers(ctx context.Context, groupID uint64) ([]MemberRow, error)
+	MemberIDs(ctx context.Context, groupID uint64) ([]uint64, error)
+	AddMember(ctx context.Context, groupID uint64, userID uint64, role string) error
+	UpdateMemberRole(ctx context.Context, groupID uint64, userID uint64, role string) error
+	RemoveMember(ctx context.Context, groupID uint64, userID uint64) error
+}
+
+// RepositoryImpl implements Repository
+type RepositoryImpl struct {
+	db    *gorm.DB
+	group Group
+}
+
+// NewRepository creates a repository for the members of group
+func NewRepository(db *gorm.DB, group Group) Repository {
+	return &RepositoryImpl{db: db, group: group}
+}
+
+type GroupRow struct {
+	ID          uint64
+	Name        string
+	Role        string
+	MemberCount int
+	CreatedAt   time.Time
+}
+
+// Create creates a group with adminID as its first admin
+func (r *RepositoryImpl) Create(ctx context.Context, name string, adminID uint64) (*GroupRow, error) {
+	row := GroupRow{Name: name, Role: "admin", MemberCount: 1, CreatedAt: time.Now().UTC()}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw(
+			fmt.Sprintf("INSERT INTO %s (name, created_by, created_at, updated_at) VALUES (?, ?, ?, ?) RETURNING id", r.group.Table),
+			name, adminID, row.CreatedAt, row.CreatedAt,
+		).Scan(&row.ID).Error; err != nil {
+			return err
+		}
+		return tx.Table(r.group.MemberTable).Create(map[string]any{
+			r.group.ForeignKey: row.ID,
+			"user_id":          adminID,
+			"role":             "admin",
+			"added_at":         row.CreatedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &row, nil
+}
+
+// Find returns a group without the role and member count, or
+// gorm.ErrRecordNotFound
+func (r *RepositoryImpl) Find(ctx context.Context, groupID uint64) (*GroupRow, error) {
+	var row GroupRow
+	err := r.db.WithContext(ctx).
+		Table(r.group.Table).
+		Select("id, name, created_at").
+		Where("id = ?", groupID).
+		Take(&row).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &row, nil
+}
+
+// Delete deletes a group, its members go with it
+func (r *RepositoryImpl) Delete(ctx context.Context, groupID uint64) error {
+	result := r.db.WithContext(ctx).Exec(
+		fmt.Sprintf("DELETE FROM %s WHERE id = ?", r.group.Table),
+		groupID,
+	)
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ListByUser returns the groups of a user with their role in each
+func (r *RepositoryImpl) ListByUser(ctx context.Context, userID uint64) ([]GroupRow, error) {
+	var rows []GroupRow
+
+	err := r.db.WithContext(ctx).
+		Table(r.group.Table+" t").
+		Select(fmt.Sprintf(`
+			t.id AS id,
+			t.name AS name,
+			m.role AS role,
+			(SELECT COUNT(*) FROM %s c WHERE c.%s = t.id) AS member_count,
+			t.created_at AS created_at
+		`, r.group.MemberTable, r.group.ForeignKey)).
+		Joins(fmt.Sprintf("JOIN %s m ON m.%s = t.id", r.group.MemberTable, r.group.ForeignKey)).
+		Where("m.user_id = ?", userID).
+		Order("t.name ASC, t.id ASC").
+		Scan(&rows).Error
+
+	return rows, err
+}
+
+// members selects the member rows of a group
+func (r *RepositoryImpl) members(tx *gorm.DB, groupID uint64) *gorm.DB {
+	return tx.Table(r.group.MemberTable).Where(r.group.ForeignKey+" = ?", groupID)
+}
+
+// GetMemberRole returns the role of userID in a group, "none" when they are
+// not a member
+func (r *RepositoryImpl) GetMemberRole(ctx context.Context, groupID uint64, userID uint64) (string, error) {
+	var role string
+	err := r.members(r.db.WithContext(ctx), groupID).
+		Where("user_id = ?", userID).
+		Select("role").
+		Scan(&role).Error
+	if err != nil || role == "" {
+		return "none", err
+	}
+
+	return role, nil
+}
+
+type MemberRow struct {
+	UserID  uint64
+	Name    string
+	Email   string
+	Role    string
+	AddedAt time.Time
+}
+
+func (r *RepositoryImpl) ListMembers(ctx context.Context, groupID uint64) ([]MemberRow, error) {
+	var rows []MemberRow
+
+	err := r.db.WithContext(ctx).
+		Table(r.group.MemberTable+" m").
+		Select(`
+			u.id AS user_id,
+			u.name AS name,
+			u.email AS email,
+			m.role AS role,
+			m.added_at AS added_at
+		`).
+		Joins("JOIN users u ON u.id = m.user_id").
+		Where("m."+r.group.ForeignKey+" = ?", groupID).
+		Order("m.added_at ASC").
+		Scan(&rows).Error
+
+	return rows, err
+}
+
+func (r *RepositoryImpl) MemberIDs(ctx context.Context, groupID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.members(r.db.WithContext(ctx), groupID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+func (r *RepositoryImpl) AddMember(ctx context.Context, groupID uint64, userID uint64, role string) error {
+	result := r.db.WithContext(ctx).
+		Table(r.group.MemberTable).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(map[string]any{
+			r.group.ForeignKey: groupID,
+			"user_id":          userID,
+			"role":             role,
+			"added_at":         time.Now().UTC(),
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyMember
+	}
+
+	return nil
+}
+
+// UpdateMemberRole changes the role of a member. It returns ErrLastAdmin
+// instead of demoting the only admin.
+func (r *RepositoryImpl) UpdateMemberRole(ctx context.Context, groupID uint64, userID uint64, role string) error {
+	return r.changeMember(ctx, groupID, func(tx *gorm.DB) *gorm.DB {
+		return r.members(tx, groupID).
+			Where("user_id = ?", userID).
+			Update("role", role)
+	})
+}
+
+// RemoveMember removes a member. It returns ErrLastAdmin instead of removing
+// the only admin.
+func (r *RepositoryImpl) RemoveMember(ctx context.Context, groupID uint64, userID uint64) error {
+	return r.changeMember(ctx, groupID, func(tx *gorm.DB) *gorm.DB {
+		return tx.Exec(
+			fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND user_id = ?", r.group.MemberTable, r.group.ForeignKey),
+			groupID, userID,
+		)
+	})
+}
+
+// changeMember runs change on a member with the group locked, and rolls it
+// back when no admin is left
+func (r *RepositoryImpl) changeMember(ctx context.Context, groupID uint64, change func(tx *gorm.DB) *gorm.DB) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// lock the group so concurrent changes can't remove every admin
+		var id uint64
+		if err := tx.Raw(fmt.Sprintf("SELECT id FROM %s WHERE id = ? FOR UPDATE", r.group.Table), groupID).
+			Scan(&id).Error; err != nil {
+			return err
+		}
+		if id == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		result := change(tx)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		var admins int64
+		if err := r.members(tx, groupID).
+			Where("role = ?", "admin").
+			Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins == 0 {
+			return ErrLastAdmin
+		}
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+package membership
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var sqlGroup = Group{
+	Name:        "Team",
+	Table:       "teams",
+	MemberTable: "team_members",
+	ForeignKey:  "team_id",
+	Roles:       []string{"admin", "member"},
+}
+
+func newSQLRepo(t *testing.T) (Repository, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+	return NewRepository(db, sqlGroup), mock
+}
+
+// expectLockedGroup expects team 7 to be locked before a member changes
+func expectLockedGroup(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM teams WHERE id = $1 FOR UPDATE")).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+}
+
+func expectAdminCount(mock sqlmock.Sqlmock, admins int) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "team_members" WHERE team_id = $1 AND role = $2`)).
+		WithArgs(7, "admin").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(admins))
+}
+
+// TestUpdateMemberRole_LastAdmin tests that demoting the only admin is rolled
+// back, and that another admin can be demoted
+func TestUpdateMemberRole_LastAdmin(t *testing.T) {
+	repo, mock := newSQLRepo(t)
+	update := regexp.QuoteMeta(`UPDATE "team_members" SET "role"=$1 WHERE team_id = $2 AND user_id = $3`)
+
+	expectLockedGroup(mock)
+	mock.ExpectExec(update).
+		WithArgs("member", 7, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAdminCount(mock, 0)
+	mock.ExpectRollback()
+
+	err := repo.UpdateMemberRole(context.Background(), 7, 1, "member")
+	assert.ErrorIs(t, err, ErrLastAdmin)
+
+	expectLockedGroup(mock)
+	mock.ExpectExec(update).
+		WithArgs("member", 7, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAdminCount(mock, 1)
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.UpdateMemberRole(context.Background(), 7, 1, "member"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRemoveMember_LastAdmin tests that the only admin can't leave, and that
+// removing someone who is not a member is reported
+func TestRemoveMember_LastAdmin(t *testing.T) {
+	repo, mock := newSQLRepo(t)
+	remove := regexp.QuoteMeta("DELETE FROM team_members WHERE team_id = $1 AND user_id = $2")
+
+	expectLockedGroup(mock)
+	mock.ExpectExec(remove).
+		WithArgs(7, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAdminCount(mock, 0)
+	mock.ExpectRollback()
+
+	err := repo.RemoveMember(context.Background(), 7, 1)
+	assert.ErrorIs(t, err, ErrLastAdmin)
+
+	expectLockedGroup(mock)
+	mock.ExpectExec(remove).
+		WithArgs(7, 9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = repo.RemoveMember(context.Background(), 7, 9)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCreate tests that a group is created with its creator as first admin
+func TestCreate(t *testing.T) {
+	repo, mock := newSQLRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO teams (name, created_by, created_at, updated_at) VALUES ($1, $2, $3, $4) RETURNING id")).
+		WithArgs("Design", 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "team_members" ("added_at","role","team_id","user_id")`)).
+		WithArgs(sqlmock.AnyArg(), "admin", 7, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	row, err := repo.Create(context.Background(), "Design", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), row.ID)
+	assert.Equal(t, "admin", row.Role)
+	assert.Equal(t, 1, row.MemberCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,314 @@
+package membership
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
+	"context"
+	defError "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UserProvider interface {
+	GetUserByID(ctx context.Context, id uint64) (*domain.User, error)
+}
+
+// ChangeFunc is called after the role of a member changed, with "none" for
+// a user who joined or left the group
+type ChangeFunc func(ctx context.Context, groupID uint64, userID uint64, previous string, role string)
+
+// Service manages the members of one kind of group. Admins add members,
+// change their role and remove them; any member can leave.
+type Service struct {
+	repository   Repository
+	userProvider UserProvider
+	group        Group
+	changed      ChangeFunc
+}
+
+// NewService creates a member service for group, changed may be nil
+func NewService(repository Repository, userProvider UserProvider, group Group, changed ChangeFunc) *Service {
+	return &Service{
+		repository:   repository,
+		userProvider: userProvider,
+		group:        group,
+		changed:      changed,
+	}
+}
+
+type GroupDTO struct {
+	ID          uint64    `json:"id"`
+	Name        string    `json:"name"`
+	Role        string    `json:"role"` // of the requester
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GroupDetailDTO is a group with its members, for one of them
+type GroupDetailDTO struct {
+	GroupDTO
+	Members []MemberDTO `json:"members"`
+}
+
+type UserDTO struct {
+	ID    uint64 `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type MemberDTO struct {
+	User    UserDTO   `json:"user"`
+	Role    string    `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// CreateGroup creates a group with userID as its first admin
+func (s *Service) CreateGroup(ctx context.Context, userID uint64, name string) (*GroupDTO, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.UnprocessableEntity(s.group.Name+" name can't be empty", nil)
+	}
+
+	row, err := s.repository.Create(ctx, name, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GroupDTO{
+		ID:          row.ID,
+		Name:        row.Name,
+		Role:        row.Role,
+		MemberCount: row.MemberCount,
+		CreatedAt:   row.CreatedAt,
+	}, nil
+}
+
+// GetGroup returns a group and its members, to its members only
+func (s *Service) GetGroup(ctx context.Context, groupID uint64, userID uint64) (*GroupDetailDTO, error) {
+	role, err := s.RequireMember(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := s.repository.Find(ctx, groupID)
+	if err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound(s.group.Name+" not found", err)
+		}
+		return nil, err
+	}
+
+	members, err := s.ListMembers(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GroupDetailDTO{
+		GroupDTO: GroupDTO{
+			ID:          row.ID,
+			Name:        row.Name,
+			Role:        role,
+			MemberCount: len(members),
+			CreatedAt:   row.CreatedAt,
+		},
+		Members: members,
+	}, nil
+}
+
+// DeleteGroup deletes a group, admins only. A group with more to clean up
+// overrides it and calls Delete once the requester is checked.
+func (s *Service) DeleteGroup(ctx context.Context, groupID uint64, userID uint64) error {
+	if err := s.RequireAdmin(ctx, groupID, userID, "Only admin can delete "+s.name()); err != nil {
+		return err
+	}
+	return s.Delete(ctx, groupID)
+}
+
+// Delete deletes a group and its members without checking the requester
+func (s *Service) Delete(ctx context.Context, groupID uint64) error {
+	if err := s.repository.Delete(ctx, groupID); err != nil {
+		if defError.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound(s.group.Name+" not found", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// ListGroups returns the groups of a user with their role in each
+func (s *Service) ListGroups(ctx context.Context, userID uint64) ([]GroupDTO, error) {
+	rows, err := s.repository.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]GroupDTO, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, GroupDTO{
+			ID:          r.ID,
+			Name:        r.Name,
+			Role:        r.Role,
+			MemberCount: r.MemberCount,
+			CreatedAt:   r.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+// RequireMember returns the role of userID in a group, or Forbidden when they
+// are not a member
+func (s *Service) RequireMember(ctx context.Context, groupID uint64, userID uint64) (string, error) {
+	role, err := s.repository.GetMemberRole(ctx, groupID, userID)
+	if err != nil {
+		return "", err
+	}
+	if role == "none" {
+		return "", errors.Forbidden(fmt.Sprintf("You're not %s member", s.name()), nil)
+	}
+	return role, nil
+}
+
+// RequireAdmin returns Forbidden with msg unless userID is an admin of the group
+func (s *Service) RequireAdmin(ctx context.Context, groupID uint64, userID uint64, msg string) error {
+	role, err := s.repository.GetMemberRole(ctx, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if role != "admin" {
+		return errors.Forbidden(msg, nil)
+	}
+	return nil
+}
+
+func (s *Service) ListMembers(ctx context.Context, groupID uint64) ([]MemberDTO, error) {
+	rows, err := s.repository.ListMembers(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]MemberDTO, 0, len(rows))
+	for _, r := range rows {
+		members = append(members, MemberDTO{
+			User: UserDTO{
+				ID:    r.UserID,
+				Name:  r.Name,
+				Email: r.Email,
+			},
+			Role:    r.Role,
+			AddedAt: r.AddedAt,
+		})
+	}
+	return members, nil
+}
+
+func (s *Service) MemberIDs(ctx context.Context, groupID uint64) ([]uint64, error) {
+	return s.repository.MemberIDs(ctx, groupID)
+}
+
+func (s *Service) AddMember(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64, role string) (*MemberDTO, error) {
+	if err := s.RequireAdmin(ctx, groupID, requesterID, "Only admin can add member!"); err != nil {
+		return nil, err
+	}
+
+	// Ensure target user exists
+	user, err := s.userProvider.GetUserByID(ctx, targetUserID)
+	if err != nil {
+		return nil, errors.UnprocessableEntity("Can't find user!", nil)
+	}
+
+	if err := s.repository.AddMember(ctx, groupID, targetUserID, role); err != nil {
+		if defError.Is(err, ErrAlreadyMember) {
+			return nil, errors.Conflict("User already added!", err)
+		}
+		return nil, err
+	}
+
+	s.notify(ctx, groupID, targetUserID, "none", role)
+
+	return &MemberDTO{
+		User: UserDTO{
+			ID:    user.ID,
+			Name:  user.Name,
+			Email: user.Email,
+		},
+		Role:    role,
+		AddedAt: time.Now().UTC(),
+	}, nil
+}
+
+func (s *Service) ChangeMemberRole(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64, role string) (*MemberDTO, error) {
+	if err := s.RequireAdmin(ctx, groupID, requesterID, "Only admin can change role!"); err != nil {
+		return nil, err
+	}
+
+	previous, err := s.repository.GetMemberRole(ctx, groupID, targetUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.UpdateMemberRole(ctx, groupID, targetUserID, role); err != nil {
+		return nil, s.memberError(err)
+	}
+
+	s.notify(ctx, groupID, targetUserID, previous, role)
+
+	user, err := s.userProvider.GetUserByID(ctx, targetUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemberDTO{
+		User: UserDTO{
+			ID:    user.ID,
+			Name:  user.Name,
+			Email: user.Email,
+		},
+		Role: role,
+	}, nil
+}
+
+// RemoveMember removes a member from a group. Admins remove anyone, others can
+// only leave.
+func (s *Service) RemoveMember(ctx context.Context, groupID uint64, requesterID uint64, targetUserID uint64) error {
+	if requesterID != targetUserID {
+		if err := s.RequireAdmin(ctx, groupID, requesterID, "Only admin can remove member"); err != nil {
+			return err
+		}
+	}
+
+	previous, err := s.repository.GetMemberRole(ctx, groupID, targetUserID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repository.RemoveMember(ctx, groupID, targetUserID); err != nil {
+		return s.memberError(err)
+	}
+
+	s.notify(ctx, groupID, targetUserID, previous, "none")
+	return nil
+}
+
+func (s *Service) notify(ctx context.Context, groupID uint64, userID uint64, previous string, role string) {
+	if s.changed != nil && previous != role {
+		s.changed(ctx, groupID, userID, previous, role)
+	}
+}
+
+func (s *Service) memberError(err error) error {
+	if defError.Is(err, gorm.ErrRecordNotFound) {
+		return errors.UnprocessableEntity("Can't find user", err)
+	}
+	if defError.Is(err, ErrLastAdmin) {
+		return errors.UnprocessableEntity(s.group.Name+" needs at least one admin", err)
+	}
+	return err
+}
+
+// name is the group name for the middle of a sentence
+func (s *Service) name() string {
+	return strings.ToLower(s.group.Name)
+}
@@ -0,0 +1,135 @@
+package membership_test
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
+	"collaborative-markdown-editor/internal/membership"
+	"collaborative-markdown-editor/internal/membership/membershiptest"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testGroup = membership.Group{Name: "Team", Roles: []string{"admin", "member"}}
+
+type change struct {
+	userID   uint64
+	previous string
+	role     string
+}
+
+func newTestService(repo *membershiptest.MockRepository, users *membershiptest.MockUserProvider) (*membership.Service, *[]change) {
+	var changes []change
+	service := membership.NewService(repo, users, testGroup, func(ctx context.Context, groupID uint64, userID uint64, previous string, role string) {
+		changes = append(changes, change{userID, previous, role})
+	})
+	return service, &changes
+}
+
+// TestAddMember_Changed tests that a new member is reported as joining
+func TestAddMember_Changed(t *testing.T) {
+	repo := new(membershiptest.MockRepository)
+	users := new(membershiptest.MockUserProvider)
+	service, changes := newTestService(repo, users)
+
+	repo.On("GetMemberRole", mock.Anything, uint64(1), uint64(1)).Return("admin", nil)
+	users.On("GetUserByID", mock.Anything, uint64(2)).Return(&domain.User{ID: 2, Name: "Ana"}, nil)
+	repo.On("AddMember", mock.Anything, uint64(1), uint64(2), "member").Return(nil)
+
+	result, err := service.AddMember(context.Background(), 1, 1, 2, "member")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Ana", result.User.Name)
+	assert.Equal(t, []change{{2, "none", "member"}}, *changes)
+}
+
+// TestChangeMemberRole_LastAdmin tests that the only admin can't be demoted
+// and nothing is reported
+func TestChangeMemberRole_LastAdmin(t *testing.T) {
+	repo := new(membershiptest.MockRepository)
+	users := new(membershiptest.MockUserProvider)
+	service, changes := newTestService(repo, users)
+
+	repo.On("GetMemberRole", mock.Anything, uint64(1), uint64(1)).Return("admin", nil)
+	repo.On("UpdateMemberRole", mock.Anything, uint64(1), uint64(1), "member").Return(membership.ErrLastAdmin)
+
+	_, err := service.ChangeMemberRole(context.Background(), 1, 1, 1, "member")
+
+	var apiErr *errors.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "Team needs at least one admin", apiErr.Message)
+	assert.Empty(t, *changes)
+}
+
+// TestRemoveMember_Leave tests that a member can leave without being admin
+func TestRemoveMember_Leave(t *testing.T) {
+	repo := new(membershiptest.MockRepository)
+	users := new(membershiptest.MockUserProvider)
+	service, changes := newTestService(repo, users)
+
+	repo.On("GetMemberRole", mock.Anything, uint64(1), uint64(2)).Return("member", nil)
+	repo.On("RemoveMember", mock.Anything, uint64(1), uint64(2)).Return(nil)
+
+	err := service.RemoveMember(context.Background(), 1, 2, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []change{{2, "member", "none"}}, *changes)
+	repo.AssertExpectations(t)
+}
+
+// TestCreateGroup_EmptyName tests that a group needs a name besides spaces
+func TestCreateGroup_EmptyName(t *testing.T) {
+	repo := new(membershiptest.MockRepository)
+	service, _ := newTestService(repo, new(membershiptest.MockUserProvider))
+
+	_, err := service.CreateGroup(context.Background(), 1, "  ")
+
+	var apiErr *errors.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "Team name can't be empty", apiErr.Message)
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestGetGroup_Members tests that a member sees the group with their role and
+// its members, and others don't see it
+func TestGetGroup_Members(t *testing.T) {
+	repo := new(membershiptest.MockRepository)
+	service, _ := newTestService(repo, new(membershiptest.MockUserProvider))
+
+	repo.On("GetMemberRole", mock.Anything, uint64(1), uint64(2)).Return("member", nil)
+	repo.On("GetMemberRole", mock.Anything, uint64(1), uint64(3)).Return("none", nil)
+	repo.On("Find", mock.Anything, uint64(1)).Return(&membership.GroupRow{ID: 1, Name: "Design"}, nil)
+	repo.On("ListMembers", mock.Anything, uint64(1)).Return([]membership.MemberRow{
+		{UserID: 1, Name: "Bo", Role: "admin"},
+		{UserID: 2, Name: "Ana", Role: "member"},
+	}, nil)
+
+	result, err := service.GetGroup(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "member", result.Role)
+	assert.Equal(t, 2, result.MemberCount)
+	assert.Equal(t, "Bo", result.Members[0].User.Name)
+
+	_, err = service.GetGroup(context.Background(), 1, 3)
+	var apiErr *errors.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "You're not team member", apiErr.Message)
+	repo.AssertNumberOfCalls(t, "Find", 1)
+}
+
+// TestDeleteGroup_NotAdmin tests that only admins delete a group
+func TestDeleteGroup_NotAdmin(t *testing.T) {
+	repo := new(membershiptest.MockRepository)
+	service, _ := newTestService(repo, new(membershiptest.MockUserProvider))
+
+	repo.On("GetMemberRole", mock.Anything, uint64(1), uint64(2)).Return("member", nil)
+
+	err := service.DeleteGroup(context.Background(), 1, 2)
+
+	var apiErr *errors.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "Only admin can delete team", apiErr.Message)
+	repo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
@@ -41,6 +41,15 @@ type DocMessage struct {
 	Timestamp      int64  `json:"timestamp"`
 }
 
+type DocRestoredMessage struct {
+	EventID    string `json:"event_id"`
+	Type       string `json:"type"`
+	DocumentID uint64 `json:"document_id"`
+	RestoredBy uint64 `json:"restored_by"`
+	Seq        uint64 `json:"seq"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
 func (s *Service) NotifyUserRoleChanged(docID, affectedUserID uint64, newRole string) {
 	// prioritize kafka
 	if s.kafkaProducer != nil {
@@ -98,3 +107,37 @@ func (s *Service) NotifyDocumentDeleted(docID uint64) {
 		)
 	})
 }
+
+func (s *Service) NotifyDocumentRestored(docID, restoredBy, seq uint64) {
+	// the sync server must drop its in-memory document whatever the transport,
+	// otherwise it keeps serving the state from before the restore
+	s.workerPool.Submit(func(bgCtx context.Context) error {
+		// 5s timeout
+		timeoutCtx, cancel := context.WithTimeout(bgCtx, 5*time.Second)
+		defer cancel()
+
+		if err := s.syncClient.ReloadDocument(timeoutCtx, docID); err != nil {
+			return err
+		}
+		if s.kafkaProducer != nil {
+			return nil
+		}
+
+		// without kafka, let the other collaborators know once the sync
+		// server serves the restored state
+		return s.syncClient.DocumentRestored(timeoutCtx, docID, restoredBy, seq)
+	})
+
+	// let the other collaborators know
+	if s.kafkaProducer != nil {
+		message := &DocRestoredMessage{
+			EventID:    uuid.New().String(),
+			Type:       "document.restored",
+			DocumentID: docID,
+			RestoredBy: restoredBy,
+			Seq:        seq,
+			Timestamp:  time.Now().Unix(),
+		}
+		s.kafkaProducer.SendMessage("notification-events", strconv.FormatUint(docID, 10), message)
+	}
+}
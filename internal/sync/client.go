@@ -33,6 +33,8 @@ type Client interface {
 	PostDocumentSnapshot(ctx context.Context, docID uint64) ([]byte, error)
 	UpdateUserPermission(ctx context.Context, docID uint64, userID uint64, role string) error
 	RemoveDocument(ctx context.Context, docID uint64) error
+	ReloadDocument(ctx context.Context, docID uint64) error
+	DocumentRestored(ctx context.Context, docID, restoredBy, seq uint64) error
 }
 
 func NewSyncClient() *SyncClient {
@@ -231,3 +233,61 @@ func (s *SyncClient) RemoveDocument(ctx context.Context, docID uint64) error {
 	resp.Body.Close()
 	return nil
 }
+
+// POST /internal/documents/:id/reload
+func (s *SyncClient) ReloadDocument(ctx context.Context, docID uint64) error {
+	if s.grpcClient != nil {
+		md := metadata.Pairs("x-internal-secret", config.AppConfig.SyncServerSecret)
+		ctx = metadata.NewOutgoingContext(ctx, md)
+		_, err := s.grpcClient.ReloadDocument(ctx, &syncpb.DocumentIDRequest{Id: docID})
+		if err != nil {
+			log.Error().Err(err).Uint64("doc_id", docID).Msg("gRPC notify sync server to reload document failed")
+		}
+		return err
+	}
+
+	path := fmt.Sprintf("/internal/documents/%d/reload", docID)
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	resp, err := s.doRequest(ctx, http.MethodPost, path, headers, nil)
+	if err != nil {
+		log.Error().Err(err).Uint64("doc_id", docID).Msg("failed to notify sync server to reload document")
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type RestoredRequest struct {
+	RestoredBy uint64 `json:"restored_by"`
+	Seq        uint64 `json:"seq"`
+}
+
+// POST /internal/documents/:id/restored
+func (s *SyncClient) DocumentRestored(ctx context.Context, docID, restoredBy, seq uint64) error {
+	if s.grpcClient != nil {
+		md := metadata.Pairs("x-internal-secret", config.AppConfig.SyncServerSecret)
+		ctx = metadata.NewOutgoingContext(ctx, md)
+		_, err := s.grpcClient.DocumentRestored(ctx, &syncpb.DocumentRestoredRequest{DocId: docID, RestoredBy: restoredBy, Seq: seq})
+		if err != nil {
+			log.Error().Err(err).Uint64("doc_id", docID).Msg("gRPC notify sync server document restored failed")
+		}
+		return err
+	}
+
+	path := fmt.Sprintf("/internal/documents/%d/restored", docID)
+	payload := RestoredRequest{restoredBy, seq}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	resp, err := s.doRequest(ctx, http.MethodPost, path, headers, payload)
+	if err != nil {
+		log.Error().Err(err).Uint64("doc_id", docID).Msg("failed to notify sync server document restored")
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -51,6 +51,19 @@ func TestSyncClient_HTTPFallback(t *testing.T) {
 			w.WriteHeader(http.StatusNoContent)
 		case r.Method == http.MethodDelete && r.URL.Path == "/internal/documents/123":
 			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/internal/documents/123/reload":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/internal/documents/123/restored":
+			var req RestoredRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.RestoredBy != 55 || req.Seq != 7 {
+				http.Error(w, "unexpected payload", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
 		default:
 			http.NotFound(w, r)
 		}
@@ -79,6 +92,14 @@ func TestSyncClient_HTTPFallback(t *testing.T) {
 	if err := client.RemoveDocument(context.Background(), 123); err != nil {
 		t.Fatalf("RemoveDocument failed: %v", err)
 	}
+
+	if err := client.ReloadDocument(context.Background(), 123); err != nil {
+		t.Fatalf("ReloadDocument failed: %v", err)
+	}
+
+	if err := client.DocumentRestored(context.Background(), 123, 55, 7); err != nil {
+		t.Fatalf("DocumentRestored failed: %v", err)
+	}
 }
 
 // mock GRPC server implementing the syncpb service.
@@ -113,6 +134,28 @@ func (g *grpcMock) PermissionChanged(ctx context.Context, req *syncpb.Permission
 	return &emptypb.Empty{}, nil
 }
 
+func (g *grpcMock) ReloadDocument(ctx context.Context, req *syncpb.DocumentIDRequest) (*emptypb.Empty, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get("x-internal-secret")) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+	if req.Id != 123 {
+		return nil, status.Error(codes.InvalidArgument, "unexpected payload")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcMock) DocumentRestored(ctx context.Context, req *syncpb.DocumentRestoredRequest) (*emptypb.Empty, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get("x-internal-secret")) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "")
+	}
+	if req.DocId != 123 || req.RestoredBy != 55 || req.Seq != 7 {
+		return nil, status.Error(codes.InvalidArgument, "unexpected payload")
+	}
+	return &emptypb.Empty{}, nil
+}
+
 func startGRPCMockServer(t *testing.T) (addr string, stop func()) {
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -154,4 +197,12 @@ func TestSyncClient_GRPC(t *testing.T) {
 	if err := client.RemoveDocument(context.Background(), 123); err != nil {
 		t.Fatalf("RemoveDocument grpc failed: %v", err)
 	}
+
+	if err := client.ReloadDocument(context.Background(), 123); err != nil {
+		t.Fatalf("ReloadDocument grpc failed: %v", err)
+	}
+
+	if err := client.DocumentRestored(context.Background(), 123, 55, 7); err != nil {
+		t.Fatalf("DocumentRestored grpc failed: %v", err)
+	}
 }
@@ -170,6 +170,66 @@ func (x *PermissionChangedRequest) GetRole() string {
 	return ""
 }
 
+type DocumentRestoredRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocId         uint64                 `protobuf:"varint,1,opt,name=doc_id,json=docId,proto3" json:"doc_id,omitempty"`
+	RestoredBy    uint64                 `protobuf:"varint,2,opt,name=restored_by,json=restoredBy,proto3" json:"restored_by,omitempty"`
+	Seq           uint64                 `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DocumentRestoredRequest) Reset() {
+	*x = DocumentRestoredRequest{}
+	mi := &file_internal_sync_syncpb_sync_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DocumentRestoredRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DocumentRestoredRequest) ProtoMessage() {}
+
+func (x *DocumentRestoredRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_sync_syncpb_sync_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DocumentRestoredRequest.ProtoReflect.Descriptor instead.
+func (*DocumentRestoredRequest) Descriptor() ([]byte, []int) {
+	return file_internal_sync_syncpb_sync_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DocumentRestoredRequest) GetDocId() uint64 {
+	if x != nil {
+		return x.DocId
+	}
+	return 0
+}
+
+func (x *DocumentRestoredRequest) GetRestoredBy() uint64 {
+	if x != nil {
+		return x.RestoredBy
+	}
+	return 0
+}
+
+func (x *DocumentRestoredRequest) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
 var File_internal_sync_syncpb_sync_proto protoreflect.FileDescriptor
 
 const file_internal_sync_syncpb_sync_proto_rawDesc = "" +
@@ -183,12 +243,19 @@ const file_internal_sync_syncpb_sync_proto_rawDesc = "" +
 	"\x18PermissionChangedRequest\x12\x15\n" +
 	"\x06doc_id\x18\x01 \x01(\x04R\x05docId\x12\x17\n" +
 	"\auser_id\x18\x02 \x01(\x04R\x06userId\x12\x12\n" +
-	"\x04role\x18\x03 \x01(\tR\x04role2\xcd\x02\n" +
+	"\x04role\x18\x03 \x01(\tR\x04role\"c\n" +
+	"\x17DocumentRestoredRequest\x12\x15\n" +
+	"\x06doc_id\x18\x01 \x01(\x04R\x05docId\x12\x1f\n" +
+	"\vrestored_by\x18\x02 \x01(\x04R\n" +
+	"restoredBy\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x04R\x03seq2\xeb\x03\n" +
 	"\x12SyncServerInternal\x12N\n" +
 	"\bGetState\x12\x1d.syncserver.DocumentIDRequest\x1a!.syncserver.DocumentStateResponse\"\x00\x12G\n" +
 	"\fPostSnapshot\x12\x1d.syncserver.DocumentIDRequest\x1a\x16.google.protobuf.Empty\"\x00\x12I\n" +
 	"\x0eDeleteDocument\x12\x1d.syncserver.DocumentIDRequest\x1a\x16.google.protobuf.Empty\"\x00\x12S\n" +
-	"\x11PermissionChanged\x12$.syncserver.PermissionChangedRequest\x1a\x16.google.protobuf.Empty\"\x00B4Z2collaborative-markdown-editor/internal/sync/syncpbb\x06proto3"
+	"\x11PermissionChanged\x12$.syncserver.PermissionChangedRequest\x1a\x16.google.protobuf.Empty\"\x00\x12I\n" +
+	"\x0eReloadDocument\x12\x1d.syncserver.DocumentIDRequest\x1a\x16.google.protobuf.Empty\"\x00\x12Q\n" +
+	"\x10DocumentRestored\x12#.syncserver.DocumentRestoredRequest\x1a\x16.google.protobuf.Empty\"\x00B4Z2collaborative-markdown-editor/internal/sync/syncpbb\x06proto3"
 
 var (
 	file_internal_sync_syncpb_sync_proto_rawDescOnce sync.Once
@@ -202,24 +269,29 @@ func file_internal_sync_syncpb_sync_proto_rawDescGZIP() []byte {
 	return file_internal_sync_syncpb_sync_proto_rawDescData
 }
 
-var file_internal_sync_syncpb_sync_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_internal_sync_syncpb_sync_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_internal_sync_syncpb_sync_proto_goTypes = []any{
 	(*DocumentIDRequest)(nil),        // 0: syncserver.DocumentIDRequest
 	(*DocumentStateResponse)(nil),    // 1: syncserver.DocumentStateResponse
 	(*PermissionChangedRequest)(nil), // 2: syncserver.PermissionChangedRequest
-	(*emptypb.Empty)(nil),            // 3: google.protobuf.Empty
+	(*DocumentRestoredRequest)(nil),  // 3: syncserver.DocumentRestoredRequest
+	(*emptypb.Empty)(nil),            // 4: google.protobuf.Empty
 }
 var file_internal_sync_syncpb_sync_proto_depIdxs = []int32{
 	0, // 0: syncserver.SyncServerInternal.GetState:input_type -> syncserver.DocumentIDRequest
 	0, // 1: syncserver.SyncServerInternal.PostSnapshot:input_type -> syncserver.DocumentIDRequest
 	0, // 2: syncserver.SyncServerInternal.DeleteDocument:input_type -> syncserver.DocumentIDRequest
 	2, // 3: syncserver.SyncServerInternal.PermissionChanged:input_type -> syncserver.PermissionChangedRequest
-	1, // 4: syncserver.SyncServerInternal.GetState:output_type -> syncserver.DocumentStateResponse
-	3, // 5: syncserver.SyncServerInternal.PostSnapshot:output_type -> google.protobuf.Empty
-	3, // 6: syncserver.SyncServerInternal.DeleteDocument:output_type -> google.protobuf.Empty
-	3, // 7: syncserver.SyncServerInternal.PermissionChanged:output_type -> google.protobuf.Empty
-	4, // [4:8] is the sub-list for method output_type
-	0, // [0:4] is the sub-list for method input_type
+	0, // 4: syncserver.SyncServerInternal.ReloadDocument:input_type -> syncserver.DocumentIDRequest
+	3, // 5: syncserver.SyncServerInternal.DocumentRestored:input_type -> syncserver.DocumentRestoredRequest
+	1, // 6: syncserver.SyncServerInternal.GetState:output_type -> syncserver.DocumentStateResponse
+	4, // 7: syncserver.SyncServerInternal.PostSnapshot:output_type -> google.protobuf.Empty
+	4, // 8: syncserver.SyncServerInternal.DeleteDocument:output_type -> google.protobuf.Empty
+	4, // 9: syncserver.SyncServerInternal.PermissionChanged:output_type -> google.protobuf.Empty
+	4, // 10: syncserver.SyncServerInternal.ReloadDocument:output_type -> google.protobuf.Empty
+	4, // 11: syncserver.SyncServerInternal.DocumentRestored:output_type -> google.protobuf.Empty
+	6, // [6:12] is the sub-list for method output_type
+	0, // [0:6] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -236,7 +308,7 @@ func file_internal_sync_syncpb_sync_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_sync_syncpb_sync_proto_rawDesc), len(file_internal_sync_syncpb_sync_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
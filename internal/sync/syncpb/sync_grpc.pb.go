@@ -24,6 +24,8 @@ const (
 	SyncServerInternal_PostSnapshot_FullMethodName      = "/syncserver.SyncServerInternal/PostSnapshot"
 	SyncServerInternal_DeleteDocument_FullMethodName    = "/syncserver.SyncServerInternal/DeleteDocument"
 	SyncServerInternal_PermissionChanged_FullMethodName = "/syncserver.SyncServerInternal/PermissionChanged"
+	SyncServerInternal_ReloadDocument_FullMethodName    = "/syncserver.SyncServerInternal/ReloadDocument"
+	SyncServerInternal_DocumentRestored_FullMethodName  = "/syncserver.SyncServerInternal/DocumentRestored"
 )
 
 // SyncServerInternalClient is the client API for SyncServerInternal service.
@@ -34,6 +36,10 @@ type SyncServerInternalClient interface {
 	PostSnapshot(ctx context.Context, in *DocumentIDRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	DeleteDocument(ctx context.Context, in *DocumentIDRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	PermissionChanged(ctx context.Context, in *PermissionChangedRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// drop any in-memory state and hydrate the document again from storage
+	ReloadDocument(ctx context.Context, in *DocumentIDRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// tell the collaborators of a document that it was restored
+	DocumentRestored(ctx context.Context, in *DocumentRestoredRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type syncServerInternalClient struct {
@@ -84,6 +90,26 @@ func (c *syncServerInternalClient) PermissionChanged(ctx context.Context, in *Pe
 	return out, nil
 }
 
+func (c *syncServerInternalClient) ReloadDocument(ctx context.Context, in *DocumentIDRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, SyncServerInternal_ReloadDocument_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *syncServerInternalClient) DocumentRestored(ctx context.Context, in *DocumentRestoredRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, SyncServerInternal_DocumentRestored_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SyncServerInternalServer is the server API for SyncServerInternal service.
 // All implementations must embed UnimplementedSyncServerInternalServer
 // for forward compatibility.
@@ -92,6 +118,10 @@ type SyncServerInternalServer interface {
 	PostSnapshot(context.Context, *DocumentIDRequest) (*emptypb.Empty, error)
 	DeleteDocument(context.Context, *DocumentIDRequest) (*emptypb.Empty, error)
 	PermissionChanged(context.Context, *PermissionChangedRequest) (*emptypb.Empty, error)
+	// drop any in-memory state and hydrate the document again from storage
+	ReloadDocument(context.Context, *DocumentIDRequest) (*emptypb.Empty, error)
+	// tell the collaborators of a document that it was restored
+	DocumentRestored(context.Context, *DocumentRestoredRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedSyncServerInternalServer()
 }
 
@@ -114,6 +144,12 @@ func (UnimplementedSyncServerInternalServer) DeleteDocument(context.Context, *Do
 func (UnimplementedSyncServerInternalServer) PermissionChanged(context.Context, *PermissionChangedRequest) (*emptypb.Empty, error) {
 	return nil, status.Error(codes.Unimplemented, "method PermissionChanged not implemented")
 }
+func (UnimplementedSyncServerInternalServer) ReloadDocument(context.Context, *DocumentIDRequest) (*emptypb.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method ReloadDocument not implemented")
+}
+func (UnimplementedSyncServerInternalServer) DocumentRestored(context.Context, *DocumentRestoredRequest) (*emptypb.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method DocumentRestored not implemented")
+}
 func (UnimplementedSyncServerInternalServer) mustEmbedUnimplementedSyncServerInternalServer() {}
 func (UnimplementedSyncServerInternalServer) testEmbeddedByValue()                            {}
 
@@ -207,6 +243,42 @@ func _SyncServerInternal_PermissionChanged_Handler(srv interface{}, ctx context.
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SyncServerInternal_ReloadDocument_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DocumentIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SyncServerInternalServer).ReloadDocument(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SyncServerInternal_ReloadDocument_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SyncServerInternalServer).ReloadDocument(ctx, req.(*DocumentIDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SyncServerInternal_DocumentRestored_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DocumentRestoredRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SyncServerInternalServer).DocumentRestored(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SyncServerInternal_DocumentRestored_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SyncServerInternalServer).DocumentRestored(ctx, req.(*DocumentRestoredRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // SyncServerInternal_ServiceDesc is the grpc.ServiceDesc for SyncServerInternal service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -230,6 +302,14 @@ var SyncServerInternal_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PermissionChanged",
 			Handler:    _SyncServerInternal_PermissionChanged_Handler,
 		},
+		{
+			MethodName: "ReloadDocument",
+			Handler:    _SyncServerInternal_ReloadDocument_Handler,
+		},
+		{
+			MethodName: "DocumentRestored",
+			Handler:    _SyncServerInternal_DocumentRestored_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "internal/sync/syncpb/sync.proto",
@@ -0,0 +1,11 @@
+package team
+
+import (
+	"collaborative-markdown-editor/internal/membership"
+)
+
+// NewHandler creates a new team handler, teams have no endpoints besides those
+// of membership.Handler
+func NewHandler(service Service) *membership.Handler {
+	return membership.NewHandler(service, group)
+}
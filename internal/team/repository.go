@@ -0,0 +1,48 @@
+package team
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/membership"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// group describes teams to the membership package
+var group = membership.Group{
+	Name:        "Team",
+	Table:       "teams",
+	MemberTable: "team_members",
+	ForeignKey:  "team_id",
+	Roles:       []string{"admin", "member"},
+}
+
+// TeamRepository defines the interface for team data access, the teams and
+// their members are stored by membership.Repository
+type TeamRepository interface {
+	membership.Repository
+	GrantedDocumentIDs(ctx context.Context, teamID uint64) ([]uint64, error)
+}
+
+// TeamRepositoryImpl implements TeamRepository
+type TeamRepositoryImpl struct {
+	membership.Repository
+	db *gorm.DB
+}
+
+// NewRepository creates a new team repository
+func NewRepository(db *gorm.DB) TeamRepository {
+	return &TeamRepositoryImpl{
+		Repository: membership.NewRepository(db, group),
+		db:         db,
+	}
+}
+
+// GrantedDocumentIDs returns the documents a team has access to
+func (r *TeamRepositoryImpl) GrantedDocumentIDs(ctx context.Context, teamID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Model(&domain.DocumentTeamGrant{}).
+		Where("team_id = ?", teamID).
+		Pluck("document_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,78 @@
+package team
+
+import (
+	"collaborative-markdown-editor/internal/membership"
+	"context"
+
+	log "github.com/rs/zerolog/log"
+)
+
+// Service defines the interface for team business logic
+type Service interface {
+	membership.GroupService
+}
+
+type UserProvider = membership.UserProvider
+
+// AccessNotifier is told when the documents users can open through their
+// teams change, see document.Service
+type AccessNotifier interface {
+	NotifyAccessChanged(ctx context.Context, docIDs []uint64, userIDs []uint64)
+}
+
+// DefaultService implements Service, the teams and their members are managed
+// by the embedded membership.Service
+type DefaultService struct {
+	*membership.Service
+	repository TeamRepository
+	access     AccessNotifier
+}
+
+// NewService creates a new team service
+func NewService(repository TeamRepository, userProvider UserProvider, access AccessNotifier) Service {
+	s := &DefaultService{
+		repository: repository,
+		access:     access,
+	}
+	s.Service = membership.NewService(repository, userProvider, group, s.memberChanged)
+	return s
+}
+
+// DeleteGroup deletes a team, its members lose the access it was granted
+func (s *DefaultService) DeleteGroup(ctx context.Context, teamID uint64, userID uint64) error {
+	if err := s.RequireAdmin(ctx, teamID, userID, "Only admin can delete team"); err != nil {
+		return err
+	}
+
+	// collected first, the grants and members go with the team
+	docIDs, err := s.repository.GrantedDocumentIDs(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	memberIDs, err := s.MemberIDs(ctx, teamID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Delete(ctx, teamID); err != nil {
+		return err
+	}
+
+	s.access.NotifyAccessChanged(ctx, docIDs, memberIDs)
+	return nil
+}
+
+// memberChanged tells a user their role on the documents of a team after
+// they joined or left it. Their access is the same for admins and members.
+func (s *DefaultService) memberChanged(ctx context.Context, teamID uint64, userID uint64, previous string, role string) {
+	if (previous == "none") == (role == "none") {
+		return
+	}
+
+	docIDs, err := s.repository.GrantedDocumentIDs(ctx, teamID)
+	if err != nil {
+		log.Error().Err(err).Uint64("team_id", teamID).Msg("failed to list team documents")
+		return
+	}
+	s.access.NotifyAccessChanged(ctx, docIDs, []uint64{userID})
+}
@@ -0,0 +1,87 @@
+package team
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/membership/membershiptest"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockRepository adds the team methods to the membership mock
+type MockRepository struct {
+	membershiptest.MockRepository
+}
+
+func (m *MockRepository) GrantedDocumentIDs(ctx context.Context, teamID uint64) ([]uint64, error) {
+	args := m.Called(ctx, teamID)
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+func newTestService() (Service, *MockRepository, *membershiptest.MockUserProvider, *membershiptest.RecordingNotifier) {
+	repo := new(MockRepository)
+	users := new(membershiptest.MockUserProvider)
+	access := &membershiptest.RecordingNotifier{}
+	return NewService(repo, users, access), repo, users, access
+}
+
+// TestDeleteGroup_NotifiesMembers tests that every member is told their role
+// on every document the team had access to, read before the team is gone
+func TestDeleteGroup_NotifiesMembers(t *testing.T) {
+	service, repo, _, access := newTestService()
+
+	repo.On("GetMemberRole", mock.Anything, uint64(7), uint64(1)).Return("admin", nil)
+	repo.On("GrantedDocumentIDs", mock.Anything, uint64(7)).Return([]uint64{10, 11}, nil).Once()
+	repo.On("MemberIDs", mock.Anything, uint64(7)).Return([]uint64{1, 2, 3}, nil).Once()
+	repo.On("Delete", mock.Anything, uint64(7)).Return(nil)
+
+	err := service.DeleteGroup(context.Background(), 7, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []membershiptest.AccessChange{{DocIDs: []uint64{10, 11}, UserIDs: []uint64{1, 2, 3}}}, access.Changes)
+	repo.AssertExpectations(t)
+}
+
+// TestDeleteGroup_NotAdmin tests that members can't delete a team
+func TestDeleteGroup_NotAdmin(t *testing.T) {
+	service, repo, _, access := newTestService()
+
+	repo.On("GetMemberRole", mock.Anything, uint64(7), uint64(2)).Return("member", nil)
+
+	err := service.DeleteGroup(context.Background(), 7, 2)
+
+	assert.Error(t, err)
+	repo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	assert.Empty(t, access.Changes)
+}
+
+// TestMemberChanged_NotifiesAccess tests that joining and leaving a team
+// changes the access to its documents, and a role change within it does not
+func TestMemberChanged_NotifiesAccess(t *testing.T) {
+	service, repo, users, access := newTestService()
+	ctx := context.Background()
+
+	repo.On("GetMemberRole", mock.Anything, uint64(7), uint64(1)).Return("admin", nil)
+	repo.On("GrantedDocumentIDs", mock.Anything, uint64(7)).Return([]uint64{10}, nil)
+	users.On("GetUserByID", mock.Anything, uint64(2)).Return(&domain.User{ID: 2, Name: "Ana"}, nil)
+
+	repo.On("AddMember", mock.Anything, uint64(7), uint64(2), "member").Return(nil)
+	_, err := service.AddMember(ctx, 7, 1, 2, "member")
+	assert.NoError(t, err)
+
+	repo.On("GetMemberRole", mock.Anything, uint64(7), uint64(2)).Return("member", nil).Once()
+	repo.On("UpdateMemberRole", mock.Anything, uint64(7), uint64(2), "admin").Return(nil)
+	_, err = service.ChangeMemberRole(ctx, 7, 1, 2, "admin")
+	assert.NoError(t, err)
+
+	repo.On("GetMemberRole", mock.Anything, uint64(7), uint64(2)).Return("admin", nil).Once()
+	repo.On("RemoveMember", mock.Anything, uint64(7), uint64(2)).Return(nil)
+	assert.NoError(t, service.RemoveMember(ctx, 7, 1, 2))
+
+	assert.Equal(t, []membershiptest.AccessChange{
+		{DocIDs: []uint64{10}, UserIDs: []uint64{2}}, // joined
+		{DocIDs: []uint64{10}, UserIDs: []uint64{2}}, // left
+	}, access.Changes)
+}
@@ -56,6 +56,14 @@ func (m *MockService) GetUserByID(ctx context.Context, id uint64) (*domain.User,
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
+func (m *MockService) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	args := m.Called(ctx, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
 func (m *MockService) DeactivateUser(ctx context.Context, id uint64) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
@@ -54,7 +54,8 @@ func (r *UserRepositoryImpl) UpdateFields(ctx context.Context, userID uint64, up
     return &user, nil
 }
 
-// FindByEmail finds a user by email
+// FindByEmail finds a user by email. Emails are stored in lower case, so the
+// caller passes a normalized one.
 func (r *UserRepositoryImpl) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
 
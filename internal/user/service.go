@@ -21,23 +21,38 @@ type Service interface {
 	Login(ctx context.Context, email, password string) (*domain.User, error)
 	Logout(ctx context.Context, userID uint64)
 	GetUserByID(ctx context.Context, id uint64) (*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
 	DeactivateUser(ctx context.Context, id uint64) error
 	SearchUsers(ctx context.Context, query string) ([]domain.SafeUser, error)
 }
 
+// InvitationClaimer gives a new user the access their email was invited to,
+// and returns how many invitations were claimed
+type InvitationClaimer interface {
+	ClaimInvitations(ctx context.Context, userID uint64, email string) (int, error)
+}
+
 // DefaultService implements Service
 type DefaultService struct {
-	repository UserRepository
-	cache      *redis.Cache
+	repository  UserRepository
+	cache       *redis.Cache
+	invitations InvitationClaimer
+}
+
+// NewService creates a new user service, invitations may be nil
+func NewService(repository UserRepository, cache *redis.Cache, invitations InvitationClaimer) Service {
+	return &DefaultService{repository: repository, cache: cache, invitations: invitations}
 }
 
-// NewService creates a new user service
-func NewService(repository UserRepository, cache *redis.Cache) Service {
-	return &DefaultService{repository: repository, cache: cache}
+// normalizeEmail is how emails are stored, they are compared without case
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 // Register registers a new user
 func (s *DefaultService) Register(ctx context.Context, user *domain.User) error {
+	user.Email = normalizeEmail(user.Email)
+
 	// Check if user with email already exists
 	_, err := s.repository.FindByEmail(ctx, user.Email)
 	if err != nil && err != gorm.ErrRecordNotFound {
@@ -56,7 +71,24 @@ func (s *DefaultService) Register(ctx context.Context, user *domain.User) error
 	user.IsActive = true
 
 	// Create user
-	return s.repository.Create(ctx, user)
+	if err := s.repository.Create(ctx, user); err != nil {
+		return err
+	}
+
+	// with the access they were invited to, an invitation that fails to be
+	// claimed can still be accepted with its token
+	if s.invitations == nil {
+		return nil
+	}
+	claimed, err := s.invitations.ClaimInvitations(ctx, user.ID, user.Email)
+	if err != nil {
+		log.Error().Err(err).Uint64("user_id", user.ID).Msg("failed to claim invitations")
+		return nil
+	}
+	if claimed > 0 {
+		log.Info().Uint64("user_id", user.ID).Int("documents", claimed).Msg("claimed invitations")
+	}
+	return nil
 }
 
 func (s *DefaultService) UpdateUser(ctx context.Context, userID uint64, req UpdateProfileRequest) (domain.SafeUser, error) {
@@ -67,7 +99,7 @@ func (s *DefaultService) UpdateUser(ctx context.Context, userID uint64, req Upda
 	}
 
 	if req.Email != nil {
-		updateData["email"] = *req.Email
+		updateData["email"] = normalizeEmail(*req.Email)
 	}
 
 	user, err := s.repository.UpdateFields(ctx, userID, updateData)
@@ -107,7 +139,7 @@ func (s *DefaultService) ChangePassword(ctx context.Context, userID uint64, req
 // Login authenticates a user
 func (s *DefaultService) Login(ctx context.Context, email, password string) (*domain.User, error) {
 	// Find user by email
-	user, err := s.repository.FindByEmail(ctx, email)
+	user, err := s.repository.FindByEmail(ctx, normalizeEmail(email))
 	if err != nil {
 		return nil, errors.Unauthorized("User not found!", err)
 	}
@@ -140,6 +172,11 @@ func (s *DefaultService) GetUserByID(ctx context.Context, id uint64) (*domain.Us
 	return s.repository.FindByID(ctx, id)
 }
 
+// GetUserByEmail gets a user by email
+func (s *DefaultService) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return s.repository.FindByEmail(ctx, normalizeEmail(email))
+}
+
 // DeactivateUser deactivates a user
 func (s *DefaultService) DeactivateUser(ctx context.Context, id uint64) error {
 	return s.repository.Deactivate(ctx, id)
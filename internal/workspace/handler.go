@@ -0,0 +1,11 @@
+package workspace
+
+import (
+	"collaborative-markdown-editor/internal/membership"
+)
+
+// NewHandler creates a new workspace handler, workspaces have no endpoints
+// besides those of membership.Handler
+func NewHandler(service Service) *membership.Handler {
+	return membership.NewHandler(service, group)
+}
@@ -0,0 +1,44 @@
+package workspace
+
+import (
+	"bytes"
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestAddMember_Guest tests that workspaces take guests, unlike teams, and
+// no document roles
+func TestAddMember_Guest(t *testing.T) {
+	service, repo, users, _ := newTestService()
+	handler := NewHandler(service)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.ErrorHandler())
+	router.POST("/workspaces/:id/members", func(c *gin.Context) {
+		c.Set("user_id", uint64(1))
+		handler.AddMember(c)
+	})
+
+	repo.On("GetMemberRole", mock.Anything, uint64(4), uint64(1)).Return("admin", nil)
+	users.On("GetUserByID", mock.Anything, uint64(2)).Return(&domain.User{ID: 2, Name: "Ana"}, nil)
+	repo.On("AddMember", mock.Anything, uint64(4), uint64(2), "guest").Return(nil)
+
+	for role, want := range map[string]int{"guest": http.StatusCreated, "editor": http.StatusUnprocessableEntity} {
+		req := httptest.NewRequest("POST", "/workspaces/4/members", bytes.NewBufferString(`{"user_id":2,"role":"`+role+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, want, w.Code, role)
+	}
+	repo.AssertNumberOfCalls(t, "AddMember", 1)
+}
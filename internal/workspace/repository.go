@@ -0,0 +1,95 @@
+package workspace
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/membership"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// group describes workspaces to the membership package
+var group = membership.Group{
+	Name:        "Workspace",
+	Table:       "workspaces",
+	MemberTable: "workspace_members",
+	ForeignKey:  "workspace_id",
+	Roles:       []string{"admin", "member", "guest"},
+}
+
+// WorkspaceRepository defines the interface for workspace data access, the
+// workspaces and their members are stored by membership.Repository. Deleting
+// a workspace fails while it owns documents.
+type WorkspaceRepository interface {
+	membership.Repository
+	DocumentIDs(ctx context.Context, workspaceID uint64) ([]uint64, error)
+	CreatedDocumentIDs(ctx context.Context, workspaceID uint64, userID uint64) ([]uint64, error)
+}
+
+// WorkspaceRepositoryImpl implements WorkspaceRepository. Members who leave or
+// become guests stop owning the documents they created in the workspace.
+type WorkspaceRepositoryImpl struct {
+	membership.Repository
+	db *gorm.DB
+}
+
+// NewRepository creates a new workspace repository
+func NewRepository(db *gorm.DB) WorkspaceRepository {
+	return &WorkspaceRepositoryImpl{
+		Repository: membership.NewRepository(db, group),
+		db:         db,
+	}
+}
+
+// DocumentIDs returns the documents owned by a workspace
+func (r *WorkspaceRepositoryImpl) DocumentIDs(ctx context.Context, workspaceID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Model(&domain.Document{}).
+		Where("workspace_id = ?", workspaceID).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// CreatedDocumentIDs returns the documents userID created in a workspace
+func (r *WorkspaceRepositoryImpl) CreatedDocumentIDs(ctx context.Context, workspaceID uint64, userID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Model(&domain.Document{}).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// UpdateMemberRole changes the role of a member, a guest keeps no owner role
+// on the documents of the workspace
+func (r *WorkspaceRepositoryImpl) UpdateMemberRole(ctx context.Context, workspaceID uint64, userID uint64, role string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := membership.NewRepository(tx, group).UpdateMemberRole(ctx, workspaceID, userID, role); err != nil {
+			return err
+		}
+		if role != "guest" {
+			return nil
+		}
+		return demoteCreator(tx, workspaceID, userID)
+	})
+}
+
+// RemoveMember removes a member, who keeps no owner role on the documents of
+// the workspace
+func (r *WorkspaceRepositoryImpl) RemoveMember(ctx context.Context, workspaceID uint64, userID uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := membership.NewRepository(tx, group).RemoveMember(ctx, workspaceID, userID); err != nil {
+			return err
+		}
+		return demoteCreator(tx, workspaceID, userID)
+	})
+}
+
+// demoteCreator turns the owner role userID holds as creator of documents of
+// the workspace into editor, the documents stay with the workspace
+func demoteCreator(tx *gorm.DB, workspaceID uint64, userID uint64) error {
+	return tx.Exec(`UPDATE document_collaborators SET role = 'editor'
+		WHERE user_id = ? AND role = 'owner'
+		AND document_id IN (SELECT id FROM documents WHERE workspace_id = ?)`,
+		userID, workspaceID,
+	).Error
+}
@@ -0,0 +1,82 @@
+package workspace
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newSQLRepo(t *testing.T) (WorkspaceRepository, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+	return NewRepository(db), mock
+}
+
+// TestRemoveMember_DemotesCreator tests that a member is removed and their
+// owner role on the documents they created demoted in one transaction
+func TestRemoveMember_DemotesCreator(t *testing.T) {
+	repo, mock := newSQLRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM workspaces WHERE id = $1 FOR UPDATE")).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2")).
+		WithArgs(4, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "workspace_members"`)).
+		WithArgs(4, "admin").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE document_collaborators SET role = 'editor'")).
+		WithArgs(2, 4).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.RemoveMember(context.Background(), 4, 2))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestUpdateMemberRole_Guest tests that only a member becoming a guest loses
+// the owner role on the documents they created
+func TestUpdateMemberRole_Guest(t *testing.T) {
+	repo, mock := newSQLRepo(t)
+	expectUpdate := func(role string) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM workspaces WHERE id = $1 FOR UPDATE")).
+			WithArgs(4).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "workspace_members" SET "role"=$1`)).
+			WithArgs(role, 4, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "workspace_members"`)).
+			WithArgs(4, "admin").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	}
+
+	expectUpdate("admin")
+	mock.ExpectCommit()
+	assert.NoError(t, repo.UpdateMemberRole(context.Background(), 4, 2, "admin"))
+
+	expectUpdate("guest")
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE document_collaborators SET role = 'editor'")).
+		WithArgs(2, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, repo.UpdateMemberRole(context.Background(), 4, 2, "guest"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
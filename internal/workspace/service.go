@@ -0,0 +1,86 @@
+package workspace
+
+import (
+	"collaborative-markdown-editor/internal/errors"
+	"collaborative-markdown-editor/internal/membership"
+	"context"
+
+	log "github.com/rs/zerolog/log"
+)
+
+// Service defines the interface for workspace business logic
+type Service interface {
+	membership.GroupService
+}
+
+type UserProvider = membership.UserProvider
+
+// AccessNotifier is told when users become or stop being owners of the
+// documents of a workspace, see document.Service
+type AccessNotifier interface {
+	NotifyAccessChanged(ctx context.Context, docIDs []uint64, userIDs []uint64)
+	NotifyOwnershipChanged(ctx context.Context, docIDs []uint64, userIDs []uint64)
+}
+
+// DefaultService implements Service, the workspaces and their members are
+// managed by the embedded membership.Service
+type DefaultService struct {
+	*membership.Service
+	repository WorkspaceRepository
+	access     AccessNotifier
+}
+
+// NewService creates a new workspace service
+func NewService(repository WorkspaceRepository, userProvider UserProvider, access AccessNotifier) Service {
+	s := &DefaultService{
+		repository: repository,
+		access:     access,
+	}
+	s.Service = membership.NewService(repository, userProvider, group, s.memberChanged)
+	return s
+}
+
+// DeleteGroup deletes a workspace once it owns no documents
+func (s *DefaultService) DeleteGroup(ctx context.Context, workspaceID uint64, userID uint64) error {
+	if err := s.RequireAdmin(ctx, workspaceID, userID, "Only admin can delete workspace"); err != nil {
+		return err
+	}
+
+	docIDs, err := s.repository.DocumentIDs(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if len(docIDs) > 0 {
+		return errors.Conflict("Workspace still owns documents", nil)
+	}
+
+	return s.Delete(ctx, workspaceID)
+}
+
+// memberChanged tells a user their role on the documents of a workspace after
+// they became or stopped being one of its admins, only admins own them. A
+// member who left or became a guest lost the owner role on the documents they
+// created.
+func (s *DefaultService) memberChanged(ctx context.Context, workspaceID uint64, userID uint64, previous string, role string) {
+	if (previous == "admin") != (role == "admin") {
+		docIDs, err := s.repository.DocumentIDs(ctx, workspaceID)
+		if err != nil {
+			log.Error().Err(err).Uint64("workspace_id", workspaceID).Msg("failed to list workspace documents")
+		} else {
+			s.access.NotifyAccessChanged(ctx, docIDs, []uint64{userID})
+		}
+	}
+
+	// only members and admins add documents
+	if previous == "none" || previous == "guest" || (role != "none" && role != "guest") {
+		return
+	}
+	created, err := s.repository.CreatedDocumentIDs(ctx, workspaceID, userID)
+	if err != nil {
+		log.Error().Err(err).Uint64("workspace_id", workspaceID).Msg("failed to list created documents")
+		return
+	}
+	if len(created) > 0 {
+		s.access.NotifyOwnershipChanged(ctx, created, []uint64{userID})
+	}
+}
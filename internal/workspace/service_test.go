@@ -0,0 +1,102 @@
+package workspace
+
+import (
+	"collaborative-markdown-editor/internal/domain"
+	"collaborative-markdown-editor/internal/errors"
+	"collaborative-markdown-editor/internal/membership/membershiptest"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockRepository adds the workspace methods to the membership mock
+type MockRepository struct {
+	membershiptest.MockRepository
+}
+
+func (m *MockRepository) DocumentIDs(ctx context.Context, workspaceID uint64) ([]uint64, error) {
+	args := m.Called(ctx, workspaceID)
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+func (m *MockRepository) CreatedDocumentIDs(ctx context.Context, workspaceID uint64, userID uint64) ([]uint64, error) {
+	args := m.Called(ctx, workspaceID, userID)
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+func newTestService() (Service, *MockRepository, *membershiptest.MockUserProvider, *membershiptest.RecordingNotifier) {
+	repo := new(MockRepository)
+	users := new(membershiptest.MockUserProvider)
+	access := &membershiptest.RecordingNotifier{}
+	return NewService(repo, users, access), repo, users, access
+}
+
+// TestDeleteGroup_OwnsDocuments tests that a workspace owning documents stays
+func TestDeleteGroup_OwnsDocuments(t *testing.T) {
+	service, repo, _, access := newTestService()
+
+	repo.On("GetMemberRole", mock.Anything, uint64(4), uint64(1)).Return("admin", nil)
+	repo.On("DocumentIDs", mock.Anything, uint64(4)).Return([]uint64{10}, nil)
+
+	err := service.DeleteGroup(context.Background(), 4, 1)
+
+	var apiErr *errors.APIError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, http.StatusConflict, apiErr.Status)
+	}
+	repo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	assert.Empty(t, access.Changes)
+}
+
+// TestMemberChanged_AdminsOnly tests that only becoming or stopping being an
+// admin changes the access to the documents of a workspace, its admins own
+// them and guests and members don't see them through it
+func TestMemberChanged_AdminsOnly(t *testing.T) {
+	service, repo, users, access := newTestService()
+	ctx := context.Background()
+
+	repo.On("GetMemberRole", mock.Anything, uint64(4), uint64(1)).Return("admin", nil)
+	repo.On("DocumentIDs", mock.Anything, uint64(4)).Return([]uint64{10}, nil)
+	repo.On("CreatedDocumentIDs", mock.Anything, uint64(4), uint64(2)).Return([]uint64{}, nil)
+	users.On("GetUserByID", mock.Anything, uint64(2)).Return(&domain.User{ID: 2, Name: "Ana"}, nil)
+
+	repo.On("AddMember", mock.Anything, uint64(4), uint64(2), "guest").Return(nil)
+	_, err := service.AddMember(ctx, 4, 1, 2, "guest")
+	assert.NoError(t, err)
+
+	repo.On("GetMemberRole", mock.Anything, uint64(4), uint64(2)).Return("guest", nil).Once()
+	repo.On("UpdateMemberRole", mock.Anything, uint64(4), uint64(2), "admin").Return(nil)
+	_, err = service.ChangeMemberRole(ctx, 4, 1, 2, "admin")
+	assert.NoError(t, err)
+
+	repo.On("GetMemberRole", mock.Anything, uint64(4), uint64(2)).Return("admin", nil).Once()
+	repo.On("UpdateMemberRole", mock.Anything, uint64(4), uint64(2), "member").Return(nil)
+	_, err = service.ChangeMemberRole(ctx, 4, 1, 2, "member")
+	assert.NoError(t, err)
+
+	repo.On("GetMemberRole", mock.Anything, uint64(4), uint64(2)).Return("member", nil).Once()
+	repo.On("RemoveMember", mock.Anything, uint64(4), uint64(2)).Return(nil)
+	assert.NoError(t, service.RemoveMember(ctx, 4, 1, 2))
+
+	assert.Equal(t, []membershiptest.AccessChange{
+		{DocIDs: []uint64{10}, UserIDs: []uint64{2}}, // promoted
+		{DocIDs: []uint64{10}, UserIDs: []uint64{2}}, // demoted
+	}, access.Changes)
+}
+
+// TestMemberChanged_CreatorLeaves tests that a member leaving is told they
+// no longer own the documents they created in the workspace
+func TestMemberChanged_CreatorLeaves(t *testing.T) {
+	service, repo, _, access := newTestService()
+
+	repo.On("GetMemberRole", mock.Anything, uint64(4), uint64(2)).Return("member", nil)
+	repo.On("RemoveMember", mock.Anything, uint64(4), uint64(2)).Return(nil)
+	repo.On("CreatedDocumentIDs", mock.Anything, uint64(4), uint64(2)).Return([]uint64{11}, nil)
+
+	assert.NoError(t, service.RemoveMember(context.Background(), 4, 2, 2))
+
+	assert.Equal(t, []membershiptest.AccessChange{{DocIDs: []uint64{11}, UserIDs: []uint64{2}, Ownership: true}}, access.Changes)
+}
@@ -0,0 +1,240 @@
+package yjs
+
+import "unicode/utf16"
+
+// content ref numbers as written in the low 5 bits of a struct info byte
+const (
+	refGC      = 0
+	refDeleted = 1
+	refJSON    = 2
+	refBinary  = 3
+	refString  = 4
+	refEmbed   = 5
+	refFormat  = 6
+	refType    = 7
+	refAny     = 8
+	refDoc     = 9
+	refSkip    = 10
+)
+
+// type refs of nested shared types
+const (
+	typeArray       = 0
+	typeMap         = 1
+	typeText        = 2
+	typeXmlElement  = 3
+	typeXmlFragment = 4
+	typeXmlHook     = 5
+	typeXmlText     = 6
+)
+
+// content is the payload of an item. Its length is the number of clock ticks
+// the item occupies.
+type content interface {
+	length() uint64
+	countable() bool
+	// splice keeps the first offset units and returns the rest
+	splice(offset uint64) content
+}
+
+type contentDeleted struct {
+	n uint64
+}
+
+func (c *contentDeleted) length() uint64  { return c.n }
+func (c *contentDeleted) countable() bool { return false }
+func (c *contentDeleted) splice(offset uint64) content {
+	right := &contentDeleted{n: c.n - offset}
+	c.n = offset
+	return right
+}
+
+// contentJSON keeps the raw JSON strings, "undefined" included
+type contentJSON struct {
+	values []string
+}
+
+func (c *contentJSON) length() uint64  { return uint64(len(c.values)) }
+func (c *contentJSON) countable() bool { return true }
+func (c *contentJSON) splice(offset uint64) content {
+	right := &contentJSON{values: append([]string(nil), c.values[offset:]...)}
+	c.values = c.values[:offset]
+	return right
+}
+
+type contentBinary struct {
+	data []byte
+}
+
+func (c *contentBinary) length() uint64        { return 1 }
+func (c *contentBinary) countable() bool       { return true }
+func (c *contentBinary) splice(uint64) content { panic("yjs: binary content cannot be split") }
+
+// contentString stores UTF-16 code units because item clocks count them
+type contentString struct {
+	units []uint16
+}
+
+func newContentString(s string) *contentString {
+	return &contentString{units: utf16.Encode([]rune(s))}
+}
+
+func (c *contentString) length() uint64  { return uint64(len(c.units)) }
+func (c *contentString) countable() bool { return true }
+func (c *contentString) splice(offset uint64) content {
+	right := &contentString{units: append([]uint16(nil), c.units[offset:]...)}
+	c.units = c.units[:offset]
+	// splitting a surrogate pair leaves a replacement character on both sides,
+	// as Yjs does
+	if last := c.units[offset-1]; last >= 0xd800 && last <= 0xdbff {
+		c.units[offset-1] = 0xfffd
+		right.units[0] = 0xfffd
+	}
+	return right
+}
+
+func (c *contentString) String() string {
+	return string(utf16.Decode(c.units))
+}
+
+type contentEmbed struct {
+	json string
+}
+
+func (c *contentEmbed) length() uint64        { return 1 }
+func (c *contentEmbed) countable() bool       { return true }
+func (c *contentEmbed) splice(uint64) content { panic("yjs: embed content cannot be split") }
+
+// contentFormat marks the start or end of a formatting attribute in a Y.Text
+type contentFormat struct {
+	key  string
+	json string
+}
+
+func (c *contentFormat) length() uint64        { return 1 }
+func (c *contentFormat) countable() bool       { return false }
+func (c *contentFormat) splice(uint64) content { panic("yjs: format content cannot be split") }
+
+type contentType struct {
+	t *sharedType
+}
+
+func (c *contentType) length() uint64        { return 1 }
+func (c *contentType) countable() bool       { return true }
+func (c *contentType) splice(uint64) content { panic("yjs: type content cannot be split") }
+
+type contentAny struct {
+	values []any
+}
+
+func (c *contentAny) length() uint64  { return uint64(len(c.values)) }
+func (c *contentAny) countable() bool { return true }
+func (c *contentAny) splice(offset uint64) content {
+	right := &contentAny{values: append([]any(nil), c.values[offset:]...)}
+	c.values = c.values[:offset]
+	return right
+}
+
+// contentDoc is a subdocument; only its reference is kept
+type contentDoc struct {
+	guid string
+	opts any
+}
+
+func (c *contentDoc) length() uint64        { return 1 }
+func (c *contentDoc) countable() bool       { return true }
+func (c *contentDoc) splice(uint64) content { panic("yjs: doc content cannot be split") }
+
+func readContent(d *decoder, ref byte) (content, error) {
+	switch ref {
+	case refDeleted:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		return &contentDeleted{n: n}, nil
+	case refJSON:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		c := &contentJSON{}
+		for i := uint64(0); i < n; i++ {
+			s, err := d.readVarString()
+			if err != nil {
+				return nil, err
+			}
+			c.values = append(c.values, s)
+		}
+		return c, nil
+	case refBinary:
+		b, err := d.readVarBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &contentBinary{data: append([]byte(nil), b...)}, nil
+	case refString:
+		s, err := d.readVarString()
+		if err != nil {
+			return nil, err
+		}
+		return newContentString(s), nil
+	case refEmbed:
+		s, err := d.readVarString()
+		if err != nil {
+			return nil, err
+		}
+		return &contentEmbed{json: s}, nil
+	case refFormat:
+		key, err := d.readVarString()
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.readVarString()
+		if err != nil {
+			return nil, err
+		}
+		return &contentFormat{key: key, json: s}, nil
+	case refType:
+		typeRef, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if typeRef > typeXmlText {
+			return nil, ErrMalformed
+		}
+		t := newSharedType(uint8(typeRef))
+		if typeRef == typeXmlElement || typeRef == typeXmlHook {
+			if t.nodeName, err = d.readVarString(); err != nil {
+				return nil, err
+			}
+		}
+		return &contentType{t: t}, nil
+	case refAny:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		c := &contentAny{}
+		for i := uint64(0); i < n; i++ {
+			v, err := d.readAny()
+			if err != nil {
+				return nil, err
+			}
+			c.values = append(c.values, v)
+		}
+		return c, nil
+	case refDoc:
+		guid, err := d.readVarString()
+		if err != nil {
+			return nil, err
+		}
+		opts, err := d.readAny()
+		if err != nil {
+			return nil, err
+		}
+		return &contentDoc{guid: guid, opts: opts}, nil
+	}
+
+	return nil, ErrMalformed
+}
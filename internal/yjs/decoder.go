@@ -0,0 +1,187 @@
+package yjs
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+)
+
+var (
+	ErrUnexpectedEOF = errors.New("yjs: unexpected end of update")
+	ErrMalformed     = errors.New("yjs: malformed update")
+)
+
+// Undefined is the decoded form of the JavaScript undefined value
+type Undefined struct{}
+
+// decoder reads the lib0 binary encoding used by Yjs v1 updates
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func newDecoder(buf []byte) *decoder {
+	return &decoder{buf: buf}
+}
+
+func (d *decoder) hasContent() bool {
+	return d.pos < len(d.buf)
+}
+
+func (d *decoder) readUint8() (byte, error) {
+	if d.pos >= len(d.buf) {
+		return 0, ErrUnexpectedEOF
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *decoder) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)-d.pos) {
+		return nil, ErrUnexpectedEOF
+	}
+	b := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// readVarUint reads an unsigned integer stored 7 bits per byte, least
+// significant group first
+func (d *decoder) readVarUint() (uint64, error) {
+	var num uint64
+	var shift uint
+	for {
+		b, err := d.readUint8()
+		if err != nil {
+			return 0, err
+		}
+		if shift > 63 {
+			return 0, ErrMalformed
+		}
+		num |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return num, nil
+		}
+		shift += 7
+	}
+}
+
+// readVarInt reads a signed integer; the first byte carries the sign bit and
+// 6 bits of the value
+func (d *decoder) readVarInt() (int64, error) {
+	b, err := d.readUint8()
+	if err != nil {
+		return 0, err
+	}
+	num := uint64(b & 0x3f)
+	negative := b&0x40 > 0
+	shift := uint(6)
+	for b&0x80 > 0 {
+		b, err = d.readUint8()
+		if err != nil {
+			return 0, err
+		}
+		if shift > 63 {
+			return 0, ErrMalformed
+		}
+		num |= uint64(b&0x7f) << shift
+		shift += 7
+	}
+	if negative {
+		return -int64(num), nil
+	}
+	return int64(num), nil
+}
+
+func (d *decoder) readVarBytes() ([]byte, error) {
+	n, err := d.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	return d.readBytes(n)
+}
+
+func (d *decoder) readVarString() (string, error) {
+	b, err := d.readVarBytes()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readAny reads a value written by lib0's writeAny
+func (d *decoder) readAny() (any, error) {
+	t, err := d.readUint8()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case 127:
+		return Undefined{}, nil
+	case 126:
+		return nil, nil
+	case 125:
+		return d.readVarInt()
+	case 124:
+		b, err := d.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case 123:
+		b, err := d.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 122:
+		b, err := d.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetInt64(int64(binary.BigEndian.Uint64(b))), nil
+	case 121:
+		return false, nil
+	case 120:
+		return true, nil
+	case 119:
+		return d.readVarString()
+	case 118:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		obj := make(map[string]any)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.readVarString()
+			if err != nil {
+				return nil, err
+			}
+			if obj[key], err = d.readAny(); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	case 117:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		arr := make([]any, 0, min(n, uint64(len(d.buf)-d.pos)))
+		for i := uint64(0); i < n; i++ {
+			v, err := d.readAny()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case 116:
+		return d.readVarBytes()
+	}
+
+	return nil, ErrMalformed
+}
@@ -0,0 +1,463 @@
+// Package yjs applies Yjs v1 updates to an in-memory document so the backend
+// can read the content of a Y.Doc without a sync server. It implements the
+// parts of the Yjs integration algorithm needed to rebuild shared types; it
+// does not emit events, track undo or garbage collect.
+package yjs
+
+import (
+	"slices"
+	"sort"
+	"unicode/utf16"
+)
+
+// item is a struct in the document store: a piece of content, a GC range of
+// collected content or a Skip placeholder in an update
+type item struct {
+	id     ID
+	length uint64
+	gc     bool
+	skip   bool
+
+	origin      *ID
+	rightOrigin *ID
+	left        *item
+	right       *item
+
+	parent    *sharedType
+	parentID  *ID
+	parentSub *string
+
+	deleted bool
+	content content
+}
+
+func (s *item) lastID() ID {
+	return ID{Client: s.id.Client, Clock: s.id.Clock + s.length - 1}
+}
+
+// sharedType is a root or nested Yjs type. List content hangs off start, map
+// entries point at the latest item of each key.
+type sharedType struct {
+	typeRef  uint8
+	nodeName string
+	start    *item
+	entries  map[string]*item
+	item     *item
+}
+
+func newSharedType(typeRef uint8) *sharedType {
+	return &sharedType{typeRef: typeRef, entries: make(map[string]*item)}
+}
+
+// Doc is an in-memory Y.Doc. It is not safe for concurrent use.
+type Doc struct {
+	clients map[uint64][]*item
+	share   map[string]*sharedType
+
+	// structs and deletes that reference content the document has not seen
+	// yet; they are retried whenever an update is applied
+	pending        map[uint64][]*item
+	pendingDeletes []deleteRange
+}
+
+func NewDoc() *Doc {
+	return &Doc{
+		clients: make(map[uint64][]*item),
+		share:   make(map[string]*sharedType),
+		pending: make(map[uint64][]*item),
+	}
+}
+
+// root returns the root type called name, creating it when it does not exist
+func (doc *Doc) root(name string) *sharedType {
+	t, ok := doc.share[name]
+	if !ok {
+		t = newSharedType(typeText)
+		doc.share[name] = t
+	}
+	return t
+}
+
+// ApplyUpdate integrates a v1 encoded update. Updates may arrive in any order;
+// parts depending on missing updates stay pending until those arrive.
+func (doc *Doc) ApplyUpdate(update []byte) error {
+	decoded, err := doc.decodeUpdate(update)
+	if err != nil {
+		return err
+	}
+
+	for client, refs := range decoded.structs {
+		pending := append(doc.pending[client], refs...)
+		sort.SliceStable(pending, func(i, j int) bool {
+			return pending[i].id.Clock < pending[j].id.Clock
+		})
+		doc.pending[client] = pending
+	}
+	doc.integratePending()
+
+	deletes := append(doc.pendingDeletes, decoded.deletes...)
+	doc.pendingDeletes = nil
+	for _, r := range deletes {
+		doc.applyDelete(r)
+	}
+
+	return nil
+}
+
+// HasPending reports whether some structs or deletes could not be applied
+// because the updates they depend on are missing
+func (doc *Doc) HasPending() bool {
+	return len(doc.pending) > 0 || len(doc.pendingDeletes) > 0
+}
+
+// Text returns the content of the root Y.Text called name. Embeds and
+// formatting attributes are left out.
+func (doc *Doc) Text(name string) string {
+	t, ok := doc.share[name]
+	if !ok {
+		return ""
+	}
+
+	var units []uint16
+	for s := t.start; s != nil; s = s.right {
+		if str, ok := s.content.(*contentString); ok && !s.deleted {
+			units = append(units, str.units...)
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// state is the next expected clock of client
+func (doc *Doc) state(client uint64) uint64 {
+	structs := doc.clients[client]
+	if len(structs) == 0 {
+		return 0
+	}
+	last := structs[len(structs)-1]
+	return last.id.Clock + last.length
+}
+
+// integratePending integrates pending structs until no client can make
+// progress. Each client's structs are taken in clock order and a client
+// stops at the first struct whose dependencies are still missing.
+func (doc *Doc) integratePending() {
+	clients := make([]uint64, 0, len(doc.pending))
+	for client := range doc.pending {
+		clients = append(clients, client)
+	}
+	slices.Sort(clients)
+
+	for progress := true; progress; {
+		progress = false
+		for _, client := range clients {
+			refs := doc.pending[client]
+			n := 0
+			for ; n < len(refs); n++ {
+				s := refs[n]
+				if s.skip {
+					continue
+				}
+				state := doc.state(client)
+				if s.id.Clock > state || doc.missing(s) {
+					break
+				}
+				if offset := state - s.id.Clock; offset < s.length {
+					doc.resolve(s)
+					doc.integrate(s, offset)
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			progress = true
+			if n == len(refs) {
+				delete(doc.pending, client)
+			} else {
+				doc.pending[client] = refs[n:]
+			}
+		}
+	}
+}
+
+// missing reports whether s references structs that are not integrated yet
+func (doc *Doc) missing(s *item) bool {
+	if s.gc {
+		return false
+	}
+	for _, id := range []*ID{s.origin, s.rightOrigin, s.parentID} {
+		if id != nil && id.Clock >= doc.state(id.Client) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve turns the origins of s into neighbours, splitting the items they
+// point into, and works out its parent type
+func (doc *Doc) resolve(s *item) {
+	if s.gc {
+		return
+	}
+	if s.origin != nil {
+		s.left = doc.itemCleanEnd(*s.origin)
+		last := s.left.lastID()
+		s.origin = &last
+	}
+	if s.rightOrigin != nil {
+		s.right = doc.itemCleanStart(*s.rightOrigin)
+		id := s.right.id
+		s.rightOrigin = &id
+	}
+
+	switch {
+	case (s.left != nil && s.left.gc) || (s.right != nil && s.right.gc):
+		s.parent = nil
+	case s.parent == nil && s.parentID == nil:
+		if s.left != nil {
+			s.parent = s.left.parent
+			s.parentSub = s.left.parentSub
+		}
+		if s.right != nil {
+			s.parent = s.right.parent
+			s.parentSub = s.right.parentSub
+		}
+	case s.parentID != nil:
+		if parent := doc.item(*s.parentID); !parent.gc {
+			if c, ok := parent.content.(*contentType); ok {
+				s.parent = c.t
+			}
+		}
+	}
+	s.parentID = nil
+}
+
+// integrate links s into its parent, resolving concurrent inserts at the same
+// position. offset skips the part of s the document already has.
+func (doc *Doc) integrate(s *item, offset uint64) {
+	if s.gc {
+		s.id.Clock += offset
+		s.length -= offset
+		doc.addStruct(s)
+		return
+	}
+
+	if offset > 0 {
+		s.id.Clock += offset
+		s.left = doc.itemCleanEnd(ID{Client: s.id.Client, Clock: s.id.Clock - 1})
+		last := s.left.lastID()
+		s.origin = &last
+		s.content = s.content.splice(offset)
+		s.length -= offset
+	}
+
+	if s.parent == nil {
+		doc.addStruct(&item{id: s.id, length: s.length, gc: true, deleted: true})
+		return
+	}
+
+	if (s.left == nil && (s.right == nil || s.right.left != nil)) || (s.left != nil && s.left.right != s.right) {
+		left := s.left
+		var o *item
+		if left != nil {
+			o = left.right
+		} else {
+			o = doc.firstChild(s.parent, s.parentSub)
+		}
+
+		conflicting := make(map[*item]bool)
+		beforeOrigin := make(map[*item]bool)
+		for o != nil && o != s.right {
+			beforeOrigin[o] = true
+			conflicting[o] = true
+			if sameID(s.origin, o.origin) {
+				// same origin, the lower client id goes first
+				if o.id.Client < s.id.Client {
+					left = o
+					clear(conflicting)
+				} else if sameID(s.rightOrigin, o.rightOrigin) {
+					break
+				}
+			} else if o.origin != nil && beforeOrigin[doc.item(*o.origin)] {
+				if !conflicting[doc.item(*o.origin)] {
+					left = o
+					clear(conflicting)
+				}
+			} else {
+				break
+			}
+			o = o.right
+		}
+		s.left = left
+	}
+
+	if s.left != nil {
+		s.right = s.left.right
+		s.left.right = s
+	} else {
+		s.right = doc.firstChild(s.parent, s.parentSub)
+		if s.parentSub == nil {
+			s.parent.start = s
+		}
+	}
+	if s.right != nil {
+		s.right.left = s
+	} else if s.parentSub != nil {
+		// the newest item of a map key wins, the one it replaced is deleted
+		s.parent.entries[*s.parentSub] = s
+		if s.left != nil {
+			doc.deleteItem(s.left)
+		}
+	}
+
+	doc.addStruct(s)
+	switch c := s.content.(type) {
+	case *contentType:
+		c.t.item = s
+	case *contentDeleted:
+		s.deleted = true
+	}
+
+	if (s.parent.item != nil && s.parent.item.deleted) || (s.parentSub != nil && s.right != nil) {
+		doc.deleteItem(s)
+	}
+}
+
+// firstChild is the first item of a list, or of the history of a map key
+func (doc *Doc) firstChild(parent *sharedType, parentSub *string) *item {
+	if parentSub == nil {
+		return parent.start
+	}
+	o := parent.entries[*parentSub]
+	for o != nil && o.left != nil {
+		o = o.left
+	}
+	return o
+}
+
+func (doc *Doc) addStruct(s *item) {
+	doc.clients[s.id.Client] = append(doc.clients[s.id.Client], s)
+}
+
+func (doc *Doc) deleteItem(s *item) {
+	if s.deleted {
+		return
+	}
+	s.deleted = true
+	if c, ok := s.content.(*contentType); ok {
+		for child := c.t.start; child != nil; child = child.right {
+			doc.deleteItem(child)
+		}
+		for _, child := range c.t.entries {
+			doc.deleteItem(child)
+		}
+	}
+}
+
+// applyDelete deletes the integrated part of r and keeps the rest pending
+func (doc *Doc) applyDelete(r deleteRange) {
+	state := doc.state(r.client)
+	end := r.clock + r.length
+	if r.clock >= state {
+		doc.pendingDeletes = append(doc.pendingDeletes, r)
+		return
+	}
+	if state < end {
+		doc.pendingDeletes = append(doc.pendingDeletes, deleteRange{client: r.client, clock: state, length: end - state})
+	}
+
+	index := findIndex(doc.clients[r.client], r.clock)
+	if s := doc.clients[r.client][index]; !s.deleted && s.id.Clock < r.clock {
+		doc.insertStruct(index+1, doc.splitItem(s, r.clock-s.id.Clock))
+		index++
+	}
+	for index < len(doc.clients[r.client]) {
+		s := doc.clients[r.client][index]
+		index++
+		if s.id.Clock >= end {
+			break
+		}
+		if !s.deleted {
+			if end < s.id.Clock+s.length {
+				doc.insertStruct(index, doc.splitItem(s, end-s.id.Clock))
+			}
+			doc.deleteItem(s)
+		}
+	}
+}
+
+// item returns the struct containing id
+func (doc *Doc) item(id ID) *item {
+	structs := doc.clients[id.Client]
+	return structs[findIndex(structs, id.Clock)]
+}
+
+// itemCleanStart returns the item starting at id, splitting it off first when
+// id points into the middle of an item
+func (doc *Doc) itemCleanStart(id ID) *item {
+	structs := doc.clients[id.Client]
+	index := findIndex(structs, id.Clock)
+	s := structs[index]
+	if s.id.Clock < id.Clock && !s.gc {
+		right := doc.splitItem(s, id.Clock-s.id.Clock)
+		doc.insertStruct(index+1, right)
+		return right
+	}
+	return s
+}
+
+// itemCleanEnd returns the item ending at id, splitting off what follows it
+func (doc *Doc) itemCleanEnd(id ID) *item {
+	structs := doc.clients[id.Client]
+	index := findIndex(structs, id.Clock)
+	s := structs[index]
+	if id.Clock != s.lastID().Clock && !s.gc {
+		doc.insertStruct(index+1, doc.splitItem(s, id.Clock-s.id.Clock+1))
+	}
+	return s
+}
+
+func (doc *Doc) insertStruct(index int, s *item) {
+	doc.clients[s.id.Client] = slices.Insert(doc.clients[s.id.Client], index, s)
+}
+
+// splitItem cuts left at diff and returns the new right half, already linked
+// in after left
+func (doc *Doc) splitItem(left *item, diff uint64) *item {
+	right := &item{
+		id:          ID{Client: left.id.Client, Clock: left.id.Clock + diff},
+		origin:      &ID{Client: left.id.Client, Clock: left.id.Clock + diff - 1},
+		left:        left,
+		right:       left.right,
+		rightOrigin: left.rightOrigin,
+		parent:      left.parent,
+		parentSub:   left.parentSub,
+		deleted:     left.deleted,
+		content:     left.content.splice(diff),
+	}
+	right.length = right.content.length()
+	left.length = diff
+
+	left.right = right
+	if right.right != nil {
+		right.right.left = right
+	}
+	if right.parentSub != nil && right.right == nil {
+		right.parent.entries[*right.parentSub] = right
+	}
+	return right
+}
+
+// findIndex binary searches the struct containing clock. Callers make sure
+// clock is below the client state.
+func findIndex(structs []*item, clock uint64) int {
+	return sort.Search(len(structs), func(i int) bool {
+		return structs[i].id.Clock+structs[i].length > clock
+	})
+}
+
+func sameID(a, b *ID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
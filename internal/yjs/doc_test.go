@@ -0,0 +1,110 @@
+package yjs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// client 1 inserts "abc" into the root text "t"
+var insertABC = []byte{0x01, 0x01, 0x01, 0x00, 0x04, 0x01, 0x01, 0x74, 0x03, 0x61, 0x62, 0x63, 0x00}
+
+// client 2 inserts "X" between "a" and "b" of insertABC
+var insertX = []byte{0x01, 0x01, 0x02, 0x00, 0xc4, 0x01, 0x00, 0x01, 0x01, 0x01, 0x58, 0x00}
+
+// client 3 concurrently inserts "Y" at the same position as insertX
+var insertY = []byte{0x01, 0x01, 0x03, 0x00, 0xc4, 0x01, 0x00, 0x01, 0x01, 0x01, 0x59, 0x00}
+
+// deleteOf builds an update without structs that deletes length clocks of
+// client 1 starting at clock
+func deleteOf(clock, length byte) []byte {
+	return []byte{0x00, 0x01, 0x01, 0x01, clock, length}
+}
+
+func applyAll(t *testing.T, updates ...[]byte) *Doc {
+	doc := NewDoc()
+	for _, u := range updates {
+		assert.NoError(t, doc.ApplyUpdate(u))
+	}
+	return doc
+}
+
+// TestApplyUpdate_InsertText tests reading text inserted by a single update
+func TestApplyUpdate_InsertText(t *testing.T) {
+	doc := applyAll(t, insertABC)
+
+	assert.Equal(t, "abc", doc.Text("t"))
+	assert.Equal(t, "", doc.Text("missing"))
+	assert.False(t, doc.HasPending())
+}
+
+// TestApplyUpdate_InsertInsideItem tests an insert that splits an existing item
+func TestApplyUpdate_InsertInsideItem(t *testing.T) {
+	doc := applyAll(t, insertABC, insertX)
+
+	assert.Equal(t, "aXbc", doc.Text("t"))
+}
+
+// TestApplyUpdate_ConcurrentInserts tests that concurrent inserts converge
+// regardless of the order they are applied in
+func TestApplyUpdate_ConcurrentInserts(t *testing.T) {
+	first := applyAll(t, insertABC, insertX, insertY)
+	second := applyAll(t, insertABC, insertY, insertX)
+
+	assert.Equal(t, "aXYbc", first.Text("t"))
+	assert.Equal(t, first.Text("t"), second.Text("t"))
+}
+
+// TestApplyUpdate_Delete tests applying delete sets
+func TestApplyUpdate_Delete(t *testing.T) {
+	doc := applyAll(t, insertABC, deleteOf(1, 1))
+	assert.Equal(t, "ac", doc.Text("t"))
+
+	doc = applyAll(t, insertABC, insertX, deleteOf(0, 3))
+	assert.Equal(t, "X", doc.Text("t"))
+}
+
+// TestApplyUpdate_OutOfOrder tests that updates depending on missing content
+// stay pending until it arrives
+func TestApplyUpdate_OutOfOrder(t *testing.T) {
+	doc := applyAll(t, insertX, deleteOf(2, 1))
+	assert.Equal(t, "", doc.Text("t"))
+	assert.True(t, doc.HasPending())
+
+	assert.NoError(t, doc.ApplyUpdate(insertABC))
+	assert.Equal(t, "aXb", doc.Text("t"))
+	assert.False(t, doc.HasPending())
+}
+
+// TestApplyUpdate_SurrogatePairs tests that clocks count UTF-16 code units
+func TestApplyUpdate_SurrogatePairs(t *testing.T) {
+	// client 1 inserts "😀b", client 2 inserts "X" right after the emoji
+	emoji := []byte{0x01, 0x01, 0x01, 0x00, 0x04, 0x01, 0x01, 0x74, 0x05, 0xf0, 0x9f, 0x98, 0x80, 0x62, 0x00}
+	insert := []byte{0x01, 0x01, 0x02, 0x00, 0xc4, 0x01, 0x01, 0x01, 0x02, 0x01, 0x58, 0x00}
+
+	doc := applyAll(t, emoji, insert)
+
+	assert.Equal(t, "😀Xb", doc.Text("t"))
+}
+
+// TestApplyUpdate_MultiByteClient tests client ids that take several bytes
+func TestApplyUpdate_MultiByteClient(t *testing.T) {
+	// client 300 inserts "hi" into "t"
+	update := []byte{0x01, 0x01, 0xac, 0x02, 0x00, 0x04, 0x01, 0x01, 0x74, 0x02, 0x68, 0x69, 0x00}
+
+	doc := applyAll(t, update)
+
+	assert.Equal(t, "hi", doc.Text("t"))
+}
+
+// TestApplyUpdate_Truncated tests that a truncated update is rejected without
+// changing the document
+func TestApplyUpdate_Truncated(t *testing.T) {
+	doc := applyAll(t, insertABC)
+
+	err := doc.ApplyUpdate(insertX[:7])
+
+	assert.ErrorIs(t, err, ErrUnexpectedEOF)
+	assert.Equal(t, "abc", doc.Text("t"))
+	assert.False(t, doc.HasPending())
+}
@@ -0,0 +1,145 @@
+package yjs
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"slices"
+)
+
+// encoder writes the lib0 binary encoding used by Yjs v1 updates
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) writeUint8(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) writeVarUint(num uint64) {
+	for num >= 0x80 {
+		e.buf = append(e.buf, byte(num)|0x80)
+		num >>= 7
+	}
+	e.buf = append(e.buf, byte(num))
+}
+
+func (e *encoder) writeVarBytes(b []byte) {
+	e.writeVarUint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) writeVarString(s string) {
+	e.writeVarBytes([]byte(s))
+}
+
+// writeVarInt mirrors readVarInt: sign bit and 6 bits in the first byte
+func (e *encoder) writeVarInt(num int64) {
+	negative := num < 0
+	abs := uint64(num)
+	if negative {
+		abs = uint64(-num)
+	}
+
+	b := byte(abs & 0x3f)
+	if negative {
+		b |= 0x40
+	}
+	abs >>= 6
+	if abs > 0 {
+		b |= 0x80
+	}
+	e.buf = append(e.buf, b)
+	for abs > 0 {
+		b = byte(abs & 0x7f)
+		abs >>= 7
+		if abs > 0 {
+			b |= 0x80
+		}
+		e.buf = append(e.buf, b)
+	}
+}
+
+// writeAny writes values as readAny returns them. Object keys are sorted since
+// their original order is not kept.
+func (e *encoder) writeAny(v any) error {
+	switch v := v.(type) {
+	case Undefined:
+		e.writeUint8(127)
+	case nil:
+		e.writeUint8(126)
+	case int64:
+		e.writeUint8(125)
+		e.writeVarInt(v)
+	case float32:
+		e.writeUint8(124)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(v))
+	case float64:
+		e.writeUint8(123)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v))
+	case *big.Int:
+		e.writeUint8(122)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v.Int64()))
+	case bool:
+		if v {
+			e.writeUint8(120)
+		} else {
+			e.writeUint8(121)
+		}
+	case string:
+		e.writeUint8(119)
+		e.writeVarString(v)
+	case map[string]any:
+		e.writeUint8(118)
+		e.writeVarUint(uint64(len(v)))
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			e.writeVarString(key)
+			if err := e.writeAny(v[key]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		e.writeUint8(117)
+		e.writeVarUint(uint64(len(v)))
+		for _, item := range v {
+			if err := e.writeAny(item); err != nil {
+				return err
+			}
+		}
+	case []byte:
+		e.writeUint8(116)
+		e.writeVarBytes(v)
+	default:
+		return ErrMalformed
+	}
+	return nil
+}
+
+// NewTextUpdate encodes an update that inserts text into an empty root Y.Text
+// called name, as if client had typed it in one go. Applying it is the same
+// as ydoc.getText(name).insert(0, text). text must be valid UTF-8.
+func NewTextUpdate(client uint64, name string, text string) []byte {
+	e := &encoder{}
+	if text == "" {
+		// no structs, empty delete set
+		e.writeVarUint(0)
+		e.writeVarUint(0)
+		return e.buf
+	}
+
+	e.writeVarUint(1) // clients
+	e.writeVarUint(1) // structs of the client
+	e.writeVarUint(client)
+	e.writeVarUint(0) // clock
+	e.writeUint8(refString)
+	e.writeVarUint(1) // parent is a root type
+	e.writeVarString(name)
+	e.writeVarString(text)
+	e.writeVarUint(0) // delete set
+	return e.buf
+}
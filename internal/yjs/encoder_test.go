@@ -0,0 +1,34 @@
+package yjs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNewTextUpdate tests the encoded bytes match what Yjs produces
+func TestNewTextUpdate(t *testing.T) {
+	assert.Equal(t, insertABC, NewTextUpdate(1, "t", "abc"))
+}
+
+// TestNewTextUpdate_RoundTrip tests the update decodes back to the text
+func TestNewTextUpdate_RoundTrip(t *testing.T) {
+	text := "# Wiki 😀\n\n- café\n"
+	doc := NewDoc()
+
+	assert.NoError(t, doc.ApplyUpdate(NewTextUpdate(2873495120, "content", text)))
+	assert.Equal(t, text, doc.Text("content"))
+
+	// a later insert after the emoji must line up with UTF-16 clocks
+	insert := []byte{0x01, 0x01, 0x07, 0x00, 0xc4, 0xd0, 0x9c, 0x98, 0xda, 0x0a, 0x08, 0xd0, 0x9c, 0x98, 0xda, 0x0a, 0x09, 0x01, 0x21, 0x00}
+	assert.NoError(t, doc.ApplyUpdate(insert))
+	assert.Equal(t, "# Wiki 😀!\n\n- café\n", doc.Text("content"))
+}
+
+// TestNewTextUpdate_Empty tests an empty text encodes an empty update
+func TestNewTextUpdate_Empty(t *testing.T) {
+	doc := NewDoc()
+
+	assert.NoError(t, doc.ApplyUpdate(NewTextUpdate(1, "content", "")))
+	assert.Equal(t, "", doc.Text("content"))
+}
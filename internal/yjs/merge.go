@@ -0,0 +1,232 @@
+package yjs
+
+import (
+	"cmp"
+	"slices"
+)
+
+// mergeStruct is a struct of one of the updates being merged, along with its
+// original encoding
+type mergeStruct struct {
+	*item
+	encoded []byte
+}
+
+// MergeUpdates combines v1 updates into a single update, following Yjs'
+// mergeUpdates: applying the result is the same as applying every update, in
+// any order. Nothing is integrated, so structs that depend on updates missing
+// from the input are kept, with skips over the gaps in their clocks.
+func MergeUpdates(updates ...[]byte) ([]byte, error) {
+	// the document only backs decoding, root types are never read from it
+	doc := NewDoc()
+	clients := make(map[uint64][]mergeStruct)
+	var deletes []deleteRange
+
+	for _, update := range updates {
+		decoded, err := doc.decodeUpdate(update)
+		if err != nil {
+			return nil, err
+		}
+		for client, structs := range decoded.structs {
+			for i, s := range structs {
+				clients[client] = append(clients[client], mergeStruct{item: s, encoded: decoded.encoded[client][i]})
+			}
+		}
+		deletes = append(deletes, decoded.deletes...)
+	}
+
+	ids := make([]uint64, 0, len(clients))
+	for client := range clients {
+		ids = append(ids, client)
+	}
+	// higher client ids first, as Yjs writes them
+	slices.SortFunc(ids, func(a, b uint64) int { return cmp.Compare(b, a) })
+
+	type clientStructs struct {
+		client uint64
+		clock  uint64
+		count  uint64
+		body   *encoder
+	}
+	var written []clientStructs
+	for _, client := range ids {
+		structs := clients[client]
+		// for the same clock take real structs over skips, then the longest
+		slices.SortStableFunc(structs, func(a, b mergeStruct) int {
+			if c := cmp.Compare(a.id.Clock, b.id.Clock); c != 0 {
+				return c
+			}
+			if a.skip != b.skip {
+				if a.skip {
+					return 1
+				}
+				return -1
+			}
+			return cmp.Compare(b.length, a.length)
+		})
+
+		out := clientStructs{client: client, body: &encoder{}}
+		var end uint64
+		for _, s := range structs {
+			if s.skip {
+				continue
+			}
+			if out.count == 0 {
+				out.clock = s.id.Clock
+				end = s.id.Clock
+			}
+			if s.id.Clock+s.length <= end {
+				// already written by another update
+				continue
+			}
+
+			switch {
+			case s.id.Clock > end:
+				out.body.writeUint8(refSkip)
+				out.body.writeVarUint(s.id.Clock - end)
+				out.count++
+				out.body.buf = append(out.body.buf, s.encoded...)
+			case s.id.Clock < end:
+				if err := out.body.writeSlice(s.item, end-s.id.Clock); err != nil {
+					return nil, err
+				}
+			default:
+				out.body.buf = append(out.body.buf, s.encoded...)
+			}
+			out.count++
+			end = s.id.Clock + s.length
+		}
+		if out.count > 0 {
+			written = append(written, out)
+		}
+	}
+
+	e := &encoder{}
+	e.writeVarUint(uint64(len(written)))
+	for _, c := range written {
+		e.writeVarUint(c.count)
+		e.writeVarUint(c.client)
+		e.writeVarUint(c.clock)
+		e.buf = append(e.buf, c.body.buf...)
+	}
+	e.writeDeleteSet(mergeDeletes(deletes))
+
+	return e.buf, nil
+}
+
+// writeSlice writes s without its first offset clocks. The rest of an item is
+// anchored right after the part that was cut off, like Yjs' sliceStruct.
+func (e *encoder) writeSlice(s *item, offset uint64) error {
+	if s.gc {
+		e.writeUint8(refGC)
+		e.writeVarUint(s.length - offset)
+		return nil
+	}
+
+	rest := s.content.splice(offset)
+	ref, err := contentRef(rest)
+	if err != nil {
+		return err
+	}
+
+	info := hasOrigin | ref
+	if s.rightOrigin != nil {
+		info |= hasRightOrigin
+	}
+	e.writeUint8(info)
+	e.writeVarUint(s.id.Client)
+	e.writeVarUint(s.id.Clock + offset - 1)
+	if s.rightOrigin != nil {
+		e.writeVarUint(s.rightOrigin.Client)
+		e.writeVarUint(s.rightOrigin.Clock)
+	}
+	return e.writeContent(rest)
+}
+
+// contentRef returns the ref of the content kinds that can span several clocks,
+// the only ones that are ever sliced
+func contentRef(c content) (byte, error) {
+	switch c.(type) {
+	case *contentDeleted:
+		return refDeleted, nil
+	case *contentJSON:
+		return refJSON, nil
+	case *contentString:
+		return refString, nil
+	case *contentAny:
+		return refAny, nil
+	}
+	return 0, ErrMalformed
+}
+
+func (e *encoder) writeContent(c content) error {
+	switch c := c.(type) {
+	case *contentDeleted:
+		e.writeVarUint(c.n)
+	case *contentJSON:
+		e.writeVarUint(uint64(len(c.values)))
+		for _, v := range c.values {
+			e.writeVarString(v)
+		}
+	case *contentString:
+		e.writeVarString(c.String())
+	case *contentAny:
+		e.writeVarUint(uint64(len(c.values)))
+		for _, v := range c.values {
+			if err := e.writeAny(v); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrMalformed
+	}
+	return nil
+}
+
+// mergeDeletes sorts delete ranges and joins the ones that overlap or touch
+func mergeDeletes(deletes []deleteRange) []deleteRange {
+	slices.SortFunc(deletes, func(a, b deleteRange) int {
+		if c := cmp.Compare(b.client, a.client); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.clock, b.clock)
+	})
+
+	var merged []deleteRange
+	for _, r := range deletes {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.client == r.client && r.clock <= last.clock+last.length {
+				last.length = max(last.length, r.clock+r.length-last.clock)
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// writeDeleteSet writes ranges grouped by client, as mergeDeletes orders them
+func (e *encoder) writeDeleteSet(deletes []deleteRange) {
+	var clients int
+	for i, r := range deletes {
+		if i == 0 || r.client != deletes[i-1].client {
+			clients++
+		}
+	}
+
+	e.writeVarUint(uint64(clients))
+	for i := 0; i < len(deletes); {
+		j := i
+		for j < len(deletes) && deletes[j].client == deletes[i].client {
+			j++
+		}
+		e.writeVarUint(deletes[i].client)
+		e.writeVarUint(uint64(j - i))
+		for _, r := range deletes[i:j] {
+			e.writeVarUint(r.clock)
+			e.writeVarUint(r.length)
+		}
+		i = j
+	}
+}
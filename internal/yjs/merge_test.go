@@ -0,0 +1,112 @@
+package yjs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// client 1 types "cde" as one item right after "b" of insertABC, as a state
+// update written before the item was split would carry it
+var insertCDE = []byte{0x01, 0x01, 0x01, 0x02, 0x84, 0x01, 0x01, 0x03, 0x63, 0x64, 0x65, 0x00}
+
+// TestMergeUpdates tests that the merged update gives the same document as
+// applying the updates one by one
+func TestMergeUpdates(t *testing.T) {
+	updates := [][]byte{insertABC, insertX, insertY, deleteOf(1, 1)}
+
+	merged, err := MergeUpdates(updates...)
+	assert.NoError(t, err)
+
+	doc := applyAll(t, merged)
+	assert.Equal(t, applyAll(t, updates...).Text("t"), doc.Text("t"))
+	assert.Equal(t, "aXYc", doc.Text("t"))
+	assert.False(t, doc.HasPending())
+}
+
+// TestMergeUpdates_Duplicates tests that structs present in several updates are
+// written once
+func TestMergeUpdates_Duplicates(t *testing.T) {
+	merged, err := MergeUpdates(insertABC, insertABC)
+
+	assert.NoError(t, err)
+	assert.Equal(t, insertABC, merged)
+}
+
+// TestMergeUpdates_Overlap tests that a struct overlapping one already merged
+// is sliced
+func TestMergeUpdates_Overlap(t *testing.T) {
+	merged, err := MergeUpdates(insertABC, insertCDE)
+	assert.NoError(t, err)
+
+	doc := applyAll(t, merged)
+	assert.Equal(t, "abcde", doc.Text("t"))
+	assert.False(t, doc.HasPending())
+}
+
+// TestMergeUpdates_Gap tests that structs after missing clocks survive the
+// merge behind a skip and still apply once the missing update arrives
+func TestMergeUpdates_Gap(t *testing.T) {
+	// client 1 clock 5 appends "f" after clock 4, clocks 3-4 are missing
+	appendF := []byte{0x01, 0x01, 0x01, 0x05, 0x84, 0x01, 0x04, 0x01, 0x66, 0x00}
+	// client 1 clocks 3-4 append "de" after "c"
+	insertDE := []byte{0x01, 0x01, 0x01, 0x03, 0x84, 0x01, 0x02, 0x02, 0x64, 0x65, 0x00}
+
+	merged, err := MergeUpdates(insertABC, appendF)
+	assert.NoError(t, err)
+	// "abc", a skip over clocks 3-4, then "f"
+	assert.Equal(t, []byte{0x01, 0x03, 0x01, 0x00}, merged[:4])
+	assert.Contains(t, string(merged), string([]byte{refSkip, 0x02}))
+
+	doc := applyAll(t, merged)
+	assert.Equal(t, "abc", doc.Text("t"))
+	assert.True(t, doc.HasPending())
+
+	assert.NoError(t, doc.ApplyUpdate(insertDE))
+	assert.Equal(t, "abcdef", doc.Text("t"))
+	assert.False(t, doc.HasPending())
+}
+
+// TestMergeUpdates_Snapshot tests merging a snapshot with later updates into a
+// new snapshot, then merging that again
+func TestMergeUpdates_Snapshot(t *testing.T) {
+	snapshot, err := MergeUpdates(insertABC, insertX)
+	assert.NoError(t, err)
+
+	next, err := MergeUpdates(snapshot, insertY, deleteOf(0, 1))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "XYbc", applyAll(t, next).Text("t"))
+}
+
+// TestMergeDeletes tests that overlapping and adjacent ranges are joined
+func TestMergeDeletes(t *testing.T) {
+	merged := mergeDeletes([]deleteRange{
+		{client: 1, clock: 4, length: 2},
+		{client: 2, clock: 0, length: 1},
+		{client: 1, clock: 0, length: 2},
+		{client: 1, clock: 1, length: 3},
+	})
+
+	assert.Equal(t, []deleteRange{
+		{client: 2, clock: 0, length: 1},
+		{client: 1, clock: 0, length: 6},
+	}, merged)
+}
+
+// TestWriteAny tests that values written by writeAny read back the same
+func TestWriteAny(t *testing.T) {
+	values := []any{
+		Undefined{}, nil, int64(-70), int64(1 << 40), float32(1.5), 2.25, true, false,
+		"café", map[string]any{"b": int64(1), "a": []any{"x"}}, []byte{0x01, 0x02},
+	}
+
+	for _, v := range values {
+		e := &encoder{}
+		assert.NoError(t, e.writeAny(v))
+
+		got, err := newDecoder(e.buf).readAny()
+		assert.NoError(t, err)
+		assert.Equal(t, v, got)
+	}
+}
@@ -0,0 +1,178 @@
+package yjs
+
+// ID identifies a struct by the client that created it and its logical clock
+type ID struct {
+	Client uint64
+	Clock  uint64
+}
+
+// info byte flags of an item
+const (
+	hasOrigin      = 0x80
+	hasRightOrigin = 0x40
+	hasParentSub   = 0x20
+	refMask        = 0x1f
+)
+
+// deleteRange is a run of deleted clocks of one client
+type deleteRange struct {
+	client uint64
+	clock  uint64
+	length uint64
+}
+
+// decodedUpdate holds the structs, grouped per client in clock order, and the
+// delete set of a v1 update
+type decodedUpdate struct {
+	structs map[uint64][]*item
+	// encoded holds the bytes of each struct, in the same order as structs
+	encoded map[uint64][][]byte
+	deletes []deleteRange
+}
+
+func readID(d *decoder) (*ID, error) {
+	client, err := d.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	clock, err := d.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	return &ID{Client: client, Clock: clock}, nil
+}
+
+// decodeUpdate reads a whole update before anything is applied so a truncated
+// update leaves the document untouched
+func (doc *Doc) decodeUpdate(update []byte) (*decodedUpdate, error) {
+	d := newDecoder(update)
+	result := &decodedUpdate{
+		structs: make(map[uint64][]*item),
+		encoded: make(map[uint64][][]byte),
+	}
+
+	numClients, err := d.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < numClients; i++ {
+		numStructs, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		client, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		clock, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+
+		refs := make([]*item, 0, min(numStructs, uint64(len(update))))
+		encoded := make([][]byte, 0, cap(refs))
+		for j := uint64(0); j < numStructs; j++ {
+			start := d.pos
+			s, err := doc.readStruct(d, ID{Client: client, Clock: clock})
+			if err != nil {
+				return nil, err
+			}
+			clock += s.length
+			refs = append(refs, s)
+			encoded = append(encoded, d.buf[start:d.pos])
+		}
+		result.structs[client] = append(result.structs[client], refs...)
+		result.encoded[client] = append(result.encoded[client], encoded...)
+	}
+
+	numDeleteClients, err := d.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < numDeleteClients; i++ {
+		client, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		numDeletes, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < numDeletes; j++ {
+			clock, err := d.readVarUint()
+			if err != nil {
+				return nil, err
+			}
+			length, err := d.readVarUint()
+			if err != nil {
+				return nil, err
+			}
+			result.deletes = append(result.deletes, deleteRange{client: client, clock: clock, length: length})
+		}
+	}
+
+	return result, nil
+}
+
+func (doc *Doc) readStruct(d *decoder, id ID) (*item, error) {
+	info, err := d.readUint8()
+	if err != nil {
+		return nil, err
+	}
+
+	switch info & refMask {
+	case refGC, refSkip:
+		length, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		return &item{id: id, length: length, gc: info&refMask == refGC, skip: info&refMask == refSkip, deleted: true}, nil
+	}
+
+	s := &item{id: id}
+	if info&hasOrigin > 0 {
+		if s.origin, err = readID(d); err != nil {
+			return nil, err
+		}
+	}
+	if info&hasRightOrigin > 0 {
+		if s.rightOrigin, err = readID(d); err != nil {
+			return nil, err
+		}
+	}
+
+	// without origins the parent is written out, otherwise it is copied from
+	// the neighbours during integration
+	if info&(hasOrigin|hasRightOrigin) == 0 {
+		isRoot, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if isRoot == 1 {
+			name, err := d.readVarString()
+			if err != nil {
+				return nil, err
+			}
+			s.parent = doc.root(name)
+		} else if s.parentID, err = readID(d); err != nil {
+			return nil, err
+		}
+
+		if info&hasParentSub > 0 {
+			sub, err := d.readVarString()
+			if err != nil {
+				return nil, err
+			}
+			s.parentSub = &sub
+		}
+	}
+
+	if s.content, err = readContent(d, info&refMask); err != nil {
+		return nil, err
+	}
+	if s.length = s.content.length(); s.length == 0 {
+		return nil, ErrMalformed
+	}
+
+	return s, nil
+}